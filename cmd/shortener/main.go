@@ -7,10 +7,15 @@ import (
 	"github.com/ujwegh/shortener/internal/app/config"
 	"github.com/ujwegh/shortener/internal/app/handlers"
 	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/metrics"
 	"github.com/ujwegh/shortener/internal/app/middlware"
+	"github.com/ujwegh/shortener/internal/app/model"
 	"github.com/ujwegh/shortener/internal/app/router"
 	"github.com/ujwegh/shortener/internal/app/service"
 	"github.com/ujwegh/shortener/internal/app/storage"
+	"github.com/ujwegh/shortener/internal/app/tracing"
+	"go.uber.org/zap"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -21,23 +26,99 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == migrateDataCommand {
+		if err := runMigrateData(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Server run context
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 
 	c := config.ParseFlags()
 	logger.InitLogger(c.LogLevel)
-	s := storage.NewStorage(c)
-	taskChannel := make(chan service.Task, 100)
+	shutdownTracing, err := tracing.Setup(c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	backend := storage.NewStorage(c)
+	var s storage.Storage = storage.NewTracedStorage(backend)
+	if c.CacheSize > 0 {
+		cache := storage.NewCachedStorage(s, c.CacheSize,
+			time.Duration(c.CacheTTLSec)*time.Second, time.Duration(c.CacheNegativeTTLSec)*time.Second)
+		// Drop entries changed by other instances sharing the database
+		if notifier, ok := backend.(storage.Notifier); ok {
+			events, unsubscribe := notifier.Subscribe()
+			defer unsubscribe()
+			go cache.Follow(serverCtx, events)
+		}
+		s = cache
+	}
+	if db, ok := backend.(*storage.DBStorage); ok {
+		go db.Listen(serverCtx)
+		metrics.RegisterDBStats(db.DB())
+	}
+	taskChannel := make(chan service.Task, c.DeleteQueueSize)
 
-	ss := service.NewShortenerService(s, taskChannel)
-	sh := handlers.NewShortenerHandlers(c.ShortenedURLAddr, c.ContextTimeoutSec, ss, s)
+	opts := []service.Option{
+		service.WithKeyGenerator(service.NewKeyGenerator(c, backend)),
+		service.WithDeletionConfig(service.DeletionConfig{
+			Workers:       c.DeleteWorkers,
+			ChunkSize:     c.DeleteChunkSize,
+			BatchSize:     c.DeleteBatchSize,
+			FlushInterval: time.Duration(c.DeleteFlushIntervalMs) * time.Millisecond,
+		}),
+	}
+	if queue, ok := backend.(storage.DeletionQueue); ok {
+		opts = append(opts, service.WithDeletionQueue(queue))
+	}
+	var clickChannel chan model.Click
+	if c.ClickBufferSize > 0 {
+		clickChannel = make(chan model.Click, c.ClickBufferSize)
+		opts = append(opts, service.WithClickChannel(clickChannel))
+	}
+
+	ss := service.NewShortenerService(s, taskChannel, opts...)
 	ts := service.NewTokenService(c)
+	sh := handlers.NewShortenerHandlers(c.ShortenedURLAddr, c.ContextTimeoutSec, service.NewTracedShortenerService(ss), s, ts,
+		c.LinkAccessTTLSec)
 	am := middlware.NewAuthMiddleware(ts)
 
-	r := router.NewAppRouter(sh, am)
+	tm := middlware.NewTrustedSubnetMiddleware(c.TrustedSubnet, strings.Split(c.TrustedProxies, ","))
+
+	r := router.NewAppRouter(sh, am, tm)
 
 	// Start the goroutine
-	go ss.BatchProcess(serverCtx, taskChannel)
+	batchDone := make(chan struct{})
+	go func() {
+		ss.BatchProcess(serverCtx, taskChannel)
+		close(batchDone)
+	}()
+	clicksDone := make(chan struct{})
+	go func() {
+		ss.ClickProcess(serverCtx, clickChannel)
+		close(clicksDone)
+	}()
+	go ss.RunJanitor(serverCtx, time.Duration(c.JanitorIntervalSec)*time.Second,
+		time.Duration(c.ExpiredGracePeriodSec)*time.Second, c.PurgeBatchSize)
+	var archive func([]model.ShortenedURL) error
+	if c.PurgeArchivePath != "" {
+		archive = storage.NewArchive(c.PurgeArchivePath).Append
+	}
+	go ss.RunPurger(serverCtx, time.Duration(c.PurgeIntervalSec)*time.Second,
+		time.Duration(c.DeletedRetentionSec)*time.Second, c.PurgeBatchSize, archive)
+	if fs, ok := backend.(*storage.FileStorage); ok {
+		go fs.RunCompaction(serverCtx, time.Duration(c.CompactionIntervalSec)*time.Second)
+		// Compact on demand with SIGUSR1
+		compactSig := make(chan os.Signal, 1)
+		signal.Notify(compactSig, syscall.SIGUSR1)
+		go func() {
+			for range compactSig {
+				fs.TriggerCompaction()
+			}
+		}()
+	}
 	// The HTTP Server
 	server := &http.Server{Addr: c.ServerAddr, Handler: r}
 
@@ -49,9 +130,7 @@ func main() {
 
 		// Shutdown signal with grace period of 30 seconds
 		shutdownCtx, cancelFunc := context.WithTimeout(serverCtx, 30*time.Second)
-		cancelFunc()
-		// Inform goroutine to stop processing
-		close(taskChannel)
+		defer cancelFunc()
 		go func() {
 			<-shutdownCtx.Done()
 			if shutdownCtx.Err() == context.DeadlineExceeded {
@@ -64,15 +143,33 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+		// Inform goroutine to stop processing, no request can enqueue a deletion anymore
+		close(taskChannel)
 		serverStopCtx()
 	}()
 
 	// Run the server
 	fmt.Printf("Starting server on port %s...\n", strings.Split(c.ServerAddr, ":")[1])
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
 	// Wait for server context to be stopped
 	<-serverCtx.Done()
+	// Let pending deletions reach the storage before closing it
+	<-batchDone
+	<-clicksDone
+	stats := ss.LookupStats()
+	logger.Log.Info("redirect lookups", zap.Int64("total", stats.Lookups),
+		zap.Int64("storage reads", stats.StorageReads), zap.Int64("deduplicated", stats.Deduplicated))
+	clickStats := ss.ClickStats()
+	logger.Log.Info("click events", zap.Int64("recorded", clickStats.Recorded), zap.Int64("dropped", clickStats.Dropped))
+	if closer, ok := backend.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("failed to close storage: %s", err)
+		}
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Printf("failed to flush traces: %s", err)
+	}
 }
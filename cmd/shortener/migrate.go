@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"github.com/ujwegh/shortener/internal/app/transfer"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const migrateDataCommand = "migrate-data"
+
+// runMigrateData copies all data between storages:
+// shortener migrate-data --from file:///tmp/short-url-db.json --to postgres://...
+func runMigrateData(args []string) error {
+	flags := flag.NewFlagSet(migrateDataCommand, flag.ExitOnError)
+	from := flags.String("from", "", "source storage url: file://, postgres://, sqlite://")
+	to := flags.String("to", "", "target storage url: file://, postgres://, sqlite://")
+	dryRun := flags.Bool("dry-run", false, "count records without writing them")
+	checkpointPath := flags.String("checkpoint", "/tmp/shortener-migrate-data.checkpoint", "checkpoint file to resume an interrupted migration, empty to disable")
+	logLevel := flags.String("ll", "info", "logging level")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		flags.Usage()
+		return errors.New("both --from and --to are required")
+	}
+	logger.InitLogger(*logLevel)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	source, err := transfer.OpenStorage(*from)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(source)
+	exporter, ok := source.(storage.Exporter)
+	if !ok {
+		return fmt.Errorf("storage %s doesn't support export", *from)
+	}
+	target, err := transfer.OpenStorage(*to)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(target)
+
+	result, err := transfer.Run(ctx, exporter, target, transfer.Options{
+		DryRun:         *dryRun,
+		CheckpointPath: *checkpointPath,
+		Scope:          transfer.MigrationScope(*from, *to),
+	})
+	fmt.Fprintf(os.Stdout, "shortened urls: %d, user urls: %d, skipped: %d\n", result.ShortenedURLs, result.UserURLs, result.Skipped)
+	return err
+}
+
+func closeStorage(s storage.Storage) {
+	if closer, ok := s.(io.Closer); ok {
+		closer.Close()
+	}
+}
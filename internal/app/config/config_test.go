@@ -0,0 +1,44 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAppConfig_validate(t *testing.T) {
+	valid := AppConfig{
+		DeleteWorkers:         4,
+		DeleteQueueSize:       100,
+		DeleteChunkSize:       20,
+		DeleteBatchSize:       20,
+		DeleteFlushIntervalMs: 5000,
+		PurgeIntervalSec:      3600,
+		PurgeBatchSize:        500,
+	}
+	tests := []struct {
+		name    string
+		modify  func(c *AppConfig)
+		wantErr string
+	}{
+		{name: "valid", modify: func(c *AppConfig) {}},
+		{name: "no delete workers", modify: func(c *AppConfig) { c.DeleteWorkers = 0 }, wantErr: "-delete-workers"},
+		{name: "empty delete queue", modify: func(c *AppConfig) { c.DeleteQueueSize = 0 }, wantErr: "-delete-queue"},
+		{name: "negative chunk size", modify: func(c *AppConfig) { c.DeleteChunkSize = -1 }, wantErr: "-delete-chunk-size"},
+		{name: "empty batch", modify: func(c *AppConfig) { c.DeleteBatchSize = 0 }, wantErr: "-delete-batch-size"},
+		{name: "zero flush interval", modify: func(c *AppConfig) { c.DeleteFlushIntervalMs = 0 }, wantErr: "-delete-flush-interval"},
+		{name: "zero purge interval", modify: func(c *AppConfig) { c.PurgeIntervalSec = 0 }, wantErr: "-purge-interval"},
+		{name: "negative purge batch", modify: func(c *AppConfig) { c.PurgeBatchSize = -5 }, wantErr: "-purge-batch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			err := c.validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
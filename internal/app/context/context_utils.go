@@ -3,11 +3,15 @@ package context
 import (
 	"context"
 	"github.com/google/uuid"
+	"net/netip"
 )
 
 type key string
 
-const userUIDKey key = "userUID"
+const (
+	userUIDKey    key = "userUID"
+	clientAddrKey key = "clientAddr"
+)
 
 func WithUserUID(ctx context.Context, userUID *uuid.UUID) context.Context {
 	return context.WithValue(ctx, userUIDKey, userUID)
@@ -21,3 +25,13 @@ func UserUID(ctx context.Context) *uuid.UUID {
 	}
 	return userUID
 }
+
+// WithClientAddr stores the client address resolved behind the trusted proxies.
+func WithClientAddr(ctx context.Context, addr netip.Addr) context.Context {
+	return context.WithValue(ctx, clientAddrKey, addr)
+}
+
+func ClientAddr(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := ctx.Value(clientAddrKey).(netip.Addr)
+	return addr, ok
+}
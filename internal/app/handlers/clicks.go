@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	appContext "github.com/ujwegh/shortener/internal/app/context"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"github.com/ujwegh/shortener/internal/app/service"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+const (
+	ipv4PrefixBits = 24
+	ipv6PrefixBits = 48
+
+	defaultStatsRange = 30 * 24 * time.Hour
+)
+
+// APIGetURLStats reports the clicks of a link of the current user, the range is given by the from
+// and to query parameters and defaults to the last 30 days.
+func (sh *ShortenerHandlers) APIGetURLStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := sh.requestContext(r)
+	defer cancel()
+	userUID := appContext.UserUID(r.Context())
+	if userUID == nil {
+		http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+	shortKey := chi.URLParam(r, "id")
+	from, to, err := parseStatsRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stats, err := sh.shortenerService.GetClickStats(ctx, userUID, shortKey, from, to)
+	if err != nil && contextHasError(w, ctx) {
+		return
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Shortened url not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrNotOwner) {
+		http.Error(w, "Shortened url belongs to another user", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Unable to get URL stats", zap.Error(err))
+		http.Error(w, "Unable to get URL stats", http.StatusInternalServerError)
+		return
+	}
+	response := mapClickStatsToDto(sh, shortKey, from, to, stats)
+	rawBytes, err := response.MarshalJSON()
+	if err != nil {
+		http.Error(w, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	if contextHasError(w, ctx) {
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", rawBytes)
+}
+
+// parseStatsRange accepts RFC 3339 times or dates, a date in to includes the whole day.
+func parseStatsRange(fromParam, toParam string, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	if toParam != "" {
+		t, dateOnly, err := parseStatsTime(toParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+		if dateOnly {
+			to = t.AddDate(0, 0, 1)
+		}
+	}
+	from := to.Add(-defaultStatsRange)
+	if fromParam != "" {
+		t, _, err := parseStatsTime(fromParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+func parseStatsTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	return t, false, err
+}
+
+func newClick(r *http.Request, shortURL string) model.Click {
+	return model.Click{
+		ShortURL:  shortURL,
+		ClickedAt: time.Now(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IPPrefix:  ipPrefix(clientAddr(r)),
+	}
+}
+
+// clientAddr prefers the address resolved behind the trusted proxies over the peer address.
+func clientAddr(r *http.Request) string {
+	if addr, ok := appContext.ClientAddr(r.Context()); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// ipPrefix truncates the client address to its network, so clicks are not tied to a single host.
+func ipPrefix(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := ipv6PrefixBits
+	if addr.Is4() {
+		bits = ipv4PrefixBits
+	}
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
@@ -15,10 +15,17 @@ type (
 		shortenedURLAddr string
 		storage          storage.Storage
 		contextTimeout   time.Duration
+		tokenService     service.TokenService
+		linkAccessTTL    time.Duration
 	}
 	//easyjson:json
 	ShortenRequestDto struct {
-		URL string `json:"url"`
+		URL       string     `json:"url"`
+		Alias     string     `json:"alias,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		TTL       string     `json:"ttl,omitempty"` // Go duration, e.g. "72h"
+		MaxClicks int64      `json:"max_clicks,omitempty"`
+		Password  string     `json:"password,omitempty"`
 	}
 	//easyjson:json
 	ShortenResponseDto struct {
@@ -28,6 +35,8 @@ type (
 	ExternalShortenedURLRequestDto struct {
 		CorrelationID string `json:"correlation_id"`
 		OriginalURL   string `json:"original_url"`
+		Alias         string `json:"alias,omitempty"`
+		MaxClicks     int64  `json:"max_clicks,omitempty"`
 	}
 	//easyjson:json
 	ExternalShortenedURLResponseDto struct {
@@ -42,12 +51,70 @@ type (
 	UserURLDto struct {
 		ShortURL    string `json:"short_url"`
 		OriginalURL string `json:"original_url"`
+		IsDeleted   bool   `json:"is_deleted,omitempty"`
 	}
 	//easyjson:json
 	UserURLDtoSlice []UserURLDto
 
 	//easyjson:json
 	DeleteUserURLsDto []string
+	//easyjson:json
+	DeletionAcceptedDto struct {
+		JobID string `json:"job_id"`
+	}
+	//easyjson:json
+	DeletionJobDto struct {
+		JobID     string               `json:"job_id"`
+		Status    string               `json:"status"`
+		Error     string               `json:"error,omitempty"`
+		URLs      []DeletionOutcomeDto `json:"urls"`
+		CreatedAt time.Time            `json:"created_at"`
+		UpdatedAt time.Time            `json:"updated_at"`
+	}
+	DeletionOutcomeDto struct {
+		ShortURL string `json:"short_url"`
+		Result   string `json:"result"`
+	}
+
+	//easyjson:json
+	RestoreUserURLsDto []string
+	//easyjson:json
+	RestoreResultDto struct {
+		Restored    []string `json:"restored"`
+		NotRestored []string `json:"not_restored"`
+	}
+
+	//easyjson:json
+	ClickStatsDto struct {
+		ShortURL       string          `json:"short_url"`
+		From           time.Time       `json:"from"`
+		To             time.Time       `json:"to"`
+		TotalClicks    int64           `json:"total_clicks"`
+		UniqueVisitors int64           `json:"unique_visitors"`
+		ClicksPerDay   []ClickCountDto `json:"clicks_per_day"`
+		ClicksPerHour  []ClickCountDto `json:"clicks_per_hour"`
+		TopReferrers   []ClickCountDto `json:"top_referrers"`
+		TopUserAgents  []ClickCountDto `json:"top_user_agents"`
+	}
+	ClickCountDto struct {
+		Value  string `json:"value"`
+		Clicks int64  `json:"clicks"`
+	}
+
+	//easyjson:json
+	ServiceStatsDto struct {
+		URLs        int64 `json:"urls"`
+		Users       int64 `json:"users"`
+		DeletedURLs int64 `json:"deleted_urls"`
+		Clicks24h   int64 `json:"clicks_24h"`
+	}
+
+	//easyjson:json
+	ErrorResponseDto struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Alias   string `json:"alias,omitempty"`
+	}
 )
 
 func mapShortenedURLToExternalResponse(sh *ShortenerHandlers, slice []model.ShortenedURL) ExternalShortenedURLResponseDtoSlice {
@@ -67,6 +134,7 @@ func mapShortenedURLToUserURLDtoSlice(sh *ShortenerHandlers, slice []model.Short
 		responseItem := UserURLDto{
 			OriginalURL: item.OriginalURL,
 			ShortURL:    fmt.Sprintf("%s/%s", sh.shortenedURLAddr, item.ShortURL),
+			IsDeleted:   item.DeletedFlag,
 		}
 		responseSlice = append(responseSlice, responseItem)
 	}
@@ -82,8 +150,74 @@ func mapExternalRequestToShortenedURL(slice []ExternalShortenedURLRequestDto) *[
 				Valid:  true,
 			},
 			OriginalURL: item.OriginalURL,
+			ShortURL:    item.Alias,
+			ClicksLeft: sql.NullInt64{
+				Int64: item.MaxClicks,
+				Valid: item.MaxClicks != 0,
+			},
 		}
 		shortenedURLs = append(shortenedURLs, shortenedURL)
 	}
 	return &shortenedURLs
 }
+
+func mapClickStatsToDto(sh *ShortenerHandlers, shortURL string, from, to time.Time, stats *model.ClickStats) ClickStatsDto {
+	return ClickStatsDto{
+		ShortURL:       fmt.Sprintf("%s/%s", sh.shortenedURLAddr, shortURL),
+		From:           from.UTC(),
+		To:             to.UTC(),
+		TotalClicks:    stats.Total,
+		UniqueVisitors: stats.UniqueVisitors,
+		ClicksPerDay:   mapClickCounts(stats.PerDay),
+		ClicksPerHour:  mapClickCounts(stats.PerHour),
+		TopReferrers:   mapClickCounts(stats.TopReferrers),
+		TopUserAgents:  mapClickCounts(stats.TopUserAgents),
+	}
+}
+
+func mapClickCounts(counts []model.ClickCount) []ClickCountDto {
+	// an empty list instead of null
+	result := make([]ClickCountDto, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, ClickCountDto{Value: count.Value, Clicks: count.Clicks})
+	}
+	return result
+}
+
+// mapRestoreResultToDto keeps the order of the request, repeated keys are reported once.
+func mapRestoreResultToDto(shortURLKeys, restored []string) RestoreResultDto {
+	restoredSet := make(map[string]struct{}, len(restored))
+	for _, key := range restored {
+		restoredSet[key] = struct{}{}
+	}
+	// empty lists instead of null
+	result := RestoreResultDto{Restored: make([]string, 0, len(restored)), NotRestored: make([]string, 0)}
+	seen := make(map[string]struct{}, len(shortURLKeys))
+	for _, key := range shortURLKeys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if _, ok := restoredSet[key]; ok {
+			result.Restored = append(result.Restored, key)
+		} else {
+			result.NotRestored = append(result.NotRestored, key)
+		}
+	}
+	return result
+}
+
+func mapDeletionJobToDto(job *model.DeletionJob) DeletionJobDto {
+	urls := make([]DeletionOutcomeDto, 0, len(job.URLs))
+	for _, url := range job.URLs {
+		urls = append(urls, DeletionOutcomeDto{ShortURL: url.ShortURL, Result: url.Result})
+	}
+	return DeletionJobDto{
+		JobID:     job.ID.String(),
+		Status:    job.Status,
+		Error:     job.Error,
+		URLs:      urls,
+		CreatedAt: job.CreatedAt.UTC(),
+		UpdatedAt: job.UpdatedAt.UTC(),
+	}
+}
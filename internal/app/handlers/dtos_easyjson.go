@@ -7,6 +7,7 @@ import (
 	easyjson "github.com/mailru/easyjson"
 	jlexer "github.com/mailru/easyjson/jlexer"
 	jwriter "github.com/mailru/easyjson/jwriter"
+	time "time"
 )
 
 // suppress unused package warning
@@ -26,7 +27,7 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers(in *jlexe
 		in.Delim('[')
 		if *out == nil {
 			if !in.IsDelim(']') {
-				*out = make(UserURLDtoSlice, 0, 2)
+				*out = make(UserURLDtoSlice, 0, 1)
 			} else {
 				*out = UserURLDtoSlice{}
 			}
@@ -106,6 +107,8 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers1(in *jlex
 			out.ShortURL = string(in.String())
 		case "original_url":
 			out.OriginalURL = string(in.String())
+		case "is_deleted":
+			out.IsDeleted = bool(in.Bool())
 		default:
 			in.SkipRecursive()
 		}
@@ -130,6 +133,11 @@ func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers1(out *jwr
 		out.RawString(prefix)
 		out.String(string(in.OriginalURL))
 	}
+	if in.IsDeleted {
+		const prefix string = ",\"is_deleted\":"
+		out.RawString(prefix)
+		out.Bool(bool(in.IsDeleted))
+	}
 	out.RawByte('}')
 }
 
@@ -243,6 +251,26 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers3(in *jlex
 		switch key {
 		case "url":
 			out.URL = string(in.String())
+		case "alias":
+			out.Alias = string(in.String())
+		case "expires_at":
+			if in.IsNull() {
+				in.Skip()
+				out.ExpiresAt = nil
+			} else {
+				if out.ExpiresAt == nil {
+					out.ExpiresAt = new(time.Time)
+				}
+				if data := in.Raw(); in.Ok() {
+					in.AddError((*out.ExpiresAt).UnmarshalJSON(data))
+				}
+			}
+		case "ttl":
+			out.TTL = string(in.String())
+		case "max_clicks":
+			out.MaxClicks = int64(in.Int64())
+		case "password":
+			out.Password = string(in.String())
 		default:
 			in.SkipRecursive()
 		}
@@ -262,6 +290,31 @@ func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers3(out *jwr
 		out.RawString(prefix[1:])
 		out.String(string(in.URL))
 	}
+	if in.Alias != "" {
+		const prefix string = ",\"alias\":"
+		out.RawString(prefix)
+		out.String(string(in.Alias))
+	}
+	if in.ExpiresAt != nil {
+		const prefix string = ",\"expires_at\":"
+		out.RawString(prefix)
+		out.Raw((*in.ExpiresAt).MarshalJSON())
+	}
+	if in.TTL != "" {
+		const prefix string = ",\"ttl\":"
+		out.RawString(prefix)
+		out.String(string(in.TTL))
+	}
+	if in.MaxClicks != 0 {
+		const prefix string = ",\"max_clicks\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.MaxClicks))
+	}
+	if in.Password != "" {
+		const prefix string = ",\"password\":"
+		out.RawString(prefix)
+		out.String(string(in.Password))
+	}
 	out.RawByte('}')
 }
 
@@ -288,7 +341,94 @@ func (v *ShortenRequestDto) UnmarshalJSON(data []byte) error {
 func (v *ShortenRequestDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
 	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers3(l, v)
 }
-func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers4(in *jlexer.Lexer, out *ExternalShortenedURLResponseDtoSlice) {
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers4(in *jlexer.Lexer, out *ServiceStatsDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "urls":
+			out.URLs = int64(in.Int64())
+		case "users":
+			out.Users = int64(in.Int64())
+		case "deleted_urls":
+			out.DeletedURLs = int64(in.Int64())
+		case "clicks_24h":
+			out.Clicks24h = int64(in.Int64())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers4(out *jwriter.Writer, in ServiceStatsDto) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"urls\":"
+		out.RawString(prefix[1:])
+		out.Int64(int64(in.URLs))
+	}
+	{
+		const prefix string = ",\"users\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.Users))
+	}
+	{
+		const prefix string = ",\"deleted_urls\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.DeletedURLs))
+	}
+	{
+		const prefix string = ",\"clicks_24h\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.Clicks24h))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v ServiceStatsDto) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers4(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v ServiceStatsDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers4(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *ServiceStatsDto) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers4(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *ServiceStatsDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers4(l, v)
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers5(in *jlexer.Lexer, out *RestoreUserURLsDto) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		in.Skip()
@@ -297,16 +437,16 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers4(in *jlex
 		in.Delim('[')
 		if *out == nil {
 			if !in.IsDelim(']') {
-				*out = make(ExternalShortenedURLResponseDtoSlice, 0, 2)
+				*out = make(RestoreUserURLsDto, 0, 4)
 			} else {
-				*out = ExternalShortenedURLResponseDtoSlice{}
+				*out = RestoreUserURLsDto{}
 			}
 		} else {
 			*out = (*out)[:0]
 		}
 		for !in.IsDelim(']') {
-			var v4 ExternalShortenedURLResponseDto
-			(v4).UnmarshalEasyJSON(in)
+			var v4 string
+			v4 = string(in.String())
 			*out = append(*out, v4)
 			in.WantComma()
 		}
@@ -316,7 +456,7 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers4(in *jlex
 		in.Consumed()
 	}
 }
-func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers4(out *jwriter.Writer, in ExternalShortenedURLResponseDtoSlice) {
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers5(out *jwriter.Writer, in RestoreUserURLsDto) {
 	if in == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
 		out.RawString("null")
 	} else {
@@ -325,36 +465,36 @@ func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers4(out *jwr
 			if v5 > 0 {
 				out.RawByte(',')
 			}
-			(v6).MarshalEasyJSON(out)
+			out.String(string(v6))
 		}
 		out.RawByte(']')
 	}
 }
 
 // MarshalJSON supports json.Marshaler interface
-func (v ExternalShortenedURLResponseDtoSlice) MarshalJSON() ([]byte, error) {
+func (v RestoreUserURLsDto) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers4(&w, v)
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers5(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
-func (v ExternalShortenedURLResponseDtoSlice) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers4(w, v)
+func (v RestoreUserURLsDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers5(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
-func (v *ExternalShortenedURLResponseDtoSlice) UnmarshalJSON(data []byte) error {
+func (v *RestoreUserURLsDto) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers4(&r, v)
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers5(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
-func (v *ExternalShortenedURLResponseDtoSlice) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers4(l, v)
+func (v *RestoreUserURLsDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers5(l, v)
 }
-func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers5(in *jlexer.Lexer, out *ExternalShortenedURLResponseDto) {
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers6(in *jlexer.Lexer, out *RestoreResultDto) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -373,10 +513,52 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers5(in *jlex
 			continue
 		}
 		switch key {
-		case "correlation_id":
-			out.CorrelationID = string(in.String())
-		case "short_url":
-			out.ShortURL = string(in.String())
+		case "restored":
+			if in.IsNull() {
+				in.Skip()
+				out.Restored = nil
+			} else {
+				in.Delim('[')
+				if out.Restored == nil {
+					if !in.IsDelim(']') {
+						out.Restored = make([]string, 0, 4)
+					} else {
+						out.Restored = []string{}
+					}
+				} else {
+					out.Restored = (out.Restored)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v7 string
+					v7 = string(in.String())
+					out.Restored = append(out.Restored, v7)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		case "not_restored":
+			if in.IsNull() {
+				in.Skip()
+				out.NotRestored = nil
+			} else {
+				in.Delim('[')
+				if out.NotRestored == nil {
+					if !in.IsDelim(']') {
+						out.NotRestored = make([]string, 0, 4)
+					} else {
+						out.NotRestored = []string{}
+					}
+				} else {
+					out.NotRestored = (out.NotRestored)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v8 string
+					v8 = string(in.String())
+					out.NotRestored = append(out.NotRestored, v8)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
 		default:
 			in.SkipRecursive()
 		}
@@ -387,47 +569,69 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers5(in *jlex
 		in.Consumed()
 	}
 }
-func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers5(out *jwriter.Writer, in ExternalShortenedURLResponseDto) {
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers6(out *jwriter.Writer, in RestoreResultDto) {
 	out.RawByte('{')
 	first := true
 	_ = first
 	{
-		const prefix string = ",\"correlation_id\":"
+		const prefix string = ",\"restored\":"
 		out.RawString(prefix[1:])
-		out.String(string(in.CorrelationID))
+		if in.Restored == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v9, v10 := range in.Restored {
+				if v9 > 0 {
+					out.RawByte(',')
+				}
+				out.String(string(v10))
+			}
+			out.RawByte(']')
+		}
 	}
 	{
-		const prefix string = ",\"short_url\":"
+		const prefix string = ",\"not_restored\":"
 		out.RawString(prefix)
-		out.String(string(in.ShortURL))
+		if in.NotRestored == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v11, v12 := range in.NotRestored {
+				if v11 > 0 {
+					out.RawByte(',')
+				}
+				out.String(string(v12))
+			}
+			out.RawByte(']')
+		}
 	}
 	out.RawByte('}')
 }
 
 // MarshalJSON supports json.Marshaler interface
-func (v ExternalShortenedURLResponseDto) MarshalJSON() ([]byte, error) {
+func (v RestoreResultDto) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers5(&w, v)
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers6(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
-func (v ExternalShortenedURLResponseDto) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers5(w, v)
+func (v RestoreResultDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers6(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
-func (v *ExternalShortenedURLResponseDto) UnmarshalJSON(data []byte) error {
+func (v *RestoreResultDto) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers5(&r, v)
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers6(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
-func (v *ExternalShortenedURLResponseDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers5(l, v)
+func (v *RestoreResultDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers6(l, v)
 }
-func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers6(in *jlexer.Lexer, out *ExternalShortenedURLRequestDtoSlice) {
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers7(in *jlexer.Lexer, out *ExternalShortenedURLResponseDtoSlice) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		in.Skip()
@@ -436,17 +640,17 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers6(in *jlex
 		in.Delim('[')
 		if *out == nil {
 			if !in.IsDelim(']') {
-				*out = make(ExternalShortenedURLRequestDtoSlice, 0, 2)
+				*out = make(ExternalShortenedURLResponseDtoSlice, 0, 2)
 			} else {
-				*out = ExternalShortenedURLRequestDtoSlice{}
+				*out = ExternalShortenedURLResponseDtoSlice{}
 			}
 		} else {
 			*out = (*out)[:0]
 		}
 		for !in.IsDelim(']') {
-			var v7 ExternalShortenedURLRequestDto
-			(v7).UnmarshalEasyJSON(in)
-			*out = append(*out, v7)
+			var v13 ExternalShortenedURLResponseDto
+			(v13).UnmarshalEasyJSON(in)
+			*out = append(*out, v13)
 			in.WantComma()
 		}
 		in.Delim(']')
@@ -455,45 +659,45 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers6(in *jlex
 		in.Consumed()
 	}
 }
-func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers6(out *jwriter.Writer, in ExternalShortenedURLRequestDtoSlice) {
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers7(out *jwriter.Writer, in ExternalShortenedURLResponseDtoSlice) {
 	if in == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
 		out.RawString("null")
 	} else {
 		out.RawByte('[')
-		for v8, v9 := range in {
-			if v8 > 0 {
+		for v14, v15 := range in {
+			if v14 > 0 {
 				out.RawByte(',')
 			}
-			(v9).MarshalEasyJSON(out)
+			(v15).MarshalEasyJSON(out)
 		}
 		out.RawByte(']')
 	}
 }
 
 // MarshalJSON supports json.Marshaler interface
-func (v ExternalShortenedURLRequestDtoSlice) MarshalJSON() ([]byte, error) {
+func (v ExternalShortenedURLResponseDtoSlice) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers6(&w, v)
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers7(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
-func (v ExternalShortenedURLRequestDtoSlice) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers6(w, v)
+func (v ExternalShortenedURLResponseDtoSlice) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers7(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
-func (v *ExternalShortenedURLRequestDtoSlice) UnmarshalJSON(data []byte) error {
+func (v *ExternalShortenedURLResponseDtoSlice) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers6(&r, v)
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers7(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
-func (v *ExternalShortenedURLRequestDtoSlice) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers6(l, v)
+func (v *ExternalShortenedURLResponseDtoSlice) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers7(l, v)
 }
-func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers7(in *jlexer.Lexer, out *ExternalShortenedURLRequestDto) {
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers8(in *jlexer.Lexer, out *ExternalShortenedURLResponseDto) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		if isTopLevel {
@@ -514,8 +718,8 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers7(in *jlex
 		switch key {
 		case "correlation_id":
 			out.CorrelationID = string(in.String())
-		case "original_url":
-			out.OriginalURL = string(in.String())
+		case "short_url":
+			out.ShortURL = string(in.String())
 		default:
 			in.SkipRecursive()
 		}
@@ -526,7 +730,7 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers7(in *jlex
 		in.Consumed()
 	}
 }
-func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers7(out *jwriter.Writer, in ExternalShortenedURLRequestDto) {
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers8(out *jwriter.Writer, in ExternalShortenedURLResponseDto) {
 	out.RawByte('{')
 	first := true
 	_ = first
@@ -536,37 +740,37 @@ func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers7(out *jwr
 		out.String(string(in.CorrelationID))
 	}
 	{
-		const prefix string = ",\"original_url\":"
+		const prefix string = ",\"short_url\":"
 		out.RawString(prefix)
-		out.String(string(in.OriginalURL))
+		out.String(string(in.ShortURL))
 	}
 	out.RawByte('}')
 }
 
 // MarshalJSON supports json.Marshaler interface
-func (v ExternalShortenedURLRequestDto) MarshalJSON() ([]byte, error) {
+func (v ExternalShortenedURLResponseDto) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers7(&w, v)
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers8(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
-func (v ExternalShortenedURLRequestDto) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers7(w, v)
+func (v ExternalShortenedURLResponseDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers8(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
-func (v *ExternalShortenedURLRequestDto) UnmarshalJSON(data []byte) error {
+func (v *ExternalShortenedURLResponseDto) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers7(&r, v)
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers8(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
-func (v *ExternalShortenedURLRequestDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers7(l, v)
+func (v *ExternalShortenedURLResponseDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers8(l, v)
 }
-func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers8(in *jlexer.Lexer, out *DeleteUserURLsDto) {
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers9(in *jlexer.Lexer, out *ExternalShortenedURLRequestDtoSlice) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
 		in.Skip()
@@ -575,17 +779,17 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers8(in *jlex
 		in.Delim('[')
 		if *out == nil {
 			if !in.IsDelim(']') {
-				*out = make(DeleteUserURLsDto, 0, 4)
+				*out = make(ExternalShortenedURLRequestDtoSlice, 0, 1)
 			} else {
-				*out = DeleteUserURLsDto{}
+				*out = ExternalShortenedURLRequestDtoSlice{}
 			}
 		} else {
 			*out = (*out)[:0]
 		}
 		for !in.IsDelim(']') {
-			var v10 string
-			v10 = string(in.String())
-			*out = append(*out, v10)
+			var v16 ExternalShortenedURLRequestDto
+			(v16).UnmarshalEasyJSON(in)
+			*out = append(*out, v16)
 			in.WantComma()
 		}
 		in.Delim(']')
@@ -594,41 +798,829 @@ func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers8(in *jlex
 		in.Consumed()
 	}
 }
-func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers8(out *jwriter.Writer, in DeleteUserURLsDto) {
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers9(out *jwriter.Writer, in ExternalShortenedURLRequestDtoSlice) {
 	if in == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
 		out.RawString("null")
 	} else {
 		out.RawByte('[')
-		for v11, v12 := range in {
-			if v11 > 0 {
+		for v17, v18 := range in {
+			if v17 > 0 {
 				out.RawByte(',')
 			}
-			out.String(string(v12))
+			(v18).MarshalEasyJSON(out)
 		}
 		out.RawByte(']')
 	}
 }
 
 // MarshalJSON supports json.Marshaler interface
-func (v DeleteUserURLsDto) MarshalJSON() ([]byte, error) {
+func (v ExternalShortenedURLRequestDtoSlice) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers8(&w, v)
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers9(&w, v)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
 // MarshalEasyJSON supports easyjson.Marshaler interface
-func (v DeleteUserURLsDto) MarshalEasyJSON(w *jwriter.Writer) {
-	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers8(w, v)
+func (v ExternalShortenedURLRequestDtoSlice) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers9(w, v)
 }
 
 // UnmarshalJSON supports json.Unmarshaler interface
-func (v *DeleteUserURLsDto) UnmarshalJSON(data []byte) error {
+func (v *ExternalShortenedURLRequestDtoSlice) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers8(&r, v)
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers9(&r, v)
 	return r.Error()
 }
 
 // UnmarshalEasyJSON supports easyjson.Unmarshaler interface
-func (v *DeleteUserURLsDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
-	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers8(l, v)
+func (v *ExternalShortenedURLRequestDtoSlice) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers9(l, v)
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers10(in *jlexer.Lexer, out *ExternalShortenedURLRequestDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "correlation_id":
+			out.CorrelationID = string(in.String())
+		case "original_url":
+			out.OriginalURL = string(in.String())
+		case "alias":
+			out.Alias = string(in.String())
+		case "max_clicks":
+			out.MaxClicks = int64(in.Int64())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers10(out *jwriter.Writer, in ExternalShortenedURLRequestDto) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"correlation_id\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.CorrelationID))
+	}
+	{
+		const prefix string = ",\"original_url\":"
+		out.RawString(prefix)
+		out.String(string(in.OriginalURL))
+	}
+	if in.Alias != "" {
+		const prefix string = ",\"alias\":"
+		out.RawString(prefix)
+		out.String(string(in.Alias))
+	}
+	if in.MaxClicks != 0 {
+		const prefix string = ",\"max_clicks\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.MaxClicks))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v ExternalShortenedURLRequestDto) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers10(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v ExternalShortenedURLRequestDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers10(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *ExternalShortenedURLRequestDto) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers10(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *ExternalShortenedURLRequestDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers10(l, v)
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers11(in *jlexer.Lexer, out *ErrorResponseDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "code":
+			out.Code = string(in.String())
+		case "message":
+			out.Message = string(in.String())
+		case "alias":
+			out.Alias = string(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers11(out *jwriter.Writer, in ErrorResponseDto) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"code\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.Code))
+	}
+	{
+		const prefix string = ",\"message\":"
+		out.RawString(prefix)
+		out.String(string(in.Message))
+	}
+	if in.Alias != "" {
+		const prefix string = ",\"alias\":"
+		out.RawString(prefix)
+		out.String(string(in.Alias))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v ErrorResponseDto) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers11(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v ErrorResponseDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers11(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *ErrorResponseDto) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers11(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *ErrorResponseDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers11(l, v)
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers12(in *jlexer.Lexer, out *DeletionJobDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "job_id":
+			out.JobID = string(in.String())
+		case "status":
+			out.Status = string(in.String())
+		case "error":
+			out.Error = string(in.String())
+		case "urls":
+			if in.IsNull() {
+				in.Skip()
+				out.URLs = nil
+			} else {
+				in.Delim('[')
+				if out.URLs == nil {
+					if !in.IsDelim(']') {
+						out.URLs = make([]DeletionOutcomeDto, 0, 2)
+					} else {
+						out.URLs = []DeletionOutcomeDto{}
+					}
+				} else {
+					out.URLs = (out.URLs)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v19 DeletionOutcomeDto
+					easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers13(in, &v19)
+					out.URLs = append(out.URLs, v19)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		case "created_at":
+			if data := in.Raw(); in.Ok() {
+				in.AddError((out.CreatedAt).UnmarshalJSON(data))
+			}
+		case "updated_at":
+			if data := in.Raw(); in.Ok() {
+				in.AddError((out.UpdatedAt).UnmarshalJSON(data))
+			}
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers12(out *jwriter.Writer, in DeletionJobDto) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"job_id\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.JobID))
+	}
+	{
+		const prefix string = ",\"status\":"
+		out.RawString(prefix)
+		out.String(string(in.Status))
+	}
+	if in.Error != "" {
+		const prefix string = ",\"error\":"
+		out.RawString(prefix)
+		out.String(string(in.Error))
+	}
+	{
+		const prefix string = ",\"urls\":"
+		out.RawString(prefix)
+		if in.URLs == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v20, v21 := range in.URLs {
+				if v20 > 0 {
+					out.RawByte(',')
+				}
+				easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers13(out, v21)
+			}
+			out.RawByte(']')
+		}
+	}
+	{
+		const prefix string = ",\"created_at\":"
+		out.RawString(prefix)
+		out.Raw((in.CreatedAt).MarshalJSON())
+	}
+	{
+		const prefix string = ",\"updated_at\":"
+		out.RawString(prefix)
+		out.Raw((in.UpdatedAt).MarshalJSON())
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v DeletionJobDto) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers12(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v DeletionJobDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers12(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *DeletionJobDto) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers12(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *DeletionJobDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers12(l, v)
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers13(in *jlexer.Lexer, out *DeletionOutcomeDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "short_url":
+			out.ShortURL = string(in.String())
+		case "result":
+			out.Result = string(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers13(out *jwriter.Writer, in DeletionOutcomeDto) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"short_url\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.ShortURL))
+	}
+	{
+		const prefix string = ",\"result\":"
+		out.RawString(prefix)
+		out.String(string(in.Result))
+	}
+	out.RawByte('}')
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers14(in *jlexer.Lexer, out *DeletionAcceptedDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "job_id":
+			out.JobID = string(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers14(out *jwriter.Writer, in DeletionAcceptedDto) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"job_id\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.JobID))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v DeletionAcceptedDto) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers14(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v DeletionAcceptedDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers14(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *DeletionAcceptedDto) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers14(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *DeletionAcceptedDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers14(l, v)
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers15(in *jlexer.Lexer, out *DeleteUserURLsDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		in.Skip()
+		*out = nil
+	} else {
+		in.Delim('[')
+		if *out == nil {
+			if !in.IsDelim(']') {
+				*out = make(DeleteUserURLsDto, 0, 4)
+			} else {
+				*out = DeleteUserURLsDto{}
+			}
+		} else {
+			*out = (*out)[:0]
+		}
+		for !in.IsDelim(']') {
+			var v22 string
+			v22 = string(in.String())
+			*out = append(*out, v22)
+			in.WantComma()
+		}
+		in.Delim(']')
+	}
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers15(out *jwriter.Writer, in DeleteUserURLsDto) {
+	if in == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+		out.RawString("null")
+	} else {
+		out.RawByte('[')
+		for v23, v24 := range in {
+			if v23 > 0 {
+				out.RawByte(',')
+			}
+			out.String(string(v24))
+		}
+		out.RawByte(']')
+	}
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v DeleteUserURLsDto) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers15(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v DeleteUserURLsDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers15(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *DeleteUserURLsDto) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers15(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *DeleteUserURLsDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers15(l, v)
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers16(in *jlexer.Lexer, out *ClickStatsDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "short_url":
+			out.ShortURL = string(in.String())
+		case "from":
+			if data := in.Raw(); in.Ok() {
+				in.AddError((out.From).UnmarshalJSON(data))
+			}
+		case "to":
+			if data := in.Raw(); in.Ok() {
+				in.AddError((out.To).UnmarshalJSON(data))
+			}
+		case "total_clicks":
+			out.TotalClicks = int64(in.Int64())
+		case "unique_visitors":
+			out.UniqueVisitors = int64(in.Int64())
+		case "clicks_per_day":
+			if in.IsNull() {
+				in.Skip()
+				out.ClicksPerDay = nil
+			} else {
+				in.Delim('[')
+				if out.ClicksPerDay == nil {
+					if !in.IsDelim(']') {
+						out.ClicksPerDay = make([]ClickCountDto, 0, 2)
+					} else {
+						out.ClicksPerDay = []ClickCountDto{}
+					}
+				} else {
+					out.ClicksPerDay = (out.ClicksPerDay)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v25 ClickCountDto
+					easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers17(in, &v25)
+					out.ClicksPerDay = append(out.ClicksPerDay, v25)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		case "clicks_per_hour":
+			if in.IsNull() {
+				in.Skip()
+				out.ClicksPerHour = nil
+			} else {
+				in.Delim('[')
+				if out.ClicksPerHour == nil {
+					if !in.IsDelim(']') {
+						out.ClicksPerHour = make([]ClickCountDto, 0, 2)
+					} else {
+						out.ClicksPerHour = []ClickCountDto{}
+					}
+				} else {
+					out.ClicksPerHour = (out.ClicksPerHour)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v26 ClickCountDto
+					easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers17(in, &v26)
+					out.ClicksPerHour = append(out.ClicksPerHour, v26)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		case "top_referrers":
+			if in.IsNull() {
+				in.Skip()
+				out.TopReferrers = nil
+			} else {
+				in.Delim('[')
+				if out.TopReferrers == nil {
+					if !in.IsDelim(']') {
+						out.TopReferrers = make([]ClickCountDto, 0, 2)
+					} else {
+						out.TopReferrers = []ClickCountDto{}
+					}
+				} else {
+					out.TopReferrers = (out.TopReferrers)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v27 ClickCountDto
+					easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers17(in, &v27)
+					out.TopReferrers = append(out.TopReferrers, v27)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		case "top_user_agents":
+			if in.IsNull() {
+				in.Skip()
+				out.TopUserAgents = nil
+			} else {
+				in.Delim('[')
+				if out.TopUserAgents == nil {
+					if !in.IsDelim(']') {
+						out.TopUserAgents = make([]ClickCountDto, 0, 2)
+					} else {
+						out.TopUserAgents = []ClickCountDto{}
+					}
+				} else {
+					out.TopUserAgents = (out.TopUserAgents)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v28 ClickCountDto
+					easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers17(in, &v28)
+					out.TopUserAgents = append(out.TopUserAgents, v28)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers16(out *jwriter.Writer, in ClickStatsDto) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"short_url\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.ShortURL))
+	}
+	{
+		const prefix string = ",\"from\":"
+		out.RawString(prefix)
+		out.Raw((in.From).MarshalJSON())
+	}
+	{
+		const prefix string = ",\"to\":"
+		out.RawString(prefix)
+		out.Raw((in.To).MarshalJSON())
+	}
+	{
+		const prefix string = ",\"total_clicks\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.TotalClicks))
+	}
+	{
+		const prefix string = ",\"unique_visitors\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.UniqueVisitors))
+	}
+	{
+		const prefix string = ",\"clicks_per_day\":"
+		out.RawString(prefix)
+		if in.ClicksPerDay == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v29, v30 := range in.ClicksPerDay {
+				if v29 > 0 {
+					out.RawByte(',')
+				}
+				easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers17(out, v30)
+			}
+			out.RawByte(']')
+		}
+	}
+	{
+		const prefix string = ",\"clicks_per_hour\":"
+		out.RawString(prefix)
+		if in.ClicksPerHour == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v31, v32 := range in.ClicksPerHour {
+				if v31 > 0 {
+					out.RawByte(',')
+				}
+				easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers17(out, v32)
+			}
+			out.RawByte(']')
+		}
+	}
+	{
+		const prefix string = ",\"top_referrers\":"
+		out.RawString(prefix)
+		if in.TopReferrers == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v33, v34 := range in.TopReferrers {
+				if v33 > 0 {
+					out.RawByte(',')
+				}
+				easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers17(out, v34)
+			}
+			out.RawByte(']')
+		}
+	}
+	{
+		const prefix string = ",\"top_user_agents\":"
+		out.RawString(prefix)
+		if in.TopUserAgents == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v35, v36 := range in.TopUserAgents {
+				if v35 > 0 {
+					out.RawByte(',')
+				}
+				easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers17(out, v36)
+			}
+			out.RawByte(']')
+		}
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v ClickStatsDto) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers16(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v ClickStatsDto) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers16(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *ClickStatsDto) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers16(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *ClickStatsDto) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers16(l, v)
+}
+func easyjson782a897aDecodeGithubComUjweghShortenerInternalAppHandlers17(in *jlexer.Lexer, out *ClickCountDto) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "value":
+			out.Value = string(in.String())
+		case "clicks":
+			out.Clicks = int64(in.Int64())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson782a897aEncodeGithubComUjweghShortenerInternalAppHandlers17(out *jwriter.Writer, in ClickCountDto) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"value\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.Value))
+	}
+	{
+		const prefix string = ",\"clicks\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.Clicks))
+	}
+	out.RawByte('}')
 }
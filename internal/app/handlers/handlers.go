@@ -5,32 +5,46 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	appContext "github.com/ujwegh/shortener/internal/app/context"
 	appErrors "github.com/ujwegh/shortener/internal/app/errors"
 	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/metrics"
 	"github.com/ujwegh/shortener/internal/app/model"
 	"github.com/ujwegh/shortener/internal/app/service"
 	"github.com/ujwegh/shortener/internal/app/storage"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 const errMsgCreateShortURL = "Unable to create shortened URL"
 const errMsgEnableReadBody = "Unable to read body"
 
-func NewShortenerHandlers(shortenedURLAddr string, contextTimeout int, service service.ShortenerService, storage storage.Storage) *ShortenerHandlers {
+func NewShortenerHandlers(shortenedURLAddr string, contextTimeout int, service service.ShortenerService, storage storage.Storage,
+	tokenService service.TokenService, linkAccessTTL int) *ShortenerHandlers {
 	return &ShortenerHandlers{
 		shortenerService: service,
 		storage:          storage,
 		shortenedURLAddr: shortenedURLAddr,
 		contextTimeout:   time.Duration(contextTimeout) * time.Second,
+		tokenService:     tokenService,
+		linkAccessTTL:    time.Duration(linkAccessTTL) * time.Second,
 	}
 }
 
+// requestContext bounds the storage work of a request. It is not canceled with the request,
+// but keeps the request span so the service and storage spans join the trace.
+func (sh *ShortenerHandlers) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(r.Context()))
+	return context.WithTimeout(ctx, sh.contextTimeout)
+}
+
 func (sh *ShortenerHandlers) ShortenURL(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), sh.contextTimeout)
+	ctx, cancel := sh.requestContext(r)
 	defer cancel()
 
 	userUID := appContext.UserUID(r.Context())
@@ -50,7 +64,20 @@ func (sh *ShortenerHandlers) ShortenURL(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
-	shortenedURL, err := sh.shortenerService.CreateShortenedURL(ctx, userUID, originalURL)
+	opts := service.ShortenOptions{Alias: r.URL.Query().Get("alias")}
+	if maxClicks := r.URL.Query().Get("max_clicks"); maxClicks != "" {
+		opts.MaxClicks, err = strconv.ParseInt(maxClicks, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid max_clicks", http.StatusBadRequest)
+			return
+		}
+	}
+	opts.ExpiresAt, err = parseExpiration(r.URL.Query().Get("expires_at"), r.URL.Query().Get("ttl"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shortenedURL, err := sh.shortenerService.CreateShortenedURL(ctx, userUID, originalURL, opts)
 	shortenedURL, hasError := sh.checkCreateShortenedURLError(ctx, w, err, shortenedURL, originalURL)
 	if hasError {
 		return
@@ -64,7 +91,7 @@ func (sh *ShortenerHandlers) ShortenURL(w http.ResponseWriter, r *http.Request)
 }
 
 func (sh *ShortenerHandlers) APIShortenURL(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), sh.contextTimeout)
+	ctx, cancel := sh.requestContext(r)
 	defer cancel()
 
 	userUID := appContext.UserUID(r.Context())
@@ -90,7 +117,17 @@ func (sh *ShortenerHandlers) APIShortenURL(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	w.Header().Add("Content-Type", "application/json")
-	shortenedURL, err := sh.shortenerService.CreateShortenedURL(ctx, userUID, originalURL)
+	opts := service.ShortenOptions{Alias: request.Alias, MaxClicks: request.MaxClicks, Password: request.Password}
+	var expiresAt string
+	if request.ExpiresAt != nil {
+		expiresAt = request.ExpiresAt.Format(time.RFC3339Nano)
+	}
+	opts.ExpiresAt, err = parseExpiration(expiresAt, request.TTL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shortenedURL, err := sh.shortenerService.CreateShortenedURL(ctx, userUID, originalURL, opts)
 	shortenedURL, hasError := sh.checkCreateShortenedURLError(ctx, w, err, shortenedURL, originalURL)
 	if hasError {
 		return
@@ -110,6 +147,14 @@ func (sh *ShortenerHandlers) APIShortenURL(w http.ResponseWriter, r *http.Reques
 }
 
 func (sh *ShortenerHandlers) checkCreateShortenedURLError(ctx context.Context, w http.ResponseWriter, err error, shortenedURL *model.ShortenedURL, originalURL string) (*model.ShortenedURL, bool) {
+	if writeAliasError(w, err) {
+		return nil, true
+	}
+	if errors.Is(err, service.ErrInvalidExpiration) || errors.Is(err, service.ErrInvalidMaxClicks) ||
+		errors.Is(err, service.ErrInvalidPassword) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, true
+	}
 	shortenerError := appErrors.ShortenerError{}
 	if err != nil && errors.As(err, &shortenerError) && shortenerError.Msg() == "unique violation" {
 		shortenedURL, err = sh.shortenerService.GetShortenedURL(ctx, originalURL)
@@ -119,6 +164,10 @@ func (sh *ShortenerHandlers) checkCreateShortenedURLError(ctx context.Context, w
 			return nil, true
 		}
 		w.WriteHeader(http.StatusConflict)
+	} else if errors.Is(err, service.ErrKeySpaceExhausted) {
+		logger.Log.Error(errMsgCreateShortURL, zap.Error(err))
+		http.Error(w, "No free short keys left, try again later", http.StatusServiceUnavailable)
+		return nil, true
 	} else if err != nil {
 		logger.Log.Error(errMsgCreateShortURL, zap.Error(err))
 		http.Error(w, errMsgCreateShortURL, http.StatusInternalServerError)
@@ -128,34 +177,58 @@ func (sh *ShortenerHandlers) checkCreateShortenedURLError(ctx context.Context, w
 }
 
 func (sh *ShortenerHandlers) HandleShortenedURL(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), sh.contextTimeout)
+	ctx, cancel := sh.requestContext(r)
 	defer cancel()
 	shortKey := chi.URLParam(r, "id")
 	shortenedURL, err := sh.shortenerService.GetShortenedURL(ctx, shortKey)
-	if err != nil {
+	if err != nil && contextHasError(w, ctx) {
+		return
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
 		http.Error(w, "Unable to get shortened URL", http.StatusInternalServerError)
 		return
 	}
-	originalURL := shortenedURL.OriginalURL
-	if originalURL == "" {
+	if err != nil || shortenedURL.OriginalURL == "" {
+		metrics.Redirects.WithLabelValues(metrics.RedirectMiss).Inc()
 		http.Error(w, "Shortened url not found", http.StatusNotFound)
 		return
 	}
+	originalURL := shortenedURL.OriginalURL
 
-	if shortenedURL.DeletedFlag {
+	if shortenedURL.DeletedFlag || shortenedURL.Expired(time.Now()) {
+		metrics.Redirects.WithLabelValues(metrics.RedirectGone).Inc()
 		w.WriteHeader(http.StatusGone)
 		return
 	}
+	if shortenedURL.PasswordHash.Valid && !sh.hasLinkAccess(r, shortenedURL.ShortURL) {
+		metrics.Redirects.WithLabelValues(metrics.RedirectLocked).Inc()
+		writeUnlockForm(w, http.StatusOK, shortenedURL.ShortURL, "")
+		return
+	}
+	if shortenedURL.ClicksLeft.Valid {
+		allowed, err := sh.shortenerService.ConsumeClick(ctx, shortenedURL.ShortURL)
+		if err != nil {
+			http.Error(w, "Unable to get shortened URL", http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			metrics.Redirects.WithLabelValues(metrics.RedirectGone).Inc()
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+	}
 
 	if contextHasError(w, ctx) {
 		return
 	}
+	metrics.Redirects.WithLabelValues(metrics.RedirectHit).Inc()
+	sh.shortenerService.RecordClick(newClick(r, shortenedURL.ShortURL))
 	w.Header().Add("Location", originalURL)
 	http.Redirect(w, r, originalURL, http.StatusTemporaryRedirect)
 }
 
 func (sh *ShortenerHandlers) Ping(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), sh.contextTimeout)
+	ctx, cancel := sh.requestContext(r)
 	defer cancel()
 	err := sh.storage.Ping(ctx)
 	if err != nil {
@@ -170,7 +243,7 @@ func (sh *ShortenerHandlers) Ping(w http.ResponseWriter, r *http.Request) {
 }
 
 func (sh *ShortenerHandlers) APIShortenURLBatch(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), sh.contextTimeout)
+	ctx, cancel := sh.requestContext(r)
 	defer cancel()
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -190,6 +263,18 @@ func (sh *ShortenerHandlers) APIShortenURLBatch(w http.ResponseWriter, r *http.R
 	}
 	urls := mapExternalRequestToShortenedURL(dtos)
 	shortenedURLs, err := sh.shortenerService.BatchCreateShortenedURLs(ctx, *urls)
+	if writeAliasError(w, err) {
+		return
+	}
+	if errors.Is(err, service.ErrInvalidMaxClicks) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrKeySpaceExhausted) {
+		logger.Log.Error("Unable to batch insert shortened URLs", zap.Error(err))
+		http.Error(w, "No free short keys left, try again later", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Unable to batch insert shortened URLs", http.StatusInternalServerError)
 		return
@@ -209,14 +294,23 @@ func (sh *ShortenerHandlers) APIShortenURLBatch(w http.ResponseWriter, r *http.R
 }
 
 func (sh *ShortenerHandlers) APIGetUserURLs(writer http.ResponseWriter, request *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), sh.contextTimeout)
+	ctx, cancel := sh.requestContext(request)
 	defer cancel()
 	userUID := appContext.UserUID(request.Context())
 	if userUID == nil {
 		http.Error(writer, "User is not authenticated", http.StatusUnauthorized)
 		return
 	}
-	shortenedURLs, err := sh.shortenerService.GetUserShortenedURLs(ctx, userUID)
+	includeDeleted := false
+	if param := request.URL.Query().Get("include_deleted"); param != "" {
+		value, err := strconv.ParseBool(param)
+		if err != nil {
+			http.Error(writer, "Invalid include_deleted", http.StatusBadRequest)
+			return
+		}
+		includeDeleted = value
+	}
+	shortenedURLs, err := sh.shortenerService.GetUserShortenedURLs(ctx, userUID, includeDeleted)
 	if err != nil {
 		http.Error(writer, "Unable to get user URLs", http.StatusInternalServerError)
 		return
@@ -240,7 +334,7 @@ func (sh *ShortenerHandlers) APIGetUserURLs(writer http.ResponseWriter, request
 }
 
 func (sh *ShortenerHandlers) APIDeleteUserURLs(writer http.ResponseWriter, request *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), sh.contextTimeout)
+	ctx, cancel := sh.requestContext(request)
 	defer cancel()
 	userUID := appContext.UserUID(request.Context())
 	if userUID == nil {
@@ -266,15 +360,148 @@ func (sh *ShortenerHandlers) APIDeleteUserURLs(writer http.ResponseWriter, reque
 		return
 	}
 
-	err = sh.shortenerService.DeleteUserShortenedURLs(ctx, userUID, shortURLKeys)
+	jobID, err := sh.shortenerService.DeleteUserShortenedURLs(ctx, userUID, shortURLKeys)
 	if contextHasError(writer, ctx) {
 		return
 	}
+	queueFullErr := &service.QueueFullError{}
+	if errors.As(err, &queueFullErr) {
+		writer.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(queueFullErr.RetryAfter)))
+		http.Error(writer, "Deletion queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	batchTooLargeErr := &service.BatchTooLargeError{}
+	if errors.As(err, &batchTooLargeErr) {
+		http.Error(writer, fmt.Sprintf("Batch is too large, at most %d keys", batchTooLargeErr.MaxKeys),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
+		logger.Log.Error("Unable to delete user URLs", zap.Error(err))
 		http.Error(writer, "Unable to delete user URLs", http.StatusInternalServerError)
 		return
 	}
+	response := DeletionAcceptedDto{JobID: jobID.String()}
+	rawBytes, err := response.MarshalJSON()
+	if err != nil {
+		http.Error(writer, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Add("Content-Type", "application/json")
+	writer.Header().Set("Location", "/api/user/urls/deletions/"+jobID.String())
 	writer.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(writer, "%s", rawBytes)
+}
+
+// APIGetDeletionJob reports the state of a delete request of the current user.
+func (sh *ShortenerHandlers) APIGetDeletionJob(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := sh.requestContext(r)
+	defer cancel()
+	userUID := appContext.UserUID(r.Context())
+	if userUID == nil {
+		http.Error(w, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+	jobID, err := uuid.Parse(chi.URLParam(r, "jobID"))
+	if err != nil {
+		http.Error(w, "Invalid job id", http.StatusBadRequest)
+		return
+	}
+	job, err := sh.shortenerService.GetDeletionJob(ctx, userUID, jobID)
+	if err != nil && contextHasError(w, ctx) {
+		return
+	}
+	if errors.Is(err, service.ErrJobNotFound) {
+		http.Error(w, "Deletion job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Unable to get deletion job", zap.Error(err))
+		http.Error(w, "Unable to get deletion job", http.StatusInternalServerError)
+		return
+	}
+	response := mapDeletionJobToDto(job)
+	rawBytes, err := response.MarshalJSON()
+	if err != nil {
+		http.Error(w, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", rawBytes)
+}
+
+func (sh *ShortenerHandlers) APIInternalStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := sh.requestContext(r)
+	defer cancel()
+	stats, err := sh.shortenerService.GetServiceStats(ctx)
+	if err != nil && contextHasError(w, ctx) {
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Unable to get service stats", zap.Error(err))
+		http.Error(w, "Unable to get service stats", http.StatusInternalServerError)
+		return
+	}
+	response := ServiceStatsDto{
+		URLs:        stats.URLs,
+		Users:       stats.Users,
+		DeletedURLs: stats.DeletedURLs,
+		Clicks24h:   stats.RecentClicks,
+	}
+	rawBytes, err := response.MarshalJSON()
+	if err != nil {
+		http.Error(w, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s", rawBytes)
+}
+
+// parseExpiration accepts either an RFC 3339 time or a ttl duration like "72h".
+func parseExpiration(expiresAt, ttl string) (time.Time, error) {
+	switch {
+	case expiresAt != "" && ttl != "":
+		return time.Time{}, errors.New("expires_at and ttl are mutually exclusive")
+	case expiresAt != "":
+		t, err := time.Parse(time.RFC3339Nano, expiresAt)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expires_at: %w", err)
+		}
+		return t, nil
+	case ttl != "":
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid ttl %q", ttl)
+		}
+		return time.Now().Add(d), nil
+	}
+	return time.Time{}, nil
+}
+
+// writeAliasError responds with a structured error when a custom alias was rejected.
+func writeAliasError(w http.ResponseWriter, err error) bool {
+	aliasErr := &service.AliasError{}
+	if err == nil || !errors.As(err, &aliasErr) {
+		return false
+	}
+	response := ErrorResponseDto{Message: aliasErr.Error(), Alias: aliasErr.Alias}
+	code := http.StatusBadRequest
+	response.Code = "invalid_alias"
+	if errors.Is(err, service.ErrAliasTaken) {
+		code = http.StatusConflict
+		response.Code = "alias_taken"
+	}
+	rawBytes, err := response.MarshalJSON()
+	if err != nil {
+		http.Error(w, "Unable to marshal response", http.StatusInternalServerError)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "%s", rawBytes)
+	return true
 }
 
 func contextHasError(w http.ResponseWriter, ctx context.Context) bool {
@@ -296,3 +523,59 @@ func contextHasError(w http.ResponseWriter, ctx context.Context) bool {
 	}
 	return false
 }
+
+// APIRestoreUserURLs undeletes soft-deleted links of the current user, purged links and links
+// of other users are reported as not restored.
+func (sh *ShortenerHandlers) APIRestoreUserURLs(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := sh.requestContext(request)
+	defer cancel()
+	userUID := appContext.UserUID(request.Context())
+	if userUID == nil {
+		http.Error(writer, "User is not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		http.Error(writer, errMsgEnableReadBody, http.StatusBadRequest)
+		return
+	}
+	requestBody := RestoreUserURLsDto{}
+	if err := requestBody.UnmarshalJSON(body); err != nil {
+		http.Error(writer, "Unable to parse body", http.StatusBadRequest)
+		return
+	}
+	var shortURLKeys []string = requestBody
+	if len(shortURLKeys) == 0 {
+		http.Error(writer, "Batch is empty", http.StatusBadRequest)
+		return
+	}
+
+	restored, err := sh.shortenerService.RestoreUserShortenedURLs(ctx, userUID, shortURLKeys)
+	if contextHasError(writer, ctx) {
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Unable to restore user URLs", zap.Error(err))
+		http.Error(writer, "Unable to restore user URLs", http.StatusInternalServerError)
+		return
+	}
+	response := mapRestoreResultToDto(shortURLKeys, restored)
+	rawBytes, err := response.MarshalJSON()
+	if err != nil {
+		http.Error(writer, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Add("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	fmt.Fprintf(writer, "%s", rawBytes)
+}
+
+// retryAfterSeconds rounds up to whole seconds, a Retry-After of 0 would invite an immediate retry.
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
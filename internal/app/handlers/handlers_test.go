@@ -8,6 +8,7 @@ import (
 	"github.com/mailru/easyjson"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
 	appContext "github.com/ujwegh/shortener/internal/app/context"
 	"github.com/ujwegh/shortener/internal/app/model"
 	"github.com/ujwegh/shortener/internal/app/service"
@@ -15,7 +16,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -25,10 +29,39 @@ type MockStorage struct {
 	userURLs []model.ShortenedURL
 }
 
+func (fss *MockStorage) ConsumeClick(ctx context.Context, shortURL string) (bool, error) {
+	return true, nil
+}
+
+func (fss *MockStorage) WriteClicks(ctx context.Context, clicks []model.Click) error {
+	return nil
+}
+
+func (fss *MockStorage) ReadClickStats(ctx context.Context, shortURL string, from, to time.Time, top int) (*model.ClickStats, error) {
+	return &model.ClickStats{}, nil
+}
+
+func (fss *MockStorage) ReadServiceStats(ctx context.Context, clicksSince time.Time) (*model.ServiceStats, error) {
+	return &model.ServiceStats{}, nil
+}
+
+func (fss *MockStorage) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+func (fss *MockStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int,
+	archive func([]model.ShortenedURL) error) (int, error) {
+	return 0, nil
+}
+
 func (fss *MockStorage) DeleteBulk(background context.Context, buffer map[uuid.UUID][]string) error {
 	return nil
 }
 
+func (fss *MockStorage) RestoreBulk(ctx context.Context, userUID uuid.UUID, shortURLs []string) ([]string, error) {
+	return nil, nil
+}
+
 func (fss *MockStorage) CreateUserURL(ctx context.Context, userURL *model.UserURL) error {
 	var shortenedURL model.ShortenedURL
 	for _, url := range fss.urlMap {
@@ -368,6 +401,40 @@ func TestURLShortener_HandleShortenedURL(t *testing.T) {
 				code: 410,
 			},
 		},
+		{
+			name: "expired url",
+			urlMap: map[string]model.ShortenedURL{
+				key2: {
+					OriginalURL: targetURL,
+					ExpiresAt:   sql.NullTime{Time: time.Now().Add(-time.Second), Valid: true},
+				},
+			},
+			pathVar:        key2,
+			route:          "/" + key2,
+			method:         http.MethodGet,
+			contextTimeout: time.Duration(2) * time.Second,
+			want: want{
+				code: 410,
+			},
+		},
+		{
+			name: "not yet expired url",
+			urlMap: map[string]model.ShortenedURL{
+				key2: {
+					OriginalURL: targetURL,
+					ExpiresAt:   sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true},
+				},
+			},
+			pathVar:        key2,
+			route:          "/" + key2,
+			method:         http.MethodGet,
+			contextTimeout: time.Duration(2) * time.Second,
+			want: want{
+				code:        307,
+				contentType: "text/html; charset=utf-8",
+				response:    targetURL,
+			},
+		},
 		{
 			name: "context timeout",
 			urlMap: map[string]model.ShortenedURL{
@@ -674,6 +741,31 @@ func TestShortenerHandlers_APIGetUserURLs(t *testing.T) {
 				writer:  httptest.NewRecorder(),
 				request: httptest.NewRequest(http.MethodGet, "/api/user/urls", nil),
 			},
+			want: want{
+				code: 200,
+				response: `
+					[
+						{
+							"short_url": "http://localhost:8080/dhKeUBD3",
+							"original_url": "https://google.com"
+						}
+					]`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "include deleted urls",
+			fields: fields{
+				shortenerService: service.NewShortenerService(&storage, make(chan service.Task)),
+				shortenedURLAddr: "http://localhost:8080",
+				storage:          &storage,
+				contextTimeout:   time.Duration(2) * time.Second,
+			},
+			args: args{
+				userUID: uuid.MustParse("ec7325ca-a41a-49cc-8c21-f58d86385335"),
+				writer:  httptest.NewRecorder(),
+				request: httptest.NewRequest(http.MethodGet, "/api/user/urls?include_deleted=true", nil),
+			},
 			want: want{
 				code: 200,
 				response: `
@@ -684,12 +776,32 @@ func TestShortenerHandlers_APIGetUserURLs(t *testing.T) {
 						},
 						{
 							"short_url": "http://localhost:8080/jnkGbkl2",
-							"original_url": "https://ya.ru"
+							"original_url": "https://ya.ru",
+							"is_deleted": true
 						}
 					]`,
 			},
 			wantErr: false,
 		},
+		{
+			name: "invalid include deleted",
+			fields: fields{
+				shortenerService: service.NewShortenerService(&storage, make(chan service.Task)),
+				shortenedURLAddr: "http://localhost:8080",
+				storage:          &storage,
+				contextTimeout:   time.Duration(2) * time.Second,
+			},
+			args: args{
+				userUID: uuid.MustParse("ec7325ca-a41a-49cc-8c21-f58d86385335"),
+				writer:  httptest.NewRecorder(),
+				request: httptest.NewRequest(http.MethodGet, "/api/user/urls?include_deleted=maybe", nil),
+			},
+			want: want{
+				code:     http.StatusBadRequest,
+				response: "Invalid include_deleted\n",
+			},
+			wantErr: true,
+		},
 		{
 			name: "context timeout",
 			fields: fields{
@@ -906,3 +1018,667 @@ func TestShortenerHandlers_APIDeleteUserURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestShortenerHandlers_APIDeleteUserURLs_QueueFull(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	userUID := uuid.New()
+	sh := &ShortenerHandlers{
+		shortenerService: service.NewShortenerService(s, make(chan service.Task, 1),
+			service.WithDeletionConfig(service.DeletionConfig{FlushInterval: 1500 * time.Millisecond})),
+		shortenedURLAddr: "http://localhost:8080",
+		storage:          s,
+		contextTimeout:   2 * time.Second,
+	}
+	deleteURLs := func() *http.Response {
+		request := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["dhKeUBD3"]`))
+		request = request.WithContext(appContext.WithUserUID(request.Context(), &userUID))
+		writer := httptest.NewRecorder()
+		sh.APIDeleteUserURLs(writer, request)
+		return writer.Result()
+	}
+
+	res := deleteURLs()
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+
+	res = deleteURLs()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, "2", res.Header.Get("Retry-After"))
+	assert.Equal(t, "Deletion queue is full\n", string(body))
+}
+
+func TestShortenerHandlers_APIDeleteUserURLs_BatchTooLarge(t *testing.T) {
+	s := storage.NewMemoryStorage()
+	userUID := uuid.New()
+	sh := &ShortenerHandlers{
+		shortenerService: service.NewShortenerService(s, make(chan service.Task, 1),
+			service.WithDeletionConfig(service.DeletionConfig{ChunkSize: 2})),
+		shortenedURLAddr: "http://localhost:8080",
+		storage:          s,
+		contextTimeout:   2 * time.Second,
+	}
+	request := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["dhKeUBD3","dhKeUBD4","dhKeUBD5"]`))
+	request = request.WithContext(appContext.WithUserUID(request.Context(), &userUID))
+	writer := httptest.NewRecorder()
+	sh.APIDeleteUserURLs(writer, request)
+	res := writer.Result()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Retry-After"))
+	assert.Equal(t, "Batch is too large, at most 2 keys\n", string(body))
+}
+
+func TestShortenerHandlers_APIRestoreUserURLs(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemoryStorage()
+	owner := uuid.New()
+	stranger := uuid.New()
+	shortenedURL := model.ShortenedURL{UUID: uuid.New(), ShortURL: "dhKeUBD3", OriginalURL: "https://google.com"}
+	require.NoError(t, s.WriteShortenedURL(ctx, &shortenedURL))
+	require.NoError(t, s.CreateUserURL(ctx, &model.UserURL{UUID: owner, ShortenedURLUUID: shortenedURL.UUID}))
+	require.NoError(t, s.DeleteBulk(ctx, map[uuid.UUID][]string{owner: {shortenedURL.ShortURL}}))
+	sh := &ShortenerHandlers{
+		shortenerService: service.NewShortenerService(s, make(chan service.Task)),
+		shortenedURLAddr: "http://localhost:8080",
+		storage:          s,
+		contextTimeout:   2 * time.Second,
+	}
+
+	tests := []struct {
+		name     string
+		userUID  uuid.UUID
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "not authenticated",
+			body:     `["dhKeUBD3"]`,
+			wantCode: http.StatusUnauthorized,
+			wantBody: "User is not authenticated\n",
+		},
+		{
+			name:     "empty list",
+			userUID:  owner,
+			body:     `[]`,
+			wantCode: http.StatusBadRequest,
+			wantBody: "Batch is empty\n",
+		},
+		{
+			name:     "other user can not restore",
+			userUID:  stranger,
+			body:     `["dhKeUBD3"]`,
+			wantCode: http.StatusOK,
+			wantBody: `{"restored":[],"not_restored":["dhKeUBD3"]}`,
+		},
+		{
+			name:     "owner restores",
+			userUID:  owner,
+			body:     `["dhKeUBD3", "unknown", "dhKeUBD3"]`,
+			wantCode: http.StatusOK,
+			wantBody: `{"restored":["dhKeUBD3"],"not_restored":["unknown"]}`,
+		},
+		{
+			name:     "restored url is not deleted anymore",
+			userUID:  owner,
+			body:     `["dhKeUBD3"]`,
+			wantCode: http.StatusOK,
+			wantBody: `{"restored":[],"not_restored":["dhKeUBD3"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(tt.body))
+			if tt.userUID != uuid.Nil {
+				request = request.WithContext(appContext.WithUserUID(request.Context(), &tt.userUID))
+			}
+			writer := httptest.NewRecorder()
+			sh.APIRestoreUserURLs(writer, request)
+
+			res := writer.Result()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.NoError(t, res.Body.Close())
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+
+	got, err := s.ReadShortenedURL(ctx, shortenedURL.ShortURL)
+	require.NoError(t, err)
+	assert.False(t, got.DeletedFlag)
+}
+
+func TestURLShortener_Alias(t *testing.T) {
+	userUID := uuid.New()
+	s := storage.NewMemoryStorage()
+	require.NoError(t, s.WriteShortenedURL(context.Background(), &model.ShortenedURL{
+		UUID: uuid.New(), ShortURL: "spring-sale", OriginalURL: "https://shop.ru/spring",
+	}))
+	sh := &ShortenerHandlers{
+		shortenerService: service.NewShortenerService(s, make(chan service.Task)),
+		shortenedURLAddr: "http://localhost:8080",
+		storage:          s,
+		contextTimeout:   2 * time.Second,
+	}
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		route     string
+		body      string
+		wantCode  int
+		wantBody  string
+		wantError ErrorResponseDto
+	}{
+		{
+			name:     "api alias",
+			handler:  sh.APIShortenURL,
+			route:    "/api/shorten",
+			body:     `{"url": "https://shop.ru/summer", "alias": "summer-sale"}`,
+			wantCode: http.StatusCreated,
+			wantBody: `{"result":"http://localhost:8080/summer-sale"}`,
+		},
+		{
+			name:     "text alias",
+			handler:  sh.ShortenURL,
+			route:    "/?alias=autumn-sale",
+			body:     "https://shop.ru/autumn",
+			wantCode: http.StatusCreated,
+			wantBody: "http://localhost:8080/autumn-sale",
+		},
+		{
+			name:      "alias taken",
+			handler:   sh.APIShortenURL,
+			route:     "/api/shorten",
+			body:      `{"url": "https://shop.ru/winter", "alias": "spring-sale"}`,
+			wantCode:  http.StatusConflict,
+			wantError: ErrorResponseDto{Code: "alias_taken", Alias: "spring-sale"},
+		},
+		{
+			name:      "reserved alias",
+			handler:   sh.ShortenURL,
+			route:     "/?alias=Ping",
+			body:      "https://shop.ru/ping",
+			wantCode:  http.StatusBadRequest,
+			wantError: ErrorResponseDto{Code: "invalid_alias", Alias: "Ping"},
+		},
+		{
+			name:      "invalid symbols",
+			handler:   sh.APIShortenURL,
+			route:     "/api/shorten",
+			body:      `{"url": "https://shop.ru/sale", "alias": "sale/2024"}`,
+			wantCode:  http.StatusBadRequest,
+			wantError: ErrorResponseDto{Code: "invalid_alias", Alias: "sale/2024"},
+		},
+		{
+			name:      "batch alias taken",
+			handler:   sh.APIShortenURLBatch,
+			route:     "/api/shorten/batch",
+			body:      `[{"correlation_id": "1", "original_url": "https://shop.ru/1"}, {"correlation_id": "2", "original_url": "https://shop.ru/2", "alias": "spring-sale"}]`,
+			wantCode:  http.StatusConflict,
+			wantError: ErrorResponseDto{Code: "alias_taken", Alias: "spring-sale"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, test.route, strings.NewReader(test.body))
+			request = request.WithContext(appContext.WithUserUID(request.Context(), &userUID))
+			test.handler(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantCode, res.StatusCode)
+			if test.wantBody != "" {
+				assert.Equal(t, test.wantBody, string(body))
+				return
+			}
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+			response := ErrorResponseDto{}
+			require.NoError(t, easyjson.Unmarshal(body, &response))
+			assert.Equal(t, test.wantError.Code, response.Code)
+			assert.Equal(t, test.wantError.Alias, response.Alias)
+			assert.NotEmpty(t, response.Message)
+		})
+	}
+}
+
+func TestURLShortener_Expiration(t *testing.T) {
+	userUID := uuid.New()
+	tests := []struct {
+		name       string
+		handler    func(sh *ShortenerHandlers) http.HandlerFunc
+		route      string
+		body       string
+		wantCode   int
+		wantExpiry time.Duration
+	}{
+		{
+			name:       "api ttl",
+			handler:    func(sh *ShortenerHandlers) http.HandlerFunc { return sh.APIShortenURL },
+			route:      "/api/shorten",
+			body:       `{"url": "https://google.com", "ttl": "2h"}`,
+			wantCode:   http.StatusCreated,
+			wantExpiry: 2 * time.Hour,
+		},
+		{
+			name:       "api expires_at",
+			handler:    func(sh *ShortenerHandlers) http.HandlerFunc { return sh.APIShortenURL },
+			route:      "/api/shorten",
+			body:       `{"url": "https://google.com", "expires_at": "` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`,
+			wantCode:   http.StatusCreated,
+			wantExpiry: time.Hour,
+		},
+		{
+			name:       "text ttl",
+			handler:    func(sh *ShortenerHandlers) http.HandlerFunc { return sh.ShortenURL },
+			route:      "/?ttl=30m",
+			body:       "https://google.com",
+			wantCode:   http.StatusCreated,
+			wantExpiry: 30 * time.Minute,
+		},
+		{
+			name:     "expires_at in the past",
+			handler:  func(sh *ShortenerHandlers) http.HandlerFunc { return sh.APIShortenURL },
+			route:    "/api/shorten",
+			body:     `{"url": "https://google.com", "expires_at": "2020-01-01T00:00:00Z"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "both ttl and expires_at",
+			handler:  func(sh *ShortenerHandlers) http.HandlerFunc { return sh.ShortenURL },
+			route:    "/?ttl=1h&expires_at=2030-01-01T00:00:00Z",
+			body:     "https://google.com",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid ttl",
+			handler:  func(sh *ShortenerHandlers) http.HandlerFunc { return sh.ShortenURL },
+			route:    "/?ttl=-1h",
+			body:     "https://google.com",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			urlMap := make(map[string]model.ShortenedURL)
+			s := &MockStorage{urlMap: urlMap}
+			sh := &ShortenerHandlers{
+				shortenerService: service.NewShortenerService(s, make(chan service.Task)),
+				shortenedURLAddr: "http://localhost:8080",
+				storage:          s,
+				contextTimeout:   2 * time.Second,
+			}
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, test.route, strings.NewReader(test.body))
+			request = request.WithContext(appContext.WithUserUID(request.Context(), &userUID))
+			test.handler(sh)(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, test.wantCode, res.StatusCode)
+			if test.wantCode != http.StatusCreated {
+				assert.Empty(t, urlMap)
+				return
+			}
+			require.Len(t, urlMap, 1)
+			for _, shortenedURL := range urlMap {
+				require.True(t, shortenedURL.ExpiresAt.Valid)
+				assert.WithinDuration(t, time.Now().Add(test.wantExpiry), shortenedURL.ExpiresAt.Time, 5*time.Second)
+			}
+		})
+	}
+}
+
+func TestURLShortener_HandleShortenedURL_ClickLimit(t *testing.T) {
+	const (
+		maxClicks = 3
+		requests  = 30
+	)
+	userUID := uuid.New()
+	s := storage.NewMemoryStorage()
+	ss := service.NewShortenerService(s, make(chan service.Task))
+	shortenedURL, err := ss.CreateShortenedURL(context.Background(), &userUID, "https://secret.ru",
+		service.ShortenOptions{MaxClicks: maxClicks})
+	require.NoError(t, err)
+	sh := &ShortenerHandlers{
+		shortenerService: ss,
+		shortenedURLAddr: "http://localhost:8080",
+		storage:          s,
+		contextTimeout:   2 * time.Second,
+	}
+
+	codes := make(chan int, requests)
+	wg := sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/"+shortenedURL.ShortURL, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", shortenedURL.ShortURL)
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+			sh.HandleShortenedURL(w, request)
+			codes <- w.Result().StatusCode
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	count := make(map[int]int)
+	for code := range codes {
+		count[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusTemporaryRedirect: maxClicks, http.StatusGone: requests - maxClicks}, count)
+}
+
+func TestURLShortener_PasswordProtected(t *testing.T) {
+	userUID := uuid.New()
+	s := storage.NewMemoryStorage()
+	ss := service.NewShortenerService(s, make(chan service.Task))
+	ts := service.NewTokenService(config.AppConfig{TokenSecretKey: "secret"})
+	sh := NewShortenerHandlers("http://localhost:8080", 2, ss, s, ts, 60)
+	protected, err := ss.CreateShortenedURL(context.Background(), &userUID, "https://secret.ru",
+		service.ShortenOptions{Password: "open sesame"})
+	require.NoError(t, err)
+	other, err := ss.CreateShortenedURL(context.Background(), &userUID, "https://other.ru",
+		service.ShortenOptions{Password: "open sesame"})
+	require.NoError(t, err)
+
+	serve := func(handler http.HandlerFunc, request *http.Request, shortURL string) *http.Response {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", shortURL)
+		request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handler(w, request)
+		return w.Result()
+	}
+	unlock := func(password string) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, "/"+protected.ShortURL,
+			strings.NewReader(url.Values{"password": {password}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(sh.UnlockShortenedURL, request, protected.ShortURL)
+	}
+
+	result := serve(sh.HandleShortenedURL, httptest.NewRequest(http.MethodGet, "/"+protected.ShortURL, nil), protected.ShortURL)
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	result.Body.Close()
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Contains(t, result.Header.Get("Content-Type"), "text/html")
+	assert.Contains(t, string(body), `action="/`+protected.ShortURL+`"`)
+	assert.NotContains(t, string(body), "https://secret.ru")
+
+	result = unlock("wrong")
+	result.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, result.StatusCode)
+	assert.Empty(t, result.Cookies())
+
+	result = unlock("open sesame")
+	result.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, result.StatusCode)
+	assert.Equal(t, "/"+protected.ShortURL, result.Header.Get("Location"))
+	require.Len(t, result.Cookies(), 1)
+	cookie := result.Cookies()[0]
+	assert.Equal(t, CookieLinkAccess, cookie.Name)
+	assert.Equal(t, "/"+protected.ShortURL, cookie.Path)
+	assert.True(t, cookie.HttpOnly)
+	assert.False(t, cookie.Secure)
+	assert.Equal(t, 60, cookie.MaxAge)
+
+	request := httptest.NewRequest(http.MethodPost, "https://localhost/"+protected.ShortURL,
+		strings.NewReader(url.Values{"password": {"open sesame"}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	result = serve(sh.UnlockShortenedURL, request, protected.ShortURL)
+	result.Body.Close()
+	require.Len(t, result.Cookies(), 1)
+	assert.True(t, result.Cookies()[0].Secure, "cookies unlocked over TLS are not sent in clear")
+
+	request = httptest.NewRequest(http.MethodGet, "/"+protected.ShortURL, nil)
+	request.AddCookie(cookie)
+	result = serve(sh.HandleShortenedURL, request, protected.ShortURL)
+	result.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+	assert.Equal(t, "https://secret.ru", result.Header.Get("Location"))
+
+	// the cookie unlocks only the link it was issued for
+	request = httptest.NewRequest(http.MethodGet, "/"+other.ShortURL, nil)
+	request.AddCookie(cookie)
+	result = serve(sh.HandleShortenedURL, request, other.ShortURL)
+	result.Body.Close()
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+}
+
+func Test_ipPrefix(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{remoteAddr: "203.0.113.42:51234", want: "203.0.113.0/24"},
+		{remoteAddr: "[2001:db8:85a3:8d3:1319:8a2e:370:7348]:443", want: "2001:db8:85a3::/48"},
+		{remoteAddr: "[::ffff:203.0.113.42]:443", want: "203.0.113.0/24"},
+		{remoteAddr: "[fe80::1%eth0]:443", want: "fe80::/48"},
+		{remoteAddr: "203.0.113.42", want: "203.0.113.0/24"},
+		{remoteAddr: "", want: ""},
+		{remoteAddr: "not an address", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			assert.Equal(t, tt.want, ipPrefix(tt.remoteAddr))
+		})
+	}
+}
+
+func TestURLShortener_HandleShortenedURL_RecordsClick(t *testing.T) {
+	userUID := uuid.New()
+	s := storage.NewMemoryStorage()
+	clickChannel := make(chan model.Click, 1)
+	ss := service.NewShortenerService(s, make(chan service.Task), service.WithClickChannel(clickChannel))
+	shortenedURL, err := ss.CreateShortenedURL(context.Background(), &userUID, "https://ya.ru", service.ShortenOptions{})
+	require.NoError(t, err)
+	sh := NewShortenerHandlers("http://localhost:8080", 2, ss, s, nil, 0)
+
+	request := httptest.NewRequest(http.MethodGet, "/"+shortenedURL.ShortURL, nil)
+	request.RemoteAddr = "203.0.113.42:51234"
+	request.Header.Set("Referer", "https://news.ycombinator.com/")
+	request.Header.Set("User-Agent", "curl/8.4.0")
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", shortenedURL.ShortURL)
+	request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+	sh.HandleShortenedURL(w, request)
+	result := w.Result()
+	result.Body.Close()
+	require.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+
+	require.Len(t, clickChannel, 1)
+	click := <-clickChannel
+	assert.Equal(t, shortenedURL.ShortURL, click.ShortURL)
+	assert.Equal(t, "https://news.ycombinator.com/", click.Referrer)
+	assert.Equal(t, "curl/8.4.0", click.UserAgent)
+	assert.Equal(t, "203.0.113.0/24", click.IPPrefix)
+	assert.WithinDuration(t, time.Now(), click.ClickedAt, time.Minute)
+}
+
+func TestURLShortener_HandleShortenedURL_RecordsResolvedClientAddr(t *testing.T) {
+	userUID := uuid.New()
+	s := storage.NewMemoryStorage()
+	clickChannel := make(chan model.Click, 1)
+	ss := service.NewShortenerService(s, make(chan service.Task), service.WithClickChannel(clickChannel))
+	shortenedURL, err := ss.CreateShortenedURL(context.Background(), &userUID, "https://ya.ru", service.ShortenOptions{})
+	require.NoError(t, err)
+	sh := NewShortenerHandlers("http://localhost:8080", 2, ss, s, nil, 0)
+
+	request := httptest.NewRequest(http.MethodGet, "/"+shortenedURL.ShortURL, nil)
+	request.RemoteAddr = "10.0.0.1:51234"
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", shortenedURL.ShortURL)
+	ctx := context.WithValue(request.Context(), chi.RouteCtxKey, rctx)
+	request = request.WithContext(appContext.WithClientAddr(ctx, netip.MustParseAddr("198.51.100.4")))
+	w := httptest.NewRecorder()
+	sh.HandleShortenedURL(w, request)
+	result := w.Result()
+	result.Body.Close()
+	require.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+
+	require.Len(t, clickChannel, 1)
+	assert.Equal(t, "198.51.100.0/24", (<-clickChannel).IPPrefix)
+}
+
+func TestShortenerHandlers_APIGetURLStats(t *testing.T) {
+	owner, stranger := uuid.New(), uuid.New()
+	s := storage.NewMemoryStorage()
+	ss := service.NewShortenerService(s, make(chan service.Task))
+	shortenedURL, err := ss.CreateShortenedURL(context.Background(), &owner, "https://ya.ru", service.ShortenOptions{})
+	require.NoError(t, err)
+	require.NoError(t, s.WriteClicks(context.Background(), []model.Click{
+		{ShortURL: shortenedURL.ShortURL, ClickedAt: time.Date(2023, 11, 20, 10, 0, 0, 0, time.UTC), Referrer: "https://ya.ru/", UserAgent: "curl"},
+		{ShortURL: shortenedURL.ShortURL, ClickedAt: time.Date(2023, 11, 21, 10, 0, 0, 0, time.UTC), UserAgent: "curl"},
+	}))
+	sh := NewShortenerHandlers("http://localhost:8080", 2, ss, s, nil, 0)
+
+	tests := []struct {
+		name     string
+		userUID  *uuid.UUID
+		shortURL string
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "owner",
+			userUID:  &owner,
+			shortURL: shortenedURL.ShortURL,
+			query:    "?from=2023-11-20&to=2023-11-20",
+			wantCode: http.StatusOK,
+			wantBody: `{"short_url":"http://localhost:8080/` + shortenedURL.ShortURL + `","from":"2023-11-20T00:00:00Z",` +
+				`"to":"2023-11-21T00:00:00Z","total_clicks":1,"unique_visitors":1,` +
+				`"clicks_per_day":[{"value":"2023-11-20","clicks":1}],"clicks_per_hour":[{"value":"2023-11-20T10:00:00Z","clicks":1}],` +
+				`"top_referrers":[{"value":"https://ya.ru/","clicks":1}],"top_user_agents":[{"value":"curl","clicks":1}]}`,
+		},
+		{
+			name:     "no clicks in range",
+			userUID:  &owner,
+			shortURL: shortenedURL.ShortURL,
+			query:    "?from=2023-01-01T00:00:00Z&to=2023-02-01T00:00:00Z",
+			wantCode: http.StatusOK,
+			wantBody: `{"short_url":"http://localhost:8080/` + shortenedURL.ShortURL + `","from":"2023-01-01T00:00:00Z",` +
+				`"to":"2023-02-01T00:00:00Z","total_clicks":0,"unique_visitors":0,` +
+				`"clicks_per_day":[],"clicks_per_hour":[],"top_referrers":[],"top_user_agents":[]}`,
+		},
+		{name: "another user", userUID: &stranger, shortURL: shortenedURL.ShortURL, wantCode: http.StatusForbidden},
+		{name: "unknown link", userUID: &owner, shortURL: "unknown1", wantCode: http.StatusNotFound},
+		{name: "not authenticated", shortURL: shortenedURL.ShortURL, wantCode: http.StatusUnauthorized},
+		{name: "invalid from", userUID: &owner, shortURL: shortenedURL.ShortURL, query: "?from=yesterday", wantCode: http.StatusBadRequest},
+		{
+			name:     "empty range",
+			userUID:  &owner,
+			shortURL: shortenedURL.ShortURL,
+			query:    "?from=2023-11-21T00:00:00Z&to=2023-11-21T00:00:00Z",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+tt.shortURL+"/stats"+tt.query, nil)
+			ctx := request.Context()
+			if tt.userUID != nil {
+				ctx = appContext.WithUserUID(ctx, tt.userUID)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.shortURL)
+			request = request.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			sh.APIGetURLStats(w, request)
+
+			result := w.Result()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			result.Body.Close()
+			assert.Equal(t, tt.wantCode, result.StatusCode)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, string(body))
+			}
+		})
+	}
+}
+
+func TestShortenerHandlers_APIGetDeletionJob(t *testing.T) {
+	owner, stranger := uuid.New(), uuid.New()
+	s := storage.NewMemoryStorage()
+	taskChannel := make(chan service.Task, 10)
+	ss := service.NewShortenerService(s, taskChannel)
+	shortenedURL, err := ss.CreateShortenedURL(context.Background(), &owner, "https://ya.ru", service.ShortenOptions{})
+	require.NoError(t, err)
+	sh := NewShortenerHandlers("http://localhost:8080", 2, ss, s, nil, 0)
+
+	request := httptest.NewRequest(http.MethodDelete, "/api/user/urls",
+		strings.NewReader(`["`+shortenedURL.ShortURL+`", "unknown1"]`))
+	request = request.WithContext(appContext.WithUserUID(request.Context(), &owner))
+	w := httptest.NewRecorder()
+	sh.APIDeleteUserURLs(w, request)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	accepted := DeletionAcceptedDto{}
+	require.NoError(t, accepted.UnmarshalJSON(w.Body.Bytes()))
+	assert.Equal(t, "/api/user/urls/deletions/"+accepted.JobID, w.Header().Get("Location"))
+	close(taskChannel)
+	ss.BatchProcess(context.Background(), taskChannel)
+
+	tests := []struct {
+		name       string
+		userUID    *uuid.UUID
+		jobID      string
+		wantCode   int
+		wantStatus string
+		wantURLs   []DeletionOutcomeDto
+	}{
+		{
+			name:       "owner",
+			userUID:    &owner,
+			jobID:      accepted.JobID,
+			wantCode:   http.StatusOK,
+			wantStatus: service.JobApplied,
+			wantURLs: []DeletionOutcomeDto{
+				{ShortURL: shortenedURL.ShortURL, Result: service.URLDeleted},
+				{ShortURL: "unknown1", Result: service.URLNotFound},
+			},
+		},
+		{name: "another user", userUID: &stranger, jobID: accepted.JobID, wantCode: http.StatusNotFound},
+		{name: "unknown job", userUID: &owner, jobID: uuid.NewString(), wantCode: http.StatusNotFound},
+		{name: "invalid job id", userUID: &owner, jobID: "job", wantCode: http.StatusBadRequest},
+		{name: "not authenticated", jobID: accepted.JobID, wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/user/urls/deletions/"+tt.jobID, nil)
+			ctx := request.Context()
+			if tt.userUID != nil {
+				ctx = appContext.WithUserUID(ctx, tt.userUID)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("jobID", tt.jobID)
+			request = request.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			sh.APIGetDeletionJob(w, request)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			job := DeletionJobDto{}
+			require.NoError(t, job.UnmarshalJSON(w.Body.Bytes()))
+			assert.Equal(t, tt.jobID, job.JobID)
+			assert.Equal(t, tt.wantStatus, job.Status)
+			assert.Equal(t, tt.wantURLs, job.URLs)
+		})
+	}
+}
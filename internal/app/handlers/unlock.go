@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/service"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"go.uber.org/zap"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+const CookieLinkAccess = "link-access"
+
+var unlockForm = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Protected link</title></head>
+<body>
+<form method="post" action="/{{.ShortURL}}">
+<p>This link is protected with a password.</p>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`))
+
+// UnlockShortenedURL checks the password posted by the unlock form and remembers the access in a cookie,
+// so the following visits redirect directly.
+func (sh *ShortenerHandlers) UnlockShortenedURL(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := sh.requestContext(r)
+	defer cancel()
+	shortKey := chi.URLParam(r, "id")
+	shortenedURL, err := sh.shortenerService.GetShortenedURL(ctx, shortKey)
+	if err != nil && contextHasError(w, ctx) {
+		return
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Unable to get shortened URL", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || shortenedURL.OriginalURL == "" {
+		http.Error(w, "Shortened url not found", http.StatusNotFound)
+		return
+	}
+	if shortenedURL.DeletedFlag || shortenedURL.Expired(time.Now()) {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	if !shortenedURL.PasswordHash.Valid {
+		http.Redirect(w, r, "/"+shortenedURL.ShortURL, http.StatusSeeOther)
+		return
+	}
+	if !service.CheckPassword(shortenedURL, r.PostFormValue("password")) {
+		writeUnlockForm(w, http.StatusUnauthorized, shortenedURL.ShortURL, "Wrong password")
+		return
+	}
+	token, err := sh.tokenService.GenerateLinkToken(shortenedURL.ShortURL, sh.linkAccessTTL)
+	if err != nil {
+		logger.Log.Error("Unable to generate link token", zap.Error(err))
+		http.Error(w, "Unable to unlock shortened URL", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieLinkAccess,
+		Value:    token,
+		Path:     "/" + shortenedURL.ShortURL,
+		MaxAge:   int(sh.linkAccessTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/"+shortenedURL.ShortURL, http.StatusSeeOther)
+}
+
+func (sh *ShortenerHandlers) hasLinkAccess(r *http.Request, shortURL string) bool {
+	if sh.tokenService == nil {
+		return false
+	}
+	// cookies of the other protected links are scoped to their own paths
+	for _, cookie := range r.Cookies() {
+		if cookie.Name == CookieLinkAccess && sh.tokenService.VerifyLinkToken(cookie.Value, shortURL) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func writeUnlockForm(w http.ResponseWriter, code int, shortURL, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	err := unlockForm.Execute(w, struct {
+		ShortURL string
+		Error    string
+	}{ShortURL: shortURL, Error: errMsg})
+	if err != nil {
+		logger.Log.Error("Unable to render unlock form", zap.Error(err))
+	}
+}
@@ -0,0 +1,80 @@
+// Package metrics holds the Prometheus collectors of the service, they are exposed by Handler.
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "shortener"
+
+// Redirect results of HandleShortenedURL.
+const (
+	RedirectHit    = "hit"
+	RedirectMiss   = "miss"
+	RedirectGone   = "gone"
+	RedirectLocked = "locked" // a password-protected link answered with the unlock form
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route pattern.",
+	}, []string{"method", "route", "code"})
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	Redirects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Short link lookups by result: hit, miss, gone or locked.",
+	}, []string{"result"})
+	Lookups = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lookups_total",
+		Help:      "Short link lookups, concurrent lookups of the same key share a storage read.",
+	})
+	LookupStorageReads = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lookup_storage_reads_total",
+		Help:      "Storage reads made by short link lookups.",
+	})
+	DeleteQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "delete_queue_depth",
+		Help:      "Deletion tasks waiting in the queue or in the batch buffer.",
+	})
+	DeleteFlushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delete_flush_duration_seconds",
+		Help:      "Duration of writing a batch of deletions to the storage.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	DeleteBulkErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "delete_bulk_errors_total",
+		Help:      "Number of failed batch deletions.",
+	})
+	PurgedURLs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "purged_urls_total",
+		Help:      "Number of soft-deleted links hard deleted after the retention period.",
+	})
+)
+
+// RegisterDBStats exposes the connection pool stats of db.
+func RegisterDBStats(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -2,10 +2,12 @@ package middlware
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/ujwegh/shortener/internal/app/logger"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"strings"
 )
 
 type responseRecorder struct {
@@ -71,5 +73,30 @@ func getRequestBodyForLogging(r *http.Request) (string, error) {
 		return "empty body", nil
 	}
 	r.Body = io.NopCloser(bytes.NewBuffer(body))
-	return string(body), nil
+	// forms carry passwords of protected links
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return "form body omitted", nil
+	}
+	// compressed bodies are unzipped later in the chain and could hide a password
+	if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+		return "compressed body omitted", nil
+	}
+	return redactPassword(body), nil
+}
+
+// redactPassword masks the password of a protected link created via the JSON API.
+func redactPassword(body []byte) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return string(body)
+	}
+	if _, ok := fields["password"]; !ok {
+		return string(body)
+	}
+	fields["password"] = json.RawMessage(`"***"`)
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return "body omitted"
+	}
+	return string(redacted)
 }
@@ -0,0 +1,59 @@
+package middlware
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetRequestBodyForLogging(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		encoding    string
+		want        string
+	}{
+		{name: "plain url", body: "https://ya.ru", contentType: "text/plain", want: "https://ya.ru"},
+		{name: "empty body", want: "empty body"},
+		{
+			name:        "json without password",
+			body:        `{"url":"https://ya.ru"}`,
+			contentType: "application/json",
+			want:        `{"url":"https://ya.ru"}`,
+		},
+		{
+			name:        "json password is redacted",
+			body:        `{"url":"https://ya.ru","password":"s3cr3t"}`,
+			contentType: "application/json",
+			want:        `{"password":"***","url":"https://ya.ru"}`,
+		},
+		{
+			name:        "unlock form",
+			body:        "password=s3cr3t",
+			contentType: "application/x-www-form-urlencoded",
+			want:        "form body omitted",
+		},
+		{name: "gzip body", body: "\x1f\x8b", encoding: "gzip", want: "compressed body omitted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Header.Set("Content-Encoding", tt.encoding)
+
+			got, err := getRequestBodyForLogging(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.NotContains(t, got, "s3cr3t")
+
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, string(body), "the handler still gets the original body")
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package middlware
+
+import (
+	"fmt"
+	appContext "github.com/ujwegh/shortener/internal/app/context"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedSubnetMiddleware lets through only clients from the trusted subnet. The client address is taken
+// from X-Real-IP or X-Forwarded-For only when the request comes from a trusted proxy, otherwise
+// the headers could be forged by the client itself.
+type TrustedSubnetMiddleware struct {
+	subnet  netip.Prefix // invalid when not configured, every request is rejected then
+	proxies []netip.Prefix
+}
+
+func NewTrustedSubnetMiddleware(subnet string, proxies []string) TrustedSubnetMiddleware {
+	tm := TrustedSubnetMiddleware{}
+	if subnet != "" {
+		tm.subnet = mustParsePrefix(subnet)
+	}
+	for _, proxy := range proxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			tm.proxies = append(tm.proxies, mustParsePrefix(proxy))
+		}
+	}
+	return tm
+}
+
+func (tm *TrustedSubnetMiddleware) Restrict(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, ok := tm.clientAddr(r)
+		if !tm.subnet.IsValid() || !ok || !tm.subnet.Contains(client) {
+			logger.Log.Warn("request from untrusted address", zap.String("path", r.URL.Path),
+				zap.String("remote", r.RemoteAddr), zap.Stringer("client", client))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ResolveClientAddr puts the client address into the request context, resolved the same way as by Restrict.
+func (tm *TrustedSubnetMiddleware) ResolveClientAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if client, ok := tm.clientAddr(r); ok {
+			r = r.WithContext(appContext.WithClientAddr(r.Context(), client))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (tm *TrustedSubnetMiddleware) clientAddr(r *http.Request) (netip.Addr, bool) {
+	peer, ok := parseAddr(r.RemoteAddr)
+	if !ok || !tm.isProxy(peer) {
+		return peer, ok
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return parseAddr(strings.TrimSpace(realIP))
+	}
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return peer, true
+	}
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	// the rightmost hop not added by our own proxies is the client
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseAddr(strings.TrimSpace(hops[i]))
+		if !ok {
+			return netip.Addr{}, false
+		}
+		if i == 0 || !tm.isProxy(hop) {
+			return hop, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+func (tm *TrustedSubnetMiddleware) isProxy(addr netip.Addr) bool {
+	for _, proxy := range tm.proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr accepts an address with or without a port.
+func parseAddr(value string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// mustParsePrefix accepts a CIDR or a single address.
+func mustParsePrefix(value string) netip.Prefix {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Masked()
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		panic(fmt.Sprintf("invalid subnet %q", value))
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen())
+}
@@ -0,0 +1,136 @@
+package middlware
+
+import (
+	"github.com/stretchr/testify/assert"
+	appContext "github.com/ujwegh/shortener/internal/app/context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedSubnetMiddleware_Restrict(t *testing.T) {
+	tests := []struct {
+		name       string
+		subnet     string
+		proxies    []string
+		remoteAddr string
+		headers    map[string][]string
+		wantCode   int
+	}{
+		{name: "direct trusted client", subnet: "192.168.1.0/24", remoteAddr: "192.168.1.10:5123", wantCode: http.StatusOK},
+		{name: "direct untrusted client", subnet: "192.168.1.0/24", remoteAddr: "203.0.113.7:5123", wantCode: http.StatusForbidden},
+		{name: "subnet not configured", remoteAddr: "192.168.1.10:5123", wantCode: http.StatusForbidden},
+		{
+			name:       "forged header without a trusted proxy",
+			subnet:     "192.168.1.0/24",
+			remoteAddr: "203.0.113.7:5123",
+			headers:    map[string][]string{"X-Real-IP": {"192.168.1.10"}},
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "real ip from a trusted proxy",
+			subnet:     "192.168.1.0/24",
+			proxies:    []string{"10.0.0.1"},
+			remoteAddr: "10.0.0.1:5123",
+			headers:    map[string][]string{"X-Real-IP": {"192.168.1.10"}},
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "untrusted real ip from a trusted proxy",
+			subnet:     "192.168.1.0/24",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:5123",
+			headers:    map[string][]string{"X-Real-IP": {"203.0.113.7"}},
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "forwarded through a proxy chain",
+			subnet:     "192.168.1.0/24",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:5123",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.7, 192.168.1.10", "10.0.0.2"}},
+			wantCode:   http.StatusOK,
+		},
+		{
+			name:       "forged forwarded hop",
+			subnet:     "192.168.1.0/24",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:5123",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.168.1.10, 203.0.113.7"}},
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "invalid forwarded hop",
+			subnet:     "192.168.1.0/24",
+			proxies:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:5123",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.168.1.10, unknown"}},
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			name:       "proxy in the trusted subnet without headers",
+			subnet:     "10.0.0.0/8",
+			proxies:    []string{"10.0.0.1"},
+			remoteAddr: "10.0.0.1:5123",
+			wantCode:   http.StatusOK,
+		},
+		{name: "ipv4 mapped ipv6 client", subnet: "192.168.1.0/24", remoteAddr: "[::ffff:192.168.1.10]:5123", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTrustedSubnetMiddleware(tt.subnet, tt.proxies)
+			handler := tm.Restrict(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			request.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.headers {
+				for _, value := range values {
+					request.Header.Add(name, value)
+				}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, request)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestNewTrustedSubnetMiddleware_InvalidSubnet(t *testing.T) {
+	assert.Panics(t, func() { NewTrustedSubnetMiddleware("192.168.1.0/33", nil) })
+	assert.Panics(t, func() { NewTrustedSubnetMiddleware("192.168.1.0/24", []string{"proxy"}) })
+}
+
+func TestTrustedSubnetMiddleware_ResolveClientAddr(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    []string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:5123", want: "203.0.113.7"},
+		{name: "forged header without a trusted proxy", remoteAddr: "203.0.113.7:5123", headers: map[string]string{"X-Real-IP": "192.168.1.10"}, want: "203.0.113.7"},
+		{name: "real ip from a trusted proxy", proxies: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:5123", headers: map[string]string{"X-Real-IP": "198.51.100.4"}, want: "198.51.100.4"},
+		{name: "forwarded through a trusted proxy", proxies: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.1:5123", headers: map[string]string{"X-Forwarded-For": "198.51.100.4, 10.0.0.2"}, want: "198.51.100.4"},
+		{name: "unparsable peer", remoteAddr: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			tm := NewTrustedSubnetMiddleware("", tt.proxies)
+			handler := tm.ResolveClientAddr(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if addr, ok := appContext.ClientAddr(r.Context()); ok {
+					got = addr.String()
+				}
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				request.Header.Set(name, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
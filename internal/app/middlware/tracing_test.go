@@ -0,0 +1,91 @@
+package middlware
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	r := chi.NewRouter()
+	r.Use(Tracing)
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("test").Start(r.Context(), "handler")
+		span.End()
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	r.Post("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		traceparent string
+		wantName    string
+		wantRoute   string
+		wantCode    int
+		wantTraceID string
+		wantError   bool
+	}{
+		{
+			name:        "continues incoming trace",
+			method:      http.MethodGet,
+			path:        "/abc",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantName:    "GET /{id}",
+			wantRoute:   "/{id}",
+			wantCode:    http.StatusTemporaryRedirect,
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{name: "new trace", method: http.MethodGet, path: "/xyz", wantName: "GET /{id}", wantRoute: "/{id}", wantCode: http.StatusTemporaryRedirect},
+		{name: "server error", method: http.MethodPost, path: "/fail", wantName: "POST /fail", wantRoute: "/fail", wantCode: http.StatusInternalServerError, wantError: true},
+		{name: "unmatched route", method: http.MethodGet, path: "/a/b", wantName: "GET unmatched", wantRoute: unmatchedRoute, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+			request := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.traceparent != "" {
+				request.Header.Set("traceparent", tt.traceparent)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			assert.Equal(t, tt.wantCode, w.Code)
+
+			spans := recorder.Ended()[before:]
+			require.NotEmpty(t, spans)
+			server := spans[len(spans)-1]
+			assert.Equal(t, tt.wantName, server.Name())
+			assert.Contains(t, server.Attributes(), semconv.HTTPRoute(tt.wantRoute))
+			assert.Contains(t, server.Attributes(), semconv.HTTPStatusCode(tt.wantCode))
+			if tt.wantTraceID != "" {
+				assert.Equal(t, tt.wantTraceID, server.SpanContext().TraceID().String())
+				assert.True(t, server.Parent().IsRemote())
+			} else {
+				assert.False(t, server.Parent().IsValid())
+			}
+			if tt.wantError {
+				assert.Equal(t, codes.Error, server.Status().Code)
+			}
+			// spans started by the handler are children of the server span
+			for _, span := range spans[:len(spans)-1] {
+				assert.Equal(t, server.SpanContext().SpanID(), span.Parent().SpanID())
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"database/sql"
 	"github.com/google/uuid"
+	"time"
 )
 
 type (
@@ -13,10 +14,69 @@ type (
 		OriginalURL   string         `json:"original_url" db:"original_url"`
 		CorrelationID sql.NullString `json:"correlation_id" db:"correlation_id"`
 		DeletedFlag   bool           `json:"is_deleted" db:"is_deleted"`
+		DeletedAt     sql.NullTime   `json:"deleted_at" db:"deleted_at"` // when the link was soft deleted, it is purged after the retention
+		ExpiresAt     sql.NullTime   `json:"expires_at" db:"expires_at"`
+		ClicksLeft    sql.NullInt64  `json:"clicks_left" db:"clicks_left"`     // redirects left, unlimited when null
+		PasswordHash  sql.NullString `json:"password_hash" db:"password_hash"` // bcrypt hash, the link is public when null
 	}
 	//easyjson:json
 	UserURL struct {
 		UUID             uuid.UUID `json:"uuid" db:"uuid"`
 		ShortenedURLUUID uuid.UUID `json:"shortened_url_uuid" db:"shortened_url_uuid"`
 	}
+	// DeletionTask is an accepted request to soft delete some of a user's links, kept until it is applied.
+	//easyjson:json
+	DeletionTask struct {
+		ID           uuid.UUID `json:"id" db:"id"`
+		JobID        uuid.UUID `json:"job_id" db:"job_id"` // the delete request, large requests are split into several tasks
+		UserUID      uuid.UUID `json:"user_uid" db:"user_uuid"`
+		ShortURLKeys []string  `json:"short_urls" db:"-"`
+		CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	}
+	// DeletionJob tracks a delete request, URLs hold the outcome of every requested key.
+	DeletionJob struct {
+		ID        uuid.UUID
+		UserUID   uuid.UUID
+		Status    string
+		Error     string // the last failure, set for the failed status
+		URLs      []DeletionOutcome
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	DeletionOutcome struct {
+		ShortURL string
+		Result   string
+	}
+	//easyjson:json
+	Click struct {
+		ShortURL  string    `json:"short_url" db:"short_url"`
+		ClickedAt time.Time `json:"clicked_at" db:"clicked_at"`
+		Referrer  string    `json:"referrer,omitempty" db:"referrer"`
+		UserAgent string    `json:"user_agent,omitempty" db:"user_agent"`
+		IPPrefix  string    `json:"ip_prefix,omitempty" db:"ip_prefix"` // client network, the address itself is not stored
+	}
+	// ClickStats aggregates the clicks of a link within a time range, times are bucketed in UTC.
+	ClickStats struct {
+		Total          int64 `db:"total"`
+		UniqueVisitors int64 `db:"unique_visitors"` // distinct pairs of IP prefix and user agent
+		PerDay         []ClickCount
+		PerHour        []ClickCount
+		TopReferrers   []ClickCount
+		TopUserAgents  []ClickCount
+	}
+	ClickCount struct {
+		Value  string `db:"value"`
+		Clicks int64  `db:"clicks"`
+	}
+	ServiceStats struct {
+		URLs         int64 `db:"urls"`
+		Users        int64 `db:"users"` // users owning at least one link
+		DeletedURLs  int64 `db:"deleted_urls"`
+		RecentClicks int64 `db:"recent_clicks"`
+	}
 )
+
+// Expired reports whether the link has an expiration time that is not after now.
+func (s *ShortenedURL) Expired(now time.Time) bool {
+	return s.ExpiresAt.Valid && !s.ExpiresAt.Time.After(now)
+}
@@ -126,6 +126,14 @@ func easyjsonD2b7633eDecodeGithubComUjweghShortenerInternalAppModel1(in *jlexer.
 			easyjsonD2b7633eDecodeDatabaseSql(in, &out.CorrelationID)
 		case "is_deleted":
 			out.DeletedFlag = bool(in.Bool())
+		case "deleted_at":
+			easyjsonD2b7633eDecodeDatabaseSql1(in, &out.DeletedAt)
+		case "expires_at":
+			easyjsonD2b7633eDecodeDatabaseSql1(in, &out.ExpiresAt)
+		case "clicks_left":
+			easyjsonD2b7633eDecodeDatabaseSql2(in, &out.ClicksLeft)
+		case "password_hash":
+			easyjsonD2b7633eDecodeDatabaseSql(in, &out.PasswordHash)
 		default:
 			in.SkipRecursive()
 		}
@@ -165,6 +173,26 @@ func easyjsonD2b7633eEncodeGithubComUjweghShortenerInternalAppModel1(out *jwrite
 		out.RawString(prefix)
 		out.Bool(bool(in.DeletedFlag))
 	}
+	{
+		const prefix string = ",\"deleted_at\":"
+		out.RawString(prefix)
+		easyjsonD2b7633eEncodeDatabaseSql1(out, in.DeletedAt)
+	}
+	{
+		const prefix string = ",\"expires_at\":"
+		out.RawString(prefix)
+		easyjsonD2b7633eEncodeDatabaseSql1(out, in.ExpiresAt)
+	}
+	{
+		const prefix string = ",\"clicks_left\":"
+		out.RawString(prefix)
+		easyjsonD2b7633eEncodeDatabaseSql2(out, in.ClicksLeft)
+	}
+	{
+		const prefix string = ",\"password_hash\":"
+		out.RawString(prefix)
+		easyjsonD2b7633eEncodeDatabaseSql(out, in.PasswordHash)
+	}
 	out.RawByte('}')
 }
 
@@ -191,6 +219,106 @@ func (v *ShortenedURL) UnmarshalJSON(data []byte) error {
 func (v *ShortenedURL) UnmarshalEasyJSON(l *jlexer.Lexer) {
 	easyjsonD2b7633eDecodeGithubComUjweghShortenerInternalAppModel1(l, v)
 }
+func easyjsonD2b7633eDecodeDatabaseSql2(in *jlexer.Lexer, out *sql.NullInt64) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "Int64":
+			out.Int64 = int64(in.Int64())
+		case "Valid":
+			out.Valid = bool(in.Bool())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjsonD2b7633eEncodeDatabaseSql2(out *jwriter.Writer, in sql.NullInt64) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"Int64\":"
+		out.RawString(prefix[1:])
+		out.Int64(int64(in.Int64))
+	}
+	{
+		const prefix string = ",\"Valid\":"
+		out.RawString(prefix)
+		out.Bool(bool(in.Valid))
+	}
+	out.RawByte('}')
+}
+func easyjsonD2b7633eDecodeDatabaseSql1(in *jlexer.Lexer, out *sql.NullTime) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "Time":
+			if data := in.Raw(); in.Ok() {
+				in.AddError((out.Time).UnmarshalJSON(data))
+			}
+		case "Valid":
+			out.Valid = bool(in.Bool())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjsonD2b7633eEncodeDatabaseSql1(out *jwriter.Writer, in sql.NullTime) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"Time\":"
+		out.RawString(prefix[1:])
+		out.Raw((in.Time).MarshalJSON())
+	}
+	{
+		const prefix string = ",\"Valid\":"
+		out.RawString(prefix)
+		out.Bool(bool(in.Valid))
+	}
+	out.RawByte('}')
+}
 func easyjsonD2b7633eDecodeDatabaseSql(in *jlexer.Lexer, out *sql.NullString) {
 	isTopLevel := in.IsStart()
 	if in.IsNull() {
@@ -240,3 +368,233 @@ func easyjsonD2b7633eEncodeDatabaseSql(out *jwriter.Writer, in sql.NullString) {
 	}
 	out.RawByte('}')
 }
+func easyjsonD2b7633eDecodeGithubComUjweghShortenerInternalAppModel2(in *jlexer.Lexer, out *DeletionTask) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "id":
+			if data := in.UnsafeBytes(); in.Ok() {
+				in.AddError((out.ID).UnmarshalText(data))
+			}
+		case "job_id":
+			if data := in.UnsafeBytes(); in.Ok() {
+				in.AddError((out.JobID).UnmarshalText(data))
+			}
+		case "user_uid":
+			if data := in.UnsafeBytes(); in.Ok() {
+				in.AddError((out.UserUID).UnmarshalText(data))
+			}
+		case "short_urls":
+			if in.IsNull() {
+				in.Skip()
+				out.ShortURLKeys = nil
+			} else {
+				in.Delim('[')
+				if out.ShortURLKeys == nil {
+					if !in.IsDelim(']') {
+						out.ShortURLKeys = make([]string, 0, 4)
+					} else {
+						out.ShortURLKeys = []string{}
+					}
+				} else {
+					out.ShortURLKeys = (out.ShortURLKeys)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v1 string
+					v1 = string(in.String())
+					out.ShortURLKeys = append(out.ShortURLKeys, v1)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
+		case "created_at":
+			if data := in.Raw(); in.Ok() {
+				in.AddError((out.CreatedAt).UnmarshalJSON(data))
+			}
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjsonD2b7633eEncodeGithubComUjweghShortenerInternalAppModel2(out *jwriter.Writer, in DeletionTask) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"id\":"
+		out.RawString(prefix[1:])
+		out.RawText((in.ID).MarshalText())
+	}
+	{
+		const prefix string = ",\"job_id\":"
+		out.RawString(prefix)
+		out.RawText((in.JobID).MarshalText())
+	}
+	{
+		const prefix string = ",\"user_uid\":"
+		out.RawString(prefix)
+		out.RawText((in.UserUID).MarshalText())
+	}
+	{
+		const prefix string = ",\"short_urls\":"
+		out.RawString(prefix)
+		if in.ShortURLKeys == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v2, v3 := range in.ShortURLKeys {
+				if v2 > 0 {
+					out.RawByte(',')
+				}
+				out.String(string(v3))
+			}
+			out.RawByte(']')
+		}
+	}
+	{
+		const prefix string = ",\"created_at\":"
+		out.RawString(prefix)
+		out.Raw((in.CreatedAt).MarshalJSON())
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v DeletionTask) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjsonD2b7633eEncodeGithubComUjweghShortenerInternalAppModel2(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v DeletionTask) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjsonD2b7633eEncodeGithubComUjweghShortenerInternalAppModel2(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *DeletionTask) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjsonD2b7633eDecodeGithubComUjweghShortenerInternalAppModel2(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *DeletionTask) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjsonD2b7633eDecodeGithubComUjweghShortenerInternalAppModel2(l, v)
+}
+func easyjsonD2b7633eDecodeGithubComUjweghShortenerInternalAppModel3(in *jlexer.Lexer, out *Click) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "short_url":
+			out.ShortURL = string(in.String())
+		case "clicked_at":
+			if data := in.Raw(); in.Ok() {
+				in.AddError((out.ClickedAt).UnmarshalJSON(data))
+			}
+		case "referrer":
+			out.Referrer = string(in.String())
+		case "user_agent":
+			out.UserAgent = string(in.String())
+		case "ip_prefix":
+			out.IPPrefix = string(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjsonD2b7633eEncodeGithubComUjweghShortenerInternalAppModel3(out *jwriter.Writer, in Click) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"short_url\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.ShortURL))
+	}
+	{
+		const prefix string = ",\"clicked_at\":"
+		out.RawString(prefix)
+		out.Raw((in.ClickedAt).MarshalJSON())
+	}
+	if in.Referrer != "" {
+		const prefix string = ",\"referrer\":"
+		out.RawString(prefix)
+		out.String(string(in.Referrer))
+	}
+	if in.UserAgent != "" {
+		const prefix string = ",\"user_agent\":"
+		out.RawString(prefix)
+		out.String(string(in.UserAgent))
+	}
+	if in.IPPrefix != "" {
+		const prefix string = ",\"ip_prefix\":"
+		out.RawString(prefix)
+		out.String(string(in.IPPrefix))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v Click) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjsonD2b7633eEncodeGithubComUjweghShortenerInternalAppModel3(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v Click) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjsonD2b7633eEncodeGithubComUjweghShortenerInternalAppModel3(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *Click) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjsonD2b7633eDecodeGithubComUjweghShortenerInternalAppModel3(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *Click) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjsonD2b7633eDecodeGithubComUjweghShortenerInternalAppModel3(l, v)
+}
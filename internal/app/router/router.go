@@ -3,24 +3,38 @@ package router
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/ujwegh/shortener/internal/app/handlers"
+	"github.com/ujwegh/shortener/internal/app/metrics"
 	"github.com/ujwegh/shortener/internal/app/middlware"
 )
 
-func NewAppRouter(sh *handlers.ShortenerHandlers, am middlware.AuthMiddleware) *chi.Mux {
+func NewAppRouter(sh *handlers.ShortenerHandlers, am middlware.AuthMiddleware, tm middlware.TrustedSubnetMiddleware) *chi.Mux {
 	r := chi.NewRouter()
 
-	r.Use(middlware.RequestLogger)
-	r.Use(middlware.ResponseLogger)
-	r.Use(middlware.RequestZipper)
-	r.Use(middlware.ResponseZipper)
-	r.Use(am.Authenticate)
+	r.Use(middlware.Metrics)
+	// scrapes are neither traced, logged nor authenticated
+	r.Handle("/metrics", metrics.Handler())
 
-	r.Post("/", sh.ShortenURL)
-	r.Get("/ping", sh.Ping)
-	r.Post("/api/shorten", sh.APIShortenURL)
-	r.Post("/api/shorten/batch", sh.APIShortenURLBatch)
-	r.Get("/api/user/urls", sh.APIGetUserURLs)
-	r.Delete("/api/user/urls", sh.APIDeleteUserURLs)
-	r.Get("/{id}", sh.HandleShortenedURL)
+	r.Group(func(r chi.Router) {
+		r.Use(middlware.Tracing)
+		r.Use(middlware.RequestLogger)
+		r.Use(middlware.ResponseLogger)
+		r.Use(middlware.RequestZipper)
+		r.Use(middlware.ResponseZipper)
+		r.Use(am.Authenticate)
+		r.Use(tm.ResolveClientAddr)
+
+		r.Post("/", sh.ShortenURL)
+		r.Get("/ping", sh.Ping)
+		r.Post("/api/shorten", sh.APIShortenURL)
+		r.Post("/api/shorten/batch", sh.APIShortenURLBatch)
+		r.Get("/api/user/urls", sh.APIGetUserURLs)
+		r.Delete("/api/user/urls", sh.APIDeleteUserURLs)
+		r.Post("/api/user/urls/restore", sh.APIRestoreUserURLs)
+		r.Get("/api/user/urls/deletions/{jobID}", sh.APIGetDeletionJob)
+		r.Get("/api/user/urls/{id}/stats", sh.APIGetURLStats)
+		r.With(tm.Restrict).Get("/api/internal/stats", sh.APIInternalStats)
+		r.Get("/{id}", sh.HandleShortenedURL)
+		r.Post("/{id}", sh.UnlockShortenedURL)
+	})
 	return r
 }
@@ -8,10 +8,12 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/mailru/easyjson"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/ujwegh/shortener/internal/app/config"
 	"github.com/ujwegh/shortener/internal/app/handlers"
+	"github.com/ujwegh/shortener/internal/app/metrics"
 	"github.com/ujwegh/shortener/internal/app/middlware"
 	"github.com/ujwegh/shortener/internal/app/model"
 	"github.com/ujwegh/shortener/internal/app/service"
@@ -20,6 +22,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 type MockStorage struct {
@@ -67,19 +70,48 @@ func (s MockStorage) DeleteBulk(ctx context.Context, buffer map[uuid.UUID][]stri
 	return nil
 }
 
+func (s *MockStorage) RestoreBulk(ctx context.Context, userUID uuid.UUID, shortURLs []string) ([]string, error) {
+	return nil, nil
+}
+
+func (s *MockStorage) ConsumeClick(ctx context.Context, shortURL string) (bool, error) {
+	return true, nil
+}
+
+func (s *MockStorage) WriteClicks(ctx context.Context, clicks []model.Click) error {
+	return nil
+}
+
+func (s *MockStorage) ReadClickStats(ctx context.Context, shortURL string, from, to time.Time, top int) (*model.ClickStats, error) {
+	return &model.ClickStats{}, nil
+}
+
+func (s *MockStorage) ReadServiceStats(ctx context.Context, clicksSince time.Time) (*model.ServiceStats, error) {
+	return &model.ServiceStats{}, nil
+}
+
+func (s *MockStorage) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	return 0, nil
+}
+
+func (s *MockStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int,
+	archive func([]model.ShortenedURL) error) (int, error) {
+	return 0, nil
+}
+
 func TestRequestZipper(t *testing.T) {
 	// Setup
-	c := config.AppConfig{}
+	c := config.AppConfig{TokenSecretKey: "secret"}
 	s := &MockStorage{
 		urlMap:   make(map[string]model.ShortenedURL),
 		userURLs: make([]model.ShortenedURL, 0),
 	}
 	tasks := make(chan service.Task)
 	ss := service.NewShortenerService(s, tasks)
-	sh := handlers.NewShortenerHandlers(c.ShortenedURLAddr, 5, ss, s)
+	sh := handlers.NewShortenerHandlers(c.ShortenedURLAddr, 5, ss, s, service.NewTokenService(c), c.LinkAccessTTLSec)
 	tsc := service.NewTokenService(c)
 	am := middlware.NewAuthMiddleware(tsc)
-	router := NewAppRouter(sh, am)
+	router := NewAppRouter(sh, am, middlware.NewTrustedSubnetMiddleware(c.TrustedSubnet, nil))
 	ts := httptest.NewServer(router)
 	defer ts.Close()
 
@@ -194,3 +226,49 @@ func TestRequestZipper(t *testing.T) {
 		})
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	c := config.AppConfig{TokenSecretKey: "secret"}
+	s := &MockStorage{
+		urlMap:   map[string]model.ShortenedURL{"edVPg3ks": {ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}},
+		userURLs: make([]model.ShortenedURL, 0),
+	}
+	ss := service.NewShortenerService(s, make(chan service.Task))
+	sh := handlers.NewShortenerHandlers(c.ShortenedURLAddr, 5, ss, s, service.NewTokenService(c), c.LinkAccessTTLSec)
+	router := NewAppRouter(sh, middlware.NewAuthMiddleware(service.NewTokenService(c)),
+		middlware.NewTrustedSubnetMiddleware(c.TrustedSubnet, nil))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	redirects := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/{id}", "307"))
+	misses := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/{id}", "404"))
+	unmatched := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404"))
+	hits := testutil.ToFloat64(metrics.Redirects.WithLabelValues(metrics.RedirectHit))
+	missed := testutil.ToFloat64(metrics.Redirects.WithLabelValues(metrics.RedirectMiss))
+
+	for _, path := range []string{"/edVPg3ks", "/edVPg3ks", "/unknown1", "/a/b/c"} {
+		resp, err := client.Get(ts.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	// every short key is counted under the route pattern
+	assert.Equal(t, redirects+2, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/{id}", "307")))
+	assert.Equal(t, misses+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/{id}", "404")))
+	assert.Equal(t, unmatched+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")))
+	assert.Equal(t, hits+2, testutil.ToFloat64(metrics.Redirects.WithLabelValues(metrics.RedirectHit)))
+	assert.Equal(t, missed+1, testutil.ToFloat64(metrics.Redirects.WithLabelValues(metrics.RedirectMiss)))
+
+	resp, err := client.Get(ts.URL + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `shortener_http_requests_total{code="307",method="GET",route="/{id}"}`)
+	assert.NotContains(t, string(body), "edVPg3ks")
+	assert.Empty(t, resp.Cookies(), "scrapes are not authenticated")
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+var (
+	ErrInvalidAlias = errors.New("invalid alias")
+	ErrAliasTaken   = errors.New("alias is already taken")
+)
+
+// reservedAliases would shadow the service routes or are likely to be needed for them later.
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"ping":    {},
+	"metrics": {},
+	"health":  {},
+	"healthz": {},
+	"debug":   {},
+	"static":  {},
+	"admin":   {},
+	"login":   {},
+	"logout":  {},
+}
+
+// AliasError reports which custom alias was rejected.
+type AliasError struct {
+	Alias string
+	Err   error
+}
+
+func (e *AliasError) Error() string {
+	return fmt.Sprintf("alias %q: %v", e.Alias, e.Err)
+}
+
+func (e *AliasError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateAlias checks that a custom short key consists of latin letters, digits, '-' and '_'
+// and does not shadow a reserved path.
+func ValidateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return &AliasError{Alias: alias, Err: fmt.Errorf("%w: length must be from %d to %d symbols",
+			ErrInvalidAlias, minAliasLength, maxAliasLength)}
+	}
+	for _, r := range alias {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return &AliasError{Alias: alias, Err: fmt.Errorf("%w: symbol %q is not allowed", ErrInvalidAlias, r)}
+		}
+	}
+	if isReserved(alias) {
+		return &AliasError{Alias: alias, Err: fmt.Errorf("%w: the word is reserved", ErrInvalidAlias)}
+	}
+	return nil
+}
+
+func isReserved(key string) bool {
+	_, ok := reservedAliases[strings.ToLower(key)]
+	return ok
+}
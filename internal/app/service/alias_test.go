@@ -0,0 +1,33 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		alias   string
+		wantErr bool
+	}{
+		{alias: "spring-sale", wantErr: false},
+		{alias: "Sale_2024", wantErr: false},
+		{alias: "ab", wantErr: true},
+		{alias: strings.Repeat("a", maxAliasLength+1), wantErr: true},
+		{alias: "sale/2024", wantErr: true},
+		{alias: "распродажа", wantErr: true},
+		{alias: "api", wantErr: true},
+		{alias: "PING", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			err := ValidateAlias(tt.alias)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAlias)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
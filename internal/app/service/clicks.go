@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	clickBatchSize     = 100
+	clickFlushInterval = time.Second
+	// topClickValues bounds the referrer and user agent lists of the link statistics
+	topClickValues = 10
+)
+
+var ErrNotOwner = errors.New("shortened URL belongs to another user")
+
+type (
+	ClickStats struct {
+		Recorded int64
+		Dropped  int64
+	}
+	clickCounters struct {
+		recorded atomic.Int64
+		dropped  atomic.Int64
+		// dropped events not reported to the log yet
+		unreported atomic.Int64
+	}
+)
+
+// RecordClick queues a redirect event without blocking the redirect, the event is dropped when the queue is full.
+func (ss *ShortenerServiceImpl) RecordClick(click model.Click) {
+	if ss.clickChannel == nil {
+		return
+	}
+	select {
+	case ss.clickChannel <- click:
+		ss.clicks.recorded.Add(1)
+	default:
+		ss.clicks.dropped.Add(1)
+		ss.clicks.unreported.Add(1)
+	}
+}
+
+func (ss *ShortenerServiceImpl) ClickStats() ClickStats {
+	return ClickStats{
+		Recorded: ss.clicks.recorded.Load(),
+		Dropped:  ss.clicks.dropped.Load(),
+	}
+}
+
+// GetClickStats aggregates the clicks of a link owned by the user within [from, to).
+func (ss *ShortenerServiceImpl) GetClickStats(ctx context.Context, userUID *uuid.UUID, shortURL string, from, to time.Time) (*model.ClickStats, error) {
+	userURLs, err := ss.storage.ReadUserURLs(ctx, userUID)
+	if err != nil {
+		return nil, err
+	}
+	owned := false
+	for _, userURL := range userURLs {
+		if userURL.ShortURL == shortURL {
+			owned = true
+			break
+		}
+	}
+	if !owned {
+		shortenedURL, err := ss.storage.ReadShortenedURL(ctx, shortURL)
+		if err != nil {
+			return nil, err
+		}
+		// the memory and file storages report a missing key with an empty record
+		if shortenedURL.OriginalURL == "" {
+			return nil, storage.ErrNotFound
+		}
+		return nil, ErrNotOwner
+	}
+	return ss.storage.ReadClickStats(ctx, shortURL, from, to, topClickValues)
+}
+
+// ClickProcess persists queued click events in batches until the channel is closed or ctx is done.
+func (ss *ShortenerServiceImpl) ClickProcess(ctx context.Context, clickChannel <-chan model.Click) {
+	buffer := make([]model.Click, 0, clickBatchSize)
+
+	ticker := time.NewTicker(clickFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case click, ok := <-clickChannel:
+			if !ok {
+				writeClicks(ss, buffer)
+				return
+			}
+			buffer = append(buffer, click)
+			if len(buffer) >= clickBatchSize {
+				writeClicks(ss, buffer)
+				buffer = make([]model.Click, 0, clickBatchSize)
+			}
+		case <-ticker.C:
+			writeClicks(ss, buffer)
+			buffer = make([]model.Click, 0, clickBatchSize)
+		case <-ctx.Done():
+			// the server has stopped serving redirects, so the events left in the queue are final
+			for {
+				select {
+				case click, ok := <-clickChannel:
+					if ok {
+						buffer = append(buffer, click)
+						continue
+					}
+				default:
+				}
+				break
+			}
+			writeClicks(ss, buffer)
+			return
+		}
+	}
+}
+
+func writeClicks(ss *ShortenerServiceImpl, clicks []model.Click) {
+	if dropped := ss.clicks.unreported.Swap(0); dropped > 0 {
+		logger.Log.Warn("click events dropped, the queue is full", zap.Int64("count", dropped))
+	}
+	if len(clicks) == 0 {
+		return
+	}
+	err := ss.storage.WriteClicks(context.Background(), clicks)
+	if err != nil {
+		logger.Log.Error("failed to write click events", zap.Error(err), zap.Int("count", len(clicks)))
+	}
+}
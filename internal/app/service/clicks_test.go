@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"sync"
+	"testing"
+	"time"
+)
+
+type clickRecordingStorage struct {
+	storage.Storage
+	mutex   sync.Mutex
+	batches [][]model.Click
+}
+
+func (cs *clickRecordingStorage) WriteClicks(ctx context.Context, clicks []model.Click) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.batches = append(cs.batches, clicks)
+	return nil
+}
+
+func (cs *clickRecordingStorage) written() (batches, clicks int) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	for _, batch := range cs.batches {
+		clicks += len(batch)
+	}
+	return len(cs.batches), clicks
+}
+
+func TestShortenerServiceImpl_ClickProcess(t *testing.T) {
+	tests := []struct {
+		name        string
+		clicks      int
+		wantBatches int
+		stop        func(cancel context.CancelFunc, clickChannel chan model.Click)
+	}{
+		{
+			name:        "flushed by ticker",
+			clicks:      3,
+			wantBatches: 1,
+		},
+		{
+			name:        "flushed by batch size",
+			clicks:      clickBatchSize * 2,
+			wantBatches: 2,
+		},
+		{
+			name:        "flushed on cancel",
+			clicks:      5,
+			wantBatches: 1,
+			stop:        func(cancel context.CancelFunc, clickChannel chan model.Click) { cancel() },
+		},
+		{
+			name:        "flushed on close",
+			clicks:      5,
+			wantBatches: 1,
+			stop:        func(cancel context.CancelFunc, clickChannel chan model.Click) { close(clickChannel) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &clickRecordingStorage{Storage: storage.NewMemoryStorage()}
+			clickChannel := make(chan model.Click, tt.clicks)
+			ss := NewShortenerService(backend, nil, WithClickChannel(clickChannel))
+			for i := 0; i < tt.clicks; i++ {
+				ss.RecordClick(model.Click{ShortURL: "edVPg3ks", ClickedAt: time.Now()})
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan struct{})
+			if tt.stop != nil {
+				tt.stop(cancel, clickChannel)
+			}
+			go func() {
+				ss.ClickProcess(ctx, clickChannel)
+				close(done)
+			}()
+			if tt.stop != nil {
+				<-done
+			}
+			require.Eventually(t, func() bool {
+				_, clicks := backend.written()
+				return clicks == tt.clicks
+			}, 3*clickFlushInterval, 10*time.Millisecond)
+			batches, _ := backend.written()
+			assert.Equal(t, tt.wantBatches, batches)
+		})
+	}
+}
+
+func TestShortenerServiceImpl_RecordClick_QueueFull(t *testing.T) {
+	clickChannel := make(chan model.Click, 2)
+	ss := NewShortenerService(storage.NewMemoryStorage(), nil, WithClickChannel(clickChannel))
+	for i := 0; i < 5; i++ {
+		ss.RecordClick(model.Click{ShortURL: "edVPg3ks"})
+	}
+	assert.Equal(t, ClickStats{Recorded: 2, Dropped: 3}, ss.ClickStats())
+	assert.Len(t, clickChannel, 2)
+
+	// recording is disabled without a channel
+	ss = NewShortenerService(storage.NewMemoryStorage(), nil)
+	ss.RecordClick(model.Click{ShortURL: "edVPg3ks"})
+	assert.Equal(t, ClickStats{}, ss.ClickStats())
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"sync"
+	"time"
+)
+
+const (
+	JobQueued  = "queued"
+	JobApplied = "applied"
+	JobFailed  = "failed"
+)
+
+const (
+	URLPending  = "pending"
+	URLDeleted  = "deleted"
+	URLNotFound = "not_found"
+	URLNotOwned = "not_owned"
+	URLUnknown  = "unknown" // the outcome could not be read back from the storage
+)
+
+// jobRetention is how long the status of a finished job stays available.
+const jobRetention = 24 * time.Hour
+
+var ErrJobNotFound = errors.New("deletion job not found")
+
+// GetDeletionJob returns the state of a delete request, jobs of other users are not found.
+func (ss *ShortenerServiceImpl) GetDeletionJob(ctx context.Context, userUID *uuid.UUID, jobID uuid.UUID) (*model.DeletionJob, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	job, ok := ss.jobs.get(jobID)
+	if !ok || job.UserUID != *userUID {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// resolveOutcomes tells for every key of the applied tasks whether it was deleted,
+// unknown or owned by someone else.
+func (ss *ShortenerServiceImpl) resolveOutcomes(ctx context.Context, tasks []Task) map[uuid.UUID]map[string]string {
+	owned := make(map[uuid.UUID]map[string]struct{})
+	outcomes := make(map[uuid.UUID]map[string]string)
+	for _, task := range tasks {
+		keys, ok := owned[task.UserUID]
+		if !ok {
+			keys = make(map[string]struct{})
+			userUID := task.UserUID
+			userURLs, err := ss.storage.ReadUserURLs(ctx, &userUID)
+			if err == nil {
+				for _, userURL := range userURLs {
+					keys[userURL.ShortURL] = struct{}{}
+				}
+			}
+			owned[task.UserUID] = keys
+		}
+		if outcomes[task.UserUID] == nil {
+			outcomes[task.UserUID] = make(map[string]string)
+		}
+		for _, key := range task.ShortURLKeys {
+			if _, ok := keys[key]; ok {
+				outcomes[task.UserUID][key] = URLDeleted
+				continue
+			}
+			shortenedURL, err := ss.storage.ReadShortenedURL(ctx, key)
+			switch {
+			case errors.Is(err, storage.ErrNotFound) || err == nil && shortenedURL.OriginalURL == "":
+				outcomes[task.UserUID][key] = URLNotFound
+			case err != nil:
+				outcomes[task.UserUID][key] = URLUnknown
+			default:
+				outcomes[task.UserUID][key] = URLNotOwned
+			}
+		}
+	}
+	return outcomes
+}
+
+type (
+	deletionJobs struct {
+		jobs  map[uuid.UUID]*deletionJob
+		mutex sync.Mutex
+		now   func() time.Time
+	}
+	deletionJob struct {
+		model.DeletionJob
+		tasks map[uuid.UUID]bool // task ID -> applied
+	}
+)
+
+func newDeletionJobs() *deletionJobs {
+	return &deletionJobs{jobs: make(map[uuid.UUID]*deletionJob), now: time.Now}
+}
+
+// register starts tracking the tasks of a job, tasks replayed from the deletion queue
+// recreate the jobs of a previous run.
+func (dj *deletionJobs) register(tasks []Task) {
+	dj.mutex.Lock()
+	defer dj.mutex.Unlock()
+	now := dj.now()
+	dj.evict(now)
+	for _, task := range tasks {
+		job, ok := dj.jobs[jobID(task)]
+		if !ok {
+			job = &deletionJob{
+				DeletionJob: model.DeletionJob{
+					ID:        jobID(task),
+					UserUID:   task.UserUID,
+					Status:    JobQueued,
+					CreatedAt: task.CreatedAt,
+					UpdatedAt: now,
+				},
+				tasks: make(map[uuid.UUID]bool),
+			}
+			dj.jobs[job.ID] = job
+		}
+		if _, ok := job.tasks[task.ID]; ok {
+			continue
+		}
+		job.tasks[task.ID] = false
+		for _, key := range task.ShortURLKeys {
+			job.URLs = append(job.URLs, model.DeletionOutcome{ShortURL: key, Result: URLPending})
+		}
+	}
+}
+
+// applied records the outcomes of applied tasks, a job is applied once all of its tasks are.
+func (dj *deletionJobs) applied(tasks []Task, outcomes map[uuid.UUID]map[string]string) {
+	dj.mutex.Lock()
+	defer dj.mutex.Unlock()
+	now := dj.now()
+	for _, task := range tasks {
+		job, ok := dj.jobs[jobID(task)]
+		if !ok {
+			continue
+		}
+		job.tasks[task.ID] = true
+		keys := make(map[string]struct{}, len(task.ShortURLKeys))
+		for _, key := range task.ShortURLKeys {
+			keys[key] = struct{}{}
+		}
+		for i, url := range job.URLs {
+			if _, ok := keys[url.ShortURL]; ok {
+				job.URLs[i].Result = outcomes[task.UserUID][url.ShortURL]
+			}
+		}
+		job.UpdatedAt = now
+		if job.done() {
+			job.Status = JobApplied
+			job.Error = ""
+		}
+	}
+}
+
+// failed marks the jobs of tasks that could not be applied, queued tasks are retried later.
+func (dj *deletionJobs) failed(tasks []Task, err error) {
+	dj.mutex.Lock()
+	defer dj.mutex.Unlock()
+	now := dj.now()
+	for _, task := range tasks {
+		if job, ok := dj.jobs[jobID(task)]; ok {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			job.UpdatedAt = now
+		}
+	}
+}
+
+func (dj *deletionJobs) get(id uuid.UUID) (*model.DeletionJob, bool) {
+	dj.mutex.Lock()
+	defer dj.mutex.Unlock()
+	job, ok := dj.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	result := job.DeletionJob
+	result.URLs = append([]model.DeletionOutcome(nil), job.URLs...)
+	return &result, true
+}
+
+// evict forgets jobs that have not changed for jobRetention, they are finished by then.
+func (dj *deletionJobs) evict(now time.Time) {
+	for id, job := range dj.jobs {
+		if job.Status != JobQueued && now.Sub(job.UpdatedAt) > jobRetention {
+			delete(dj.jobs, id)
+		}
+	}
+}
+
+func (job *deletionJob) done() bool {
+	for _, applied := range job.tasks {
+		if !applied {
+			return false
+		}
+	}
+	return true
+}
+
+// jobID falls back to the task ID for tasks queued before jobs existed.
+func jobID(task Task) uuid.UUID {
+	if task.JobID == uuid.Nil {
+		return task.ID
+	}
+	return task.JobID
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"math/bits"
+	"strings"
+)
+
+const (
+	KeyModeRandom     = "random"
+	KeyModeSequential = "sequential"
+
+	DefaultKeyLength   = 8
+	DefaultKeyAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+)
+
+var ErrKeySpaceExhausted = errors.New("short key space exhausted")
+
+type (
+	// KeyGenerator produces candidate short keys, the storage rejects the ones already taken.
+	KeyGenerator interface {
+		Generate(ctx context.Context) (string, error)
+	}
+	RandomKeyGenerator struct {
+		length   int
+		alphabet []byte
+		// random bytes at or above the limit are dropped so every symbol is equally likely
+		limit int
+	}
+)
+
+// NewKeyGenerator creates the generator selected by cfg.ShortKeyMode, the sequential one
+// allocates IDs from the storage.
+func NewKeyGenerator(cfg config.AppConfig, s storage.Storage) KeyGenerator {
+	switch cfg.ShortKeyMode {
+	case "", KeyModeRandom:
+		return NewRandomKeyGenerator(cfg.ShortKeyLength, cfg.ShortKeyAlphabet)
+	case KeyModeSequential:
+		sequencer, ok := s.(storage.Sequencer)
+		if !ok {
+			panic(fmt.Sprintf("storage %T does not support sequential short keys", s))
+		}
+		return NewSequentialKeyGenerator(sequencer, cfg.ShortKeyLength, cfg.ShortKeySeed)
+	default:
+		panic(fmt.Sprintf("unknown short key mode %q", cfg.ShortKeyMode))
+	}
+}
+
+func NewRandomKeyGenerator(length int, alphabet string) *RandomKeyGenerator {
+	if length <= 0 {
+		panic(fmt.Sprintf("invalid short key length %d", length))
+	}
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		panic(fmt.Sprintf("short key alphabet must have from 2 to 256 symbols, got %d", len(alphabet)))
+	}
+	seen := make(map[byte]struct{}, len(alphabet))
+	for i := 0; i < len(alphabet); i++ {
+		if _, ok := seen[alphabet[i]]; ok {
+			panic(fmt.Sprintf("duplicate symbol %q in short key alphabet", alphabet[i]))
+		}
+		seen[alphabet[i]] = struct{}{}
+	}
+	return &RandomKeyGenerator{
+		length:   length,
+		alphabet: []byte(alphabet),
+		limit:    256 - 256%len(alphabet),
+	}
+}
+
+func (g *RandomKeyGenerator) Generate(ctx context.Context) (string, error) {
+	key := make([]byte, 0, g.length)
+	buf := make([]byte, g.length*2)
+	for len(key) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("read random bytes: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) >= g.limit {
+				continue
+			}
+			key = append(key, g.alphabet[int(b)%len(g.alphabet)])
+			if len(key) == g.length {
+				break
+			}
+		}
+	}
+	return string(key), nil
+}
+
+const (
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// 62^11 does not fit into uint64
+	maxObfuscatedKeyLength = 10
+	feistelRounds          = 8
+)
+
+// SequentialKeyGenerator encodes IDs of a storage sequence in base62. With a seed the IDs are
+// mapped by a keyed permutation of [0, 62^length) first, keys then have a fixed length and
+// neither reveal the ID nor let anyone derive other keys without the seed. The permutation is
+// a Feistel network over the smallest even number of bits covering the key space, values
+// outside of it are encrypted again (cycle walking) until they fall into it.
+type SequentialKeyGenerator struct {
+	sequencer storage.Sequencer
+	obfuscate bool
+	length    int
+	space     uint64 // 62^length
+	halfBits  uint
+	key       []byte
+}
+
+func NewSequentialKeyGenerator(sequencer storage.Sequencer, length int, seed string) *SequentialKeyGenerator {
+	g := &SequentialKeyGenerator{sequencer: sequencer}
+	if seed == "" {
+		return g
+	}
+	if length <= 0 || length > maxObfuscatedKeyLength {
+		panic(fmt.Sprintf("obfuscated short key length must be from 1 to %d, got %d", maxObfuscatedKeyLength, length))
+	}
+	g.obfuscate, g.length, g.space = true, length, 1
+	for i := 0; i < length; i++ {
+		g.space *= uint64(len(base62Alphabet))
+	}
+	g.halfBits = uint(bits.Len64(g.space-1)+1) / 2
+	sum := sha256.Sum256([]byte(seed))
+	g.key = sum[:]
+	return g
+}
+
+func (g *SequentialKeyGenerator) Generate(ctx context.Context) (string, error) {
+	id, err := g.sequencer.NextID(ctx)
+	if err != nil {
+		return "", fmt.Errorf("allocate id: %w", err)
+	}
+	if !g.obfuscate {
+		return encodeBase62(id, 0), nil
+	}
+	if id >= g.space {
+		return "", fmt.Errorf("%w: id %d does not fit into %d symbols", ErrKeySpaceExhausted, id, g.length)
+	}
+	value := g.encrypt(id)
+	for value >= g.space {
+		value = g.encrypt(value)
+	}
+	return encodeBase62(value, g.length), nil
+}
+
+// Decode returns the sequence ID a key was generated from.
+func (g *SequentialKeyGenerator) Decode(key string) (uint64, error) {
+	if g.obfuscate && len(key) != g.length {
+		return 0, fmt.Errorf("invalid key length %d", len(key))
+	}
+	value, err := decodeBase62(key)
+	if err != nil {
+		return 0, err
+	}
+	if !g.obfuscate {
+		return value, nil
+	}
+	if value >= g.space {
+		return 0, fmt.Errorf("key %q is out of the key space", key)
+	}
+	id := g.decrypt(value)
+	for id >= g.space {
+		id = g.decrypt(id)
+	}
+	return id, nil
+}
+
+func (g *SequentialKeyGenerator) encrypt(value uint64) uint64 {
+	mask := uint64(1)<<g.halfBits - 1
+	left, right := value>>g.halfBits, value&mask
+	for round := 0; round < feistelRounds; round++ {
+		left, right = right, left^g.round(round, right)&mask
+	}
+	return left<<g.halfBits | right
+}
+
+func (g *SequentialKeyGenerator) decrypt(value uint64) uint64 {
+	mask := uint64(1)<<g.halfBits - 1
+	left, right := value>>g.halfBits, value&mask
+	for round := feistelRounds - 1; round >= 0; round-- {
+		left, right = right^g.round(round, left)&mask, left
+	}
+	return left<<g.halfBits | right
+}
+
+// round is the keyed round function of the Feistel network.
+func (g *SequentialKeyGenerator) round(round int, half uint64) uint64 {
+	var buf [9]byte
+	buf[0] = byte(round)
+	binary.BigEndian.PutUint64(buf[1:], half)
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(buf[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// encodeBase62 left pads the result with zero symbols up to length.
+func encodeBase62(value uint64, length int) string {
+	buf := make([]byte, 0, 11)
+	for value > 0 {
+		buf = append(buf, base62Alphabet[value%62])
+		value /= 62
+	}
+	for len(buf) < length || len(buf) == 0 {
+		buf = append(buf, base62Alphabet[0])
+	}
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf)
+}
+
+func decodeBase62(key string) (uint64, error) {
+	if key == "" || len(key) > 11 {
+		return 0, fmt.Errorf("invalid base62 key %q", key)
+	}
+	var value uint64
+	for i := 0; i < len(key); i++ {
+		digit := strings.IndexByte(base62Alphabet, key[i])
+		if digit < 0 {
+			return 0, fmt.Errorf("invalid base62 symbol %q", key[i])
+		}
+		hi, lo := bits.Mul64(value, 62)
+		sum, carry := bits.Add64(lo, uint64(digit), 0)
+		if hi != 0 || carry != 0 {
+			return 0, fmt.Errorf("base62 key %q overflows", key)
+		}
+		value = sum
+	}
+	return value, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"strings"
+	"testing"
+)
+
+func TestRandomKeyGenerator_Generate(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   int
+		alphabet string
+	}{
+		{name: "default", length: DefaultKeyLength, alphabet: DefaultKeyAlphabet},
+		{name: "digits", length: 12, alphabet: "0123456789"},
+		{name: "binary", length: 3, alphabet: "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewRandomKeyGenerator(tt.length, tt.alphabet)
+			for i := 0; i < 100; i++ {
+				key, err := g.Generate(context.Background())
+				require.NoError(t, err)
+				assert.Len(t, key, tt.length)
+				for _, r := range key {
+					assert.True(t, strings.ContainsRune(tt.alphabet, r), "unexpected symbol %q", r)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRandomKeyGenerator_Invalid(t *testing.T) {
+	assert.Panics(t, func() { NewRandomKeyGenerator(0, DefaultKeyAlphabet) })
+	assert.Panics(t, func() { NewRandomKeyGenerator(8, "a") })
+	assert.Panics(t, func() { NewRandomKeyGenerator(8, "abca") })
+}
+
+func TestSequentialKeyGenerator_Generate(t *testing.T) {
+	ctx := context.Background()
+	g := NewSequentialKeyGenerator(storage.NewMemoryStorage(), 0, "")
+	for _, want := range []string{"1", "2", "3"} {
+		key, err := g.Generate(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, key)
+	}
+	for i := 3; i < 61; i++ {
+		_, err := g.Generate(ctx)
+		require.NoError(t, err)
+	}
+	key, err := g.Generate(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "10", key)
+}
+
+func TestSequentialKeyGenerator_Obfuscated(t *testing.T) {
+	ctx := context.Background()
+	g := NewSequentialKeyGenerator(storage.NewMemoryStorage(), 6, "secret")
+	other := NewSequentialKeyGenerator(storage.NewMemoryStorage(), 6, "another secret")
+	seen := make(map[string]struct{})
+	for id := uint64(1); id <= 1000; id++ {
+		key, err := g.Generate(ctx)
+		require.NoError(t, err)
+		assert.Len(t, key, 6)
+		_, duplicate := seen[key]
+		require.False(t, duplicate, "key %s generated twice", key)
+		seen[key] = struct{}{}
+
+		decoded, err := g.Decode(key)
+		require.NoError(t, err)
+		assert.Equal(t, id, decoded)
+
+		otherKey, err := other.Generate(ctx)
+		require.NoError(t, err)
+		assert.NotEqual(t, key, otherKey)
+	}
+}
+
+func TestSequentialKeyGenerator_Permutation(t *testing.T) {
+	ctx := context.Background()
+	g := NewSequentialKeyGenerator(storage.NewMemoryStorage(), 2, "secret")
+	seen := make(map[uint64]struct{})
+	steps := make(map[uint64]struct{})
+	var previous uint64
+	for id := uint64(1); id < 62*62; id++ {
+		key, err := g.Generate(ctx)
+		require.NoError(t, err)
+		value, err := decodeBase62(key)
+		require.NoError(t, err)
+		seen[value] = struct{}{}
+		// an affine map would step by the same multiplier every time
+		steps[(value+62*62-previous)%(62*62)] = struct{}{}
+		previous = value
+	}
+	assert.Len(t, seen, 62*62-1, "the permutation is a bijection of the key space")
+	assert.Greater(t, len(steps), 62*62/2)
+}
+
+func TestSequentialKeyGenerator_Exhausted(t *testing.T) {
+	ctx := context.Background()
+	g := NewSequentialKeyGenerator(storage.NewMemoryStorage(), 1, "secret")
+	seen := make(map[string]struct{})
+	for i := 1; i < 62; i++ {
+		key, err := g.Generate(ctx)
+		require.NoError(t, err)
+		seen[key] = struct{}{}
+	}
+	assert.Len(t, seen, 61)
+	_, err := g.Generate(ctx)
+	assert.ErrorIs(t, err, ErrKeySpaceExhausted)
+}
+
+func TestNewKeyGenerator(t *testing.T) {
+	cfg := config.AppConfig{ShortKeyMode: KeyModeSequential, ShortKeyLength: 8, ShortKeyAlphabet: DefaultKeyAlphabet}
+	assert.IsType(t, &SequentialKeyGenerator{}, NewKeyGenerator(cfg, storage.NewMemoryStorage()))
+	cfg.ShortKeyMode = KeyModeRandom
+	assert.IsType(t, &RandomKeyGenerator{}, NewKeyGenerator(cfg, storage.NewMemoryStorage()))
+	cfg.ShortKeyMode = "unknown"
+	assert.Panics(t, func() { NewKeyGenerator(cfg, storage.NewMemoryStorage()) })
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt ignores everything past the first 72 bytes
+const maxPasswordLength = 72
+
+var ErrInvalidPassword = errors.New("invalid password")
+
+func HashPassword(password string) (string, error) {
+	if len(password) > maxPasswordLength {
+		return "", fmt.Errorf("%w: longer than %d bytes", ErrInvalidPassword, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password unlocks the link, links without a password need none.
+func CheckPassword(shortenedURL *model.ShortenedURL, password string) bool {
+	if !shortenedURL.PasswordHash.Valid {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(shortenedURL.PasswordHash.String), []byte(password)) == nil
+}
@@ -2,50 +2,226 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
+	appErrors "github.com/ujwegh/shortener/internal/app/errors"
 	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/metrics"
 	"github.com/ujwegh/shortener/internal/app/model"
 	"github.com/ujwegh/shortener/internal/app/storage"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type (
 	ShortenerService interface {
-		CreateShortenedURL(ctx context.Context, userUID *uuid.UUID, originalURL string) (*model.ShortenedURL, error)
+		CreateShortenedURL(ctx context.Context, userUID *uuid.UUID, originalURL string, opts ShortenOptions) (*model.ShortenedURL, error)
 		GetShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error)
 		BatchCreateShortenedURLs(ctx context.Context, dtos []model.ShortenedURL) (*[]model.ShortenedURL, error)
-		GetUserShortenedURLs(ctx context.Context, userUID *uuid.UUID) (*[]model.ShortenedURL, error)
-		DeleteUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, shortURLKeys []string) error
+		// GetUserShortenedURLs lists the links of the user, soft-deleted ones only when includeDeleted is set.
+		GetUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, includeDeleted bool) (*[]model.ShortenedURL, error)
+		// DeleteUserShortenedURLs accepts a delete request and returns the ID of the job applying it.
+		DeleteUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, shortURLKeys []string) (uuid.UUID, error)
+		GetDeletionJob(ctx context.Context, userUID *uuid.UUID, jobID uuid.UUID) (*model.DeletionJob, error)
+		// RestoreUserShortenedURLs undeletes soft-deleted links of the user and returns the restored keys.
+		RestoreUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, shortURLKeys []string) ([]string, error)
+		ConsumeClick(ctx context.Context, shortURL string) (bool, error)
+		RecordClick(click model.Click)
+		GetClickStats(ctx context.Context, userUID *uuid.UUID, shortURL string, from, to time.Time) (*model.ClickStats, error)
+		GetServiceStats(ctx context.Context) (*model.ServiceStats, error)
 	}
 	ShortenerServiceImpl struct {
-		storage     storage.Storage
-		taskChannel chan Task
+		storage      storage.Storage
+		taskChannel  chan Task
+		keyGenerator KeyGenerator
+		lookups      singleflight.Group
+		stats        lookupCounters
+		clickChannel chan model.Click
+		clicks       clickCounters
+		deletions    storage.DeletionQueue
+		jobs         *deletionJobs
+		// deletionConfig tunes BatchProcess, queued counts the accepted tasks not flushed yet
+		deletionConfig DeletionConfig
+		queued         atomic.Int64
+		// backlog is set when queued tasks failed to apply, BatchProcess replays the deletion queue then
+		backlog atomic.Bool
 	}
-	Task struct {
-		UserUID      uuid.UUID
-		ShortURLKeys []string
+	Option         func(ss *ShortenerServiceImpl)
+	ShortenOptions struct {
+		Alias     string    // custom short key, generated when empty
+		ExpiresAt time.Time // the link never expires when zero
+		MaxClicks int64     // number of allowed redirects, unlimited when zero
+		Password  string    // visitors have to enter it before the redirect, the link is public when empty
 	}
+	// DeletionConfig tunes the deletion workers, zero values keep the defaults.
+	DeletionConfig struct {
+		Workers       int           // parallel workers, the tasks of a user are handled by a single one
+		ChunkSize     int           // short keys per task
+		BatchSize     int           // tasks applied with a single DeleteBulk
+		FlushInterval time.Duration // the longest time a task waits for its batch to fill
+	}
+	// QueueFullError rejects a delete request while the task queue is saturated.
+	QueueFullError struct {
+		RetryAfter time.Duration
+	}
+	// BatchTooLargeError rejects a delete request that would not fit the task queue even when it is empty.
+	BatchTooLargeError struct {
+		MaxKeys int
+	}
+	// LookupStats counts GetShortenedURL calls and the storage reads they caused,
+	// the difference was served by a concurrent lookup of the same key.
+	LookupStats struct {
+		Lookups      int64
+		StorageReads int64
+		Deduplicated int64
+	}
+	lookupCounters struct {
+		lookups      atomic.Int64
+		storageReads atomic.Int64
+	}
+	// Task is a chunk of a deletion request handed to BatchProcess, ID is set when it is queued durably.
+	Task = model.DeletionTask
+)
+
+var (
+	ErrInvalidExpiration = errors.New("invalid expiration time")
+	ErrInvalidMaxClicks  = errors.New("max clicks must not be negative")
+	ErrQueueFull         = errors.New("deletion queue is full")
+	ErrBatchTooLarge     = errors.New("deletion batch is too large")
+)
+
+const (
+	// maxKeyAttempts bounds the number of short keys tried before the key space is considered exhausted.
+	maxKeyAttempts = 5
+	// lookupTimeout bounds a storage read shared by concurrent lookups, it outlives the callers' contexts.
+	lookupTimeout = 5 * time.Second
 )
 
-func NewShortenerService(storage storage.Storage, taskChannel chan Task) *ShortenerServiceImpl {
-	return &ShortenerServiceImpl{
-		storage:     storage,
-		taskChannel: taskChannel,
+func NewShortenerService(storage storage.Storage, taskChannel chan Task, opts ...Option) *ShortenerServiceImpl {
+	ss := &ShortenerServiceImpl{
+		storage:      storage,
+		taskChannel:  taskChannel,
+		keyGenerator: NewRandomKeyGenerator(DefaultKeyLength, DefaultKeyAlphabet),
+		jobs:         newDeletionJobs(),
+		deletionConfig: DeletionConfig{
+			Workers:       1,
+			ChunkSize:     20,
+			BatchSize:     20,
+			FlushInterval: 5 * time.Second,
+		},
 	}
+	for _, opt := range opts {
+		opt(ss)
+	}
+	return ss
 }
 
-func (ss *ShortenerServiceImpl) CreateShortenedURL(ctx context.Context, userUID *uuid.UUID, originalURL string) (*model.ShortenedURL, error) {
+func WithKeyGenerator(keyGenerator KeyGenerator) Option {
+	return func(ss *ShortenerServiceImpl) {
+		ss.keyGenerator = keyGenerator
+	}
+}
+
+// WithClickChannel enables click recording, the events are persisted by ClickProcess.
+func WithClickChannel(clickChannel chan model.Click) Option {
+	return func(ss *ShortenerServiceImpl) {
+		ss.clickChannel = clickChannel
+	}
+}
+
+// WithDeletionQueue persists deletion tasks before they are acknowledged, BatchProcess replays
+// the tasks left by a previous run and drops them from the queue once applied.
+func WithDeletionQueue(queue storage.DeletionQueue) Option {
+	return func(ss *ShortenerServiceImpl) {
+		ss.deletions = queue
+	}
+}
+
+// WithDeletionConfig overrides the positive settings of the deletion workers.
+func WithDeletionConfig(cfg DeletionConfig) Option {
+	return func(ss *ShortenerServiceImpl) {
+		if cfg.Workers > 0 {
+			ss.deletionConfig.Workers = cfg.Workers
+		}
+		if cfg.ChunkSize > 0 {
+			ss.deletionConfig.ChunkSize = cfg.ChunkSize
+		}
+		if cfg.BatchSize > 0 {
+			ss.deletionConfig.BatchSize = cfg.BatchSize
+		}
+		if cfg.FlushInterval > 0 {
+			ss.deletionConfig.FlushInterval = cfg.FlushInterval
+		}
+	}
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrQueueFull, e.RetryAfter)
+}
+
+func (e *QueueFullError) Unwrap() error {
+	return ErrQueueFull
+}
+
+func (e *BatchTooLargeError) Error() string {
+	return fmt.Sprintf("%v, at most %d keys", ErrBatchTooLarge, e.MaxKeys)
+}
+
+func (e *BatchTooLargeError) Unwrap() error {
+	return ErrBatchTooLarge
+}
+
+func (ss *ShortenerServiceImpl) CreateShortenedURL(ctx context.Context, userUID *uuid.UUID, originalURL string, opts ShortenOptions) (*model.ShortenedURL, error) {
 
-	shortURL := generateKey()
 	shortenedURL := &model.ShortenedURL{
 		UUID:        uuid.New(),
-		ShortURL:    shortURL,
 		OriginalURL: originalURL,
 	}
-	err := ss.storage.WriteShortenedURL(ctx, shortenedURL)
+	if !opts.ExpiresAt.IsZero() {
+		if !opts.ExpiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: %s is in the past", ErrInvalidExpiration, opts.ExpiresAt.Format(time.RFC3339))
+		}
+		shortenedURL.ExpiresAt = sql.NullTime{Time: opts.ExpiresAt, Valid: true}
+	}
+	if opts.MaxClicks < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidMaxClicks, opts.MaxClicks)
+	}
+	if opts.MaxClicks > 0 {
+		shortenedURL.ClicksLeft = sql.NullInt64{Int64: opts.MaxClicks, Valid: true}
+	}
+	if opts.Password != "" {
+		hash, err := HashPassword(opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		shortenedURL.PasswordHash = sql.NullString{String: hash, Valid: true}
+	}
+	var err error
+	if opts.Alias != "" {
+		if err := ValidateAlias(opts.Alias); err != nil {
+			return nil, err
+		}
+		shortenedURL.ShortURL = opts.Alias
+		err = ss.storage.WriteShortenedURL(ctx, shortenedURL)
+		if isShortURLCollision(err) {
+			err = &AliasError{Alias: opts.Alias, Err: ErrAliasTaken}
+		}
+	} else {
+		err = ss.withKeyRetry(func() error {
+			shortURL, err := ss.generateKey(ctx)
+			if err != nil {
+				return err
+			}
+			shortenedURL.ShortURL = shortURL
+			return ss.storage.WriteShortenedURL(ctx, shortenedURL)
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -60,104 +236,475 @@ func (ss *ShortenerServiceImpl) CreateShortenedURL(ctx context.Context, userUID
 	return shortenedURL, nil
 }
 
+// GetShortenedURL coalesces concurrent lookups of the same key into a single storage read.
 func (ss *ShortenerServiceImpl) GetShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
-	shortenedURL, err := ss.storage.ReadShortenedURL(ctx, url)
-	if err != nil {
-		return nil, err
+	ss.stats.lookups.Add(1)
+	metrics.Lookups.Inc()
+	ch := ss.lookups.DoChan(url, func() (interface{}, error) {
+		ss.stats.storageReads.Add(1)
+		metrics.LookupStorageReads.Inc()
+		// the first caller giving up must not fail the others waiting for the same read
+		readCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lookupTimeout)
+		defer cancel()
+		return ss.storage.ReadShortenedURL(readCtx, url)
+	})
+	select {
+	case result := <-ch:
+		shared, _ := result.Val.(*model.ShortenedURL)
+		if result.Err != nil || shared == nil {
+			return nil, result.Err
+		}
+		// every caller gets its own copy of the shared result
+		shortenedURL := *shared
+		return &shortenedURL, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	return shortenedURL, nil
 }
 
+// ConsumeClick spends one redirect of a click-limited link, false means the link must not redirect anymore.
+func (ss *ShortenerServiceImpl) ConsumeClick(ctx context.Context, shortURL string) (bool, error) {
+	return ss.storage.ConsumeClick(ctx, shortURL)
+}
+
+func (ss *ShortenerServiceImpl) LookupStats() LookupStats {
+	lookups := ss.stats.lookups.Load()
+	storageReads := ss.stats.storageReads.Load()
+	return LookupStats{
+		Lookups:      lookups,
+		StorageReads: storageReads,
+		Deduplicated: lookups - storageReads,
+	}
+}
+
+// GetServiceStats counts the links and users of the whole service and the clicks of the last day.
+func (ss *ShortenerServiceImpl) GetServiceStats(ctx context.Context) (*model.ServiceStats, error) {
+	return ss.storage.ReadServiceStats(ctx, time.Now().Add(-24*time.Hour))
+}
+
+// BatchCreateShortenedURLs keeps a preset ShortURL as a custom alias and generates keys for the other rows.
 func (ss *ShortenerServiceImpl) BatchCreateShortenedURLs(ctx context.Context, urls []model.ShortenedURL) (*[]model.ShortenedURL, error) {
+	aliases := make(map[string]struct{})
 	for i := range urls {
 		urls[i].UUID = uuid.New()
-		urls[i].ShortURL = generateKey()
+		if urls[i].ClicksLeft.Valid && urls[i].ClicksLeft.Int64 <= 0 {
+			return nil, fmt.Errorf("%w: %d", ErrInvalidMaxClicks, urls[i].ClicksLeft.Int64)
+		}
+		alias := urls[i].ShortURL
+		if alias == "" {
+			continue
+		}
+		if err := ValidateAlias(alias); err != nil {
+			return nil, err
+		}
+		if _, ok := aliases[alias]; ok {
+			return nil, &AliasError{Alias: alias, Err: ErrAliasTaken}
+		}
+		aliases[alias] = struct{}{}
+	}
+	generated := make([]bool, len(urls))
+	for i := range urls {
+		generated[i] = urls[i].ShortURL == ""
 	}
-	err := ss.storage.WriteBatchShortenedURLSlice(ctx, urls)
+	err := ss.withKeyRetry(func() error {
+		// the whole batch is rejected on a collision, so every generated row gets a fresh key
+		seen := make(map[string]struct{}, len(urls))
+		for alias := range aliases {
+			seen[alias] = struct{}{}
+		}
+		for i := range urls {
+			if !generated[i] {
+				continue
+			}
+			shortURL, err := ss.generateKey(ctx)
+			if err != nil {
+				return err
+			}
+			if _, ok := seen[shortURL]; ok {
+				return appErrors.New(errors.New("duplicate short key in batch"), "short url collision")
+			}
+			seen[shortURL] = struct{}{}
+			urls[i].ShortURL = shortURL
+		}
+		err := ss.storage.WriteBatchShortenedURLSlice(ctx, urls)
+		if isShortURLCollision(err) {
+			// a taken alias fails every retry, report it instead of retrying
+			if aliasErr := ss.findTakenAlias(ctx, aliases); aliasErr != nil {
+				return aliasErr
+			}
+		}
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	return &urls, nil
 }
 
-func (ss *ShortenerServiceImpl) GetUserShortenedURLs(ctx context.Context, userUID *uuid.UUID) (*[]model.ShortenedURL, error) {
+func (ss *ShortenerServiceImpl) findTakenAlias(ctx context.Context, aliases map[string]struct{}) error {
+	for alias := range aliases {
+		shortenedURL, err := ss.storage.ReadShortenedURL(ctx, alias)
+		if err == nil && shortenedURL.ShortURL == alias {
+			return &AliasError{Alias: alias, Err: ErrAliasTaken}
+		}
+	}
+	return nil
+}
+
+func (ss *ShortenerServiceImpl) GetUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, includeDeleted bool) (*[]model.ShortenedURL, error) {
 	userURLs, err := ss.storage.ReadUserURLs(ctx, userUID)
 	if err != nil {
 		return nil, err
 	}
-	return &userURLs, nil
+	if includeDeleted {
+		return &userURLs, nil
+	}
+	live := make([]model.ShortenedURL, 0, len(userURLs))
+	for _, userURL := range userURLs {
+		if !userURL.DeletedFlag {
+			live = append(live, userURL)
+		}
+	}
+	return &live, nil
 }
 
-func (ss *ShortenerServiceImpl) DeleteUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, shortURLKeys []string) error {
-	const chunkSize = 20
-	slice := make([]string, 0, chunkSize)
-	for _, shortURL := range shortURLKeys {
-		slice = append(slice, shortURL)
-		if len(slice) == chunkSize {
-			ss.taskChannel <- Task{
-				UserUID:      *userUID,
-				ShortURLKeys: slice,
-			}
-			slice = nil
-		}
+// RestoreUserShortenedURLs clears the deleted flag of the given links, a deletion of the same link
+// that is still queued is applied afterwards.
+func (ss *ShortenerServiceImpl) RestoreUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, shortURLKeys []string) ([]string, error) {
+	restored, err := ss.storage.RestoreBulk(ctx, *userUID, shortURLKeys)
+	if err != nil {
+		return nil, fmt.Errorf("restore user URLs: %w", err)
 	}
-	if len(slice) > 0 {
-		ss.taskChannel <- Task{
+	return restored, nil
+}
+
+func (ss *ShortenerServiceImpl) DeleteUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, shortURLKeys []string) (uuid.UUID, error) {
+	chunkSize := ss.deletionConfig.ChunkSize
+	// retrying could never help, the request needs more tasks than the queue holds
+	if maxKeys := cap(ss.taskChannel) * chunkSize; len(shortURLKeys) > maxKeys {
+		return uuid.Nil, &BatchTooLargeError{MaxKeys: maxKeys}
+	}
+	jobID := uuid.New()
+	now := time.Now()
+	var tasks []Task
+	for start := 0; start < len(shortURLKeys); start += chunkSize {
+		end := start + chunkSize
+		if end > len(shortURLKeys) {
+			end = len(shortURLKeys)
+		}
+		tasks = append(tasks, Task{
+			ID:           uuid.New(),
+			JobID:        jobID,
 			UserUID:      *userUID,
-			ShortURLKeys: slice,
+			ShortURLKeys: shortURLKeys[start:end],
+			CreatedAt:    now,
+		})
+	}
+	if !ss.reserve(len(tasks)) {
+		return uuid.Nil, &QueueFullError{RetryAfter: ss.deletionConfig.FlushInterval}
+	}
+	if ss.deletions != nil {
+		if err := ss.deletions.EnqueueDeletions(ctx, tasks); err != nil {
+			ss.release(len(tasks))
+			return uuid.Nil, fmt.Errorf("enqueue deletions: %w", err)
 		}
 	}
-	return nil
+	ss.jobs.register(tasks)
+	for _, task := range tasks {
+		// never blocks, the capacity is reserved
+		ss.taskChannel <- task
+	}
+	return jobID, nil
 }
 
+// BatchProcess hands the tasks to the deletion workers, tasks of a user always go to the same worker,
+// so they are applied in the order they were accepted.
 func (ss *ShortenerServiceImpl) BatchProcess(ctx context.Context, taskChannel <-chan Task) {
-	buffer := make(map[uuid.UUID][]string)
-	taskCount := 0
+	ss.replayDeletions(ctx)
 
-	ticker := time.NewTicker(5 * time.Second)
+	workers := make([]chan Task, ss.deletionConfig.Workers)
+	wg := sync.WaitGroup{}
+	for i := range workers {
+		workers[i] = make(chan Task, ss.deletionConfig.BatchSize)
+		wg.Add(1)
+		go func(tasks <-chan Task) {
+			defer wg.Done()
+			ss.deletionWorker(ctx, tasks)
+		}(workers[i])
+	}
+	defer func() {
+		for _, worker := range workers {
+			close(worker)
+		}
+		wg.Wait()
+	}()
+
+	ticker := time.NewTicker(ss.deletionConfig.FlushInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case task, ok := <-taskChannel:
 			if !ok {
-				deleteUserURLs(ss, buffer)
 				return
 			}
-			buffer[task.UserUID] = append(buffer[task.UserUID], task.ShortURLKeys...)
-			taskCount++
+			select {
+			case workers[partition(task.UserUID, len(workers))] <- task:
+			case <-ctx.Done():
+				return
+			}
+		case <-ticker.C:
+			if ss.backlog.CompareAndSwap(true, false) {
+				ss.replayDeletions(ctx)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-			if taskCount >= 20 {
-				deleteUserURLs(ss, buffer)
-				buffer = make(map[uuid.UUID][]string)
-				taskCount = 0
+// deletionWorker applies tasks in batches of BatchSize, a smaller batch waits at most FlushInterval.
+func (ss *ShortenerServiceImpl) deletionWorker(ctx context.Context, tasks <-chan Task) {
+	var batch []Task
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ss.flushDeletions(batch)
+		ss.release(len(batch))
+		batch = nil
+	}
+
+	ticker := time.NewTicker(ss.deletionConfig.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case task, ok := <-tasks:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, task)
+			if len(batch) >= ss.deletionConfig.BatchSize {
+				flush()
 			}
 		case <-ticker.C:
-			// Periodically flush the map
-			if taskCount > 0 {
-				deleteUserURLs(ss, buffer)
-				buffer = make(map[uuid.UUID][]string)
-				taskCount = 0
+			flush()
+		case <-ctx.Done():
+			// take what was already handed to this worker
+		drain:
+			for {
+				select {
+				case task, ok := <-tasks:
+					if !ok {
+						break drain
+					}
+					batch = append(batch, task)
+				default:
+					break drain
+				}
 			}
+			flush()
+			return
+		}
+	}
+}
+
+// reserve claims queue capacity for n tasks, accepted tasks count until their batch is flushed.
+func (ss *ShortenerServiceImpl) reserve(n int) bool {
+	for {
+		queued := ss.queued.Load()
+		if queued+int64(n) > int64(cap(ss.taskChannel)) {
+			return false
+		}
+		if ss.queued.CompareAndSwap(queued, queued+int64(n)) {
+			metrics.DeleteQueueDepth.Set(float64(queued + int64(n)))
+			return true
+		}
+	}
+}
+
+func (ss *ShortenerServiceImpl) release(n int) {
+	metrics.DeleteQueueDepth.Set(float64(ss.queued.Add(-int64(n))))
+}
+
+func partition(userUID uuid.UUID, n int) int {
+	h := fnv.New32a()
+	h.Write(userUID[:])
+	return int(h.Sum32() % uint32(n))
+}
 
+// RunJanitor hard deletes links that expired more than grace ago, every interval until ctx is done.
+func (ss *ShortenerServiceImpl) RunJanitor(ctx context.Context, interval, grace time.Duration, batchSize int) {
+	if interval <= 0 || batchSize <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ss.deleteExpired(ctx, time.Now().Add(-grace), batchSize)
 		case <-ctx.Done():
-			deleteUserURLs(ss, buffer)
 			return
 		}
 	}
 }
 
-func deleteUserURLs(ss *ShortenerServiceImpl, buffer map[uuid.UUID][]string) {
+// deleteExpired works off the expired links batch by batch, until a batch is not full.
+func (ss *ShortenerServiceImpl) deleteExpired(ctx context.Context, before time.Time, batchSize int) int {
+	total := 0
+	for ctx.Err() == nil {
+		deleted, err := ss.storage.DeleteExpired(ctx, before, batchSize)
+		total += deleted
+		if err != nil {
+			logger.Log.Error("failed to delete expired URLs", zap.Error(err))
+			break
+		}
+		if deleted < batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		logger.Log.Info("expired URLs deleted", zap.Int("count", total))
+	}
+	return total
+}
+
+// RunPurger hard deletes links soft deleted more than retention ago, every interval until ctx is done.
+// archive, when set, gets every batch before it is removed.
+func (ss *ShortenerServiceImpl) RunPurger(ctx context.Context, interval, retention time.Duration, batchSize int,
+	archive func([]model.ShortenedURL) error) {
+	if interval <= 0 || retention <= 0 || batchSize <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ss.purgeDeleted(ctx, time.Now().Add(-retention), batchSize, archive)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purgeDeleted works off the tombstones batch by batch, until a batch is not full.
+func (ss *ShortenerServiceImpl) purgeDeleted(ctx context.Context, before time.Time, batchSize int,
+	archive func([]model.ShortenedURL) error) int {
+	total := 0
+	for ctx.Err() == nil {
+		purged, err := ss.storage.PurgeDeleted(ctx, before, batchSize, archive)
+		total += purged
+		metrics.PurgedURLs.Add(float64(purged))
+		if err != nil {
+			logger.Log.Error("failed to purge deleted URLs", zap.Error(err))
+			break
+		}
+		if purged < batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		logger.Log.Info("deleted URLs purged", zap.Int("count", total))
+	}
+	return total
+}
+
+// replayDeletions applies the tasks waiting in the deletion queue, left by a previous run or dropped
+// from a full task channel. Tasks applied twice are harmless, a deleted link stays deleted.
+func (ss *ShortenerServiceImpl) replayDeletions(ctx context.Context) {
+	if ss.deletions == nil {
+		return
+	}
+	tasks, err := ss.deletions.PendingDeletions(ctx)
+	if err != nil {
+		logger.Log.Error("failed to read pending deletions", zap.Error(err))
+		ss.backlog.Store(true)
+		return
+	}
+	if len(tasks) > 0 {
+		logger.Log.Info("replaying pending deletions", zap.Int("tasks", len(tasks)))
+	}
+	ss.jobs.register(tasks)
+	batchSize := ss.deletionConfig.BatchSize
+	for start := 0; start < len(tasks); start += batchSize {
+		end := start + batchSize
+		if end > len(tasks) {
+			end = len(tasks)
+		}
+		ss.flushDeletions(tasks[start:end])
+	}
+}
+
+// flushDeletions applies the tasks, records the outcome of their jobs and drops them from the deletion queue.
+// Failed tasks stay queued and are retried with the next replay.
+func (ss *ShortenerServiceImpl) flushDeletions(tasks []Task) {
+	if len(tasks) == 0 {
+		return
+	}
+	buffer := make(map[uuid.UUID][]string)
+	taskIDs := make([]uuid.UUID, 0, len(tasks))
+	for _, task := range tasks {
+		buffer[task.UserUID] = append(buffer[task.UserUID], task.ShortURLKeys...)
+		taskIDs = append(taskIDs, task.ID)
+	}
+	if err := deleteUserURLs(ss, buffer); err != nil {
+		ss.jobs.failed(tasks, err)
+		if ss.deletions != nil {
+			ss.backlog.Store(true)
+		}
+		return
+	}
+	ss.jobs.applied(tasks, ss.resolveOutcomes(context.Background(), tasks))
+	if ss.deletions == nil {
+		return
+	}
+	if err := ss.deletions.CompleteDeletions(context.Background(), taskIDs); err != nil {
+		logger.Log.Error("failed to complete deletions", zap.Error(err))
+	}
+}
+
+func deleteUserURLs(ss *ShortenerServiceImpl, buffer map[uuid.UUID][]string) error {
+	start := time.Now()
 	err := ss.storage.DeleteBulk(context.Background(), buffer)
+	metrics.DeleteFlushDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.DeleteBulkErrors.Inc()
 		logger.Log.Error("failed to delete bulk user URLs", zap.Error(err))
 	}
+	return err
 }
 
-func generateKey() string {
-	buf := make([]byte, 6)
-	_, err := rand.Read(buf)
-	if err != nil {
-		return ""
+// generateKey skips the keys that would shadow a reserved path, like custom aliases must not.
+func (ss *ShortenerServiceImpl) generateKey(ctx context.Context) (string, error) {
+	for attempt := 1; attempt <= maxKeyAttempts; attempt++ {
+		shortURL, err := ss.keyGenerator.Generate(ctx)
+		if err != nil {
+			return "", fmt.Errorf("generate short key: %w", err)
+		}
+		if !isReserved(shortURL) {
+			return shortURL, nil
+		}
+		logger.Log.Warn("skipping reserved short key", zap.String("key", shortURL))
 	}
-	return base64.RawURLEncoding.EncodeToString(buf)
+	return "", fmt.Errorf("%w: %d reserved keys generated", ErrKeySpaceExhausted, maxKeyAttempts)
+}
+
+// withKeyRetry repeats write while the storage reports a short key collision.
+func (ss *ShortenerServiceImpl) withKeyRetry(write func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxKeyAttempts; attempt++ {
+		err = write()
+		if !isShortURLCollision(err) {
+			return err
+		}
+		logger.Log.Warn("short key collision", zap.Int("attempt", attempt), zap.Error(err))
+	}
+	return fmt.Errorf("%w: %d attempts collided: %w", ErrKeySpaceExhausted, maxKeyAttempts, err)
+}
+
+func isShortURLCollision(err error) bool {
+	shortenerError := appErrors.ShortenerError{}
+	return err != nil && errors.As(err, &shortenerError) && shortenerError.Msg() == "short url collision"
 }
@@ -0,0 +1,433 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/metrics"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type blockingStorage struct {
+	storage.Storage
+	release chan struct{}
+	reads   atomic.Int64
+}
+
+func (bs *blockingStorage) ReadShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
+	bs.reads.Add(1)
+	<-bs.release
+	return bs.Storage.ReadShortenedURL(ctx, url)
+}
+
+func TestShortenerServiceImpl_GetShortenedURL_Coalesced(t *testing.T) {
+	const callers = 50
+	ctx := context.Background()
+	backend := &blockingStorage{Storage: storage.NewMemoryStorage(), release: make(chan struct{})}
+	require.NoError(t, backend.WriteShortenedURL(ctx, &model.ShortenedURL{
+		UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru",
+	}))
+	ss := NewShortenerService(backend, make(chan Task))
+
+	results := make([]*model.ShortenedURL, callers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := ss.GetShortenedURL(ctx, "edVPg3ks")
+			assert.NoError(t, err)
+			results[i] = got
+		}(i)
+	}
+	require.Eventually(t, func() bool {
+		return ss.LookupStats().Lookups == callers
+	}, time.Second, time.Millisecond)
+	// let the last callers join the in-flight lookup
+	time.Sleep(50 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), backend.reads.Load())
+	assert.Equal(t, LookupStats{Lookups: callers, StorageReads: 1, Deduplicated: callers - 1}, ss.LookupStats())
+	for _, got := range results {
+		require.NotNil(t, got)
+		assert.Equal(t, "http://ya.ru", got.OriginalURL)
+	}
+	results[0].OriginalURL = "http://changed.ru"
+	assert.Equal(t, "http://ya.ru", results[1].OriginalURL, "callers must not share the result")
+
+	// completed lookups are not cached
+	_, err := ss.GetShortenedURL(ctx, "edVPg3ks")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), backend.reads.Load())
+}
+
+func TestShortenerServiceImpl_GetShortenedURL_CallerCanceled(t *testing.T) {
+	backend := &blockingStorage{Storage: storage.NewMemoryStorage(), release: make(chan struct{})}
+	defer close(backend.release)
+	ss := NewShortenerService(backend, make(chan Task))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := ss.GetShortenedURL(ctx, "edVPg3ks")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+type cancelableStorage struct {
+	storage.Storage
+	release chan struct{}
+}
+
+func (cs *cancelableStorage) ReadShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
+	select {
+	case <-cs.release:
+		return cs.Storage.ReadShortenedURL(ctx, url)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestShortenerServiceImpl_GetShortenedURL_FirstCallerCanceled(t *testing.T) {
+	backend := &cancelableStorage{Storage: storage.NewMemoryStorage(), release: make(chan struct{})}
+	require.NoError(t, backend.WriteShortenedURL(context.Background(), &model.ShortenedURL{
+		UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru",
+	}))
+	ss := NewShortenerService(backend, make(chan Task))
+	lookups := testutil.ToFloat64(metrics.Lookups)
+	storageReads := testutil.ToFloat64(metrics.LookupStorageReads)
+
+	firstCtx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := ss.GetShortenedURL(firstCtx, "edVPg3ks")
+		firstErr <- err
+	}()
+	require.Eventually(t, func() bool { return ss.LookupStats().StorageReads == 1 }, time.Second, time.Millisecond)
+	second := make(chan *model.ShortenedURL)
+	go func() {
+		got, err := ss.GetShortenedURL(context.Background(), "edVPg3ks")
+		assert.NoError(t, err)
+		second <- got
+	}()
+	require.Eventually(t, func() bool { return ss.LookupStats().Lookups == 2 }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+	close(backend.release)
+	got := <-second
+	require.NotNil(t, got)
+	assert.Equal(t, "http://ya.ru", got.OriginalURL)
+	assert.Equal(t, lookups+2, testutil.ToFloat64(metrics.Lookups))
+	assert.Equal(t, storageReads+1, testutil.ToFloat64(metrics.LookupStorageReads))
+}
+
+type sequenceKeyGenerator struct {
+	keys []string
+}
+
+func (g *sequenceKeyGenerator) Generate(ctx context.Context) (string, error) {
+	key := g.keys[0]
+	if len(g.keys) > 1 {
+		g.keys = g.keys[1:]
+	}
+	return key, nil
+}
+
+func TestShortenerServiceImpl_CreateShortenedURL_KeyCollision(t *testing.T) {
+	ctx := context.Background()
+	userUID := uuid.New()
+	tests := []struct {
+		name    string
+		keys    []string
+		want    string
+		wantErr error
+	}{
+		{name: "no collision", keys: []string{"free0001"}, want: "free0001"},
+		{name: "retried after collision", keys: []string{"taken001", "taken001", "free0001"}, want: "free0001"},
+		{name: "key space exhausted", keys: []string{"taken001"}, wantErr: ErrKeySpaceExhausted},
+		{name: "reserved key skipped", keys: []string{"api", "Metrics", "free0001"}, want: "free0001"},
+		{name: "only reserved keys", keys: []string{"ping"}, wantErr: ErrKeySpaceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := storage.NewMemoryStorage()
+			require.NoError(t, backend.WriteShortenedURL(ctx, &model.ShortenedURL{
+				UUID: uuid.New(), ShortURL: "taken001", OriginalURL: "http://ya.ru",
+			}))
+			ss := NewShortenerService(backend, nil, WithKeyGenerator(&sequenceKeyGenerator{keys: tt.keys}))
+
+			got, err := ss.CreateShortenedURL(ctx, &userUID, "http://google.com", ShortenOptions{})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.ShortURL)
+		})
+	}
+}
+
+func TestShortenerServiceImpl_BatchCreateShortenedURLs_KeyCollision(t *testing.T) {
+	ctx := context.Background()
+	backend := storage.NewMemoryStorage()
+	require.NoError(t, backend.WriteShortenedURL(ctx, &model.ShortenedURL{
+		UUID: uuid.New(), ShortURL: "taken001", OriginalURL: "http://ya.ru",
+	}))
+	keys := &sequenceKeyGenerator{keys: []string{"free0001", "taken001", "free0002", "free0002", "free0003", "free0004"}}
+	ss := NewShortenerService(backend, nil, WithKeyGenerator(keys))
+
+	got, err := ss.BatchCreateShortenedURLs(ctx, []model.ShortenedURL{
+		{OriginalURL: "http://google.com"},
+		{OriginalURL: "http://yandex.ru"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "free0003", (*got)[0].ShortURL)
+	assert.Equal(t, "free0004", (*got)[1].ShortURL)
+}
+
+func TestShortenerServiceImpl_DeleteUserShortenedURLs_Durable(t *testing.T) {
+	ctx := context.Background()
+	userUID := uuid.New()
+	backend := storage.NewMemoryStorage()
+	for _, shortURL := range []string{"del00001", "del00002", "del00003"} {
+		shortenedURL := &model.ShortenedURL{UUID: uuid.New(), ShortURL: shortURL, OriginalURL: "http://del.ru/" + shortURL}
+		require.NoError(t, backend.WriteShortenedURL(ctx, shortenedURL))
+		require.NoError(t, backend.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}))
+	}
+	// left by a previous run
+	require.NoError(t, backend.EnqueueDeletions(ctx, []model.DeletionTask{
+		{ID: uuid.New(), UserUID: userUID, ShortURLKeys: []string{"del00001"}, CreatedAt: time.Now()},
+	}))
+
+	taskChannel := make(chan Task, 10)
+	ss := NewShortenerService(backend, taskChannel, WithDeletionQueue(backend))
+	jobID, err := ss.DeleteUserShortenedURLs(ctx, &userUID, []string{"del00002"})
+	require.NoError(t, err)
+	pending, err := backend.PendingDeletions(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+	job, err := ss.GetDeletionJob(ctx, &userUID, jobID)
+	require.NoError(t, err)
+	assert.Equal(t, JobQueued, job.Status)
+
+	close(taskChannel)
+	ss.BatchProcess(ctx, taskChannel)
+
+	for shortURL, deleted := range map[string]bool{"del00001": true, "del00002": true, "del00003": false} {
+		got, err := backend.ReadShortenedURL(ctx, shortURL)
+		require.NoError(t, err)
+		assert.Equal(t, deleted, got.DeletedFlag, shortURL)
+	}
+	pending, err = backend.PendingDeletions(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	job, err = ss.GetDeletionJob(ctx, &userUID, jobID)
+	require.NoError(t, err)
+	assert.Equal(t, JobApplied, job.Status)
+}
+
+type bulkCountingStorage struct {
+	*storage.MemoryStorage
+	bulks int
+}
+
+func (s *bulkCountingStorage) DeleteBulk(ctx context.Context, buffer map[uuid.UUID][]string) error {
+	s.bulks++
+	return s.MemoryStorage.DeleteBulk(ctx, buffer)
+}
+
+func TestShortenerServiceImpl_ReplayDeletions_BatchSize(t *testing.T) {
+	ctx := context.Background()
+	backend := &bulkCountingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	userUID := uuid.New()
+	var tasks []model.DeletionTask
+	for i := 0; i < 5; i++ {
+		tasks = append(tasks, model.DeletionTask{
+			ID: uuid.New(), UserUID: userUID, ShortURLKeys: []string{fmt.Sprintf("del%05d", i)}, CreatedAt: time.Now(),
+		})
+	}
+	require.NoError(t, backend.EnqueueDeletions(ctx, tasks))
+	ss := NewShortenerService(backend, nil, WithDeletionQueue(backend),
+		WithDeletionConfig(DeletionConfig{BatchSize: 2}))
+
+	ss.replayDeletions(ctx)
+	assert.Equal(t, 3, backend.bulks, "replayed tasks are applied in batches of the configured size")
+	pending, err := backend.PendingDeletions(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestShortenerServiceImpl_GetDeletionJob(t *testing.T) {
+	ctx := context.Background()
+	owner, other := uuid.New(), uuid.New()
+	backend := storage.NewMemoryStorage()
+	for shortURL, userUID := range map[string]uuid.UUID{"job00001": owner, "job00002": other} {
+		shortenedURL := &model.ShortenedURL{UUID: uuid.New(), ShortURL: shortURL, OriginalURL: "http://job.ru/" + shortURL}
+		require.NoError(t, backend.WriteShortenedURL(ctx, shortenedURL))
+		require.NoError(t, backend.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}))
+	}
+	taskChannel := make(chan Task, 10)
+	ss := NewShortenerService(backend, taskChannel)
+	jobID, err := ss.DeleteUserShortenedURLs(ctx, &owner, []string{"job00001", "job00002", "job00003"})
+	require.NoError(t, err)
+	close(taskChannel)
+	ss.BatchProcess(ctx, taskChannel)
+
+	job, err := ss.GetDeletionJob(ctx, &owner, jobID)
+	require.NoError(t, err)
+	assert.Equal(t, JobApplied, job.Status)
+	assert.Equal(t, []model.DeletionOutcome{
+		{ShortURL: "job00001", Result: URLDeleted},
+		{ShortURL: "job00002", Result: URLNotOwned},
+		{ShortURL: "job00003", Result: URLNotFound},
+	}, job.URLs)
+
+	_, err = ss.GetDeletionJob(ctx, &other, jobID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	_, err = ss.GetDeletionJob(ctx, &owner, uuid.New())
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestShortenerServiceImpl_DeleteUserShortenedURLs_QueueFull(t *testing.T) {
+	ctx := context.Background()
+	userUID := uuid.New()
+	taskChannel := make(chan Task, 3)
+	ss := NewShortenerService(storage.NewMemoryStorage(), taskChannel,
+		WithDeletionConfig(DeletionConfig{ChunkSize: 2, FlushInterval: time.Minute}))
+
+	_, err := ss.DeleteUserShortenedURLs(ctx, &userUID, []string{"full0001", "full0002", "full0003"})
+	require.NoError(t, err)
+	// two more tasks do not fit, the request is rejected as a whole
+	_, err = ss.DeleteUserShortenedURLs(ctx, &userUID, []string{"full0004", "full0005", "full0006"})
+	require.ErrorIs(t, err, ErrQueueFull)
+	queueFullErr := &QueueFullError{}
+	require.ErrorAs(t, err, &queueFullErr)
+	assert.Equal(t, time.Minute, queueFullErr.RetryAfter)
+	assert.Len(t, taskChannel, 2)
+
+	_, err = ss.DeleteUserShortenedURLs(ctx, &userUID, []string{"full0007"})
+	require.NoError(t, err)
+	assert.Len(t, taskChannel, 3)
+}
+
+func TestShortenerServiceImpl_DeleteUserShortenedURLs_BatchTooLarge(t *testing.T) {
+	ctx := context.Background()
+	userUID := uuid.New()
+	taskChannel := make(chan Task, 2)
+	ss := NewShortenerService(storage.NewMemoryStorage(), taskChannel,
+		WithDeletionConfig(DeletionConfig{ChunkSize: 2, FlushInterval: time.Minute}))
+
+	// three chunks never fit a queue of two, even when it is empty
+	_, err := ss.DeleteUserShortenedURLs(ctx, &userUID, []string{"big00001", "big00002", "big00003", "big00004", "big00005"})
+	require.ErrorIs(t, err, ErrBatchTooLarge)
+	batchTooLargeErr := &BatchTooLargeError{}
+	require.ErrorAs(t, err, &batchTooLargeErr)
+	assert.Equal(t, 4, batchTooLargeErr.MaxKeys)
+	assert.Empty(t, taskChannel)
+
+	_, err = ss.DeleteUserShortenedURLs(ctx, &userUID, []string{"big00001", "big00002", "big00003", "big00004"})
+	require.NoError(t, err)
+	assert.Len(t, taskChannel, 2)
+}
+
+func TestShortenerServiceImpl_BatchProcess_Workers(t *testing.T) {
+	ctx := context.Background()
+	backend := storage.NewMemoryStorage()
+	taskChannel := make(chan Task, 100)
+	ss := NewShortenerService(backend, taskChannel,
+		WithDeletionConfig(DeletionConfig{Workers: 4, ChunkSize: 1, BatchSize: 3, FlushInterval: time.Minute}))
+	users := make([]uuid.UUID, 10)
+	var jobs []uuid.UUID
+	for i := range users {
+		users[i] = uuid.New()
+		var keys []string
+		for j := 0; j < 5; j++ {
+			shortURL := fmt.Sprintf("wrk%02d%03d", i, j)
+			created, err := ss.CreateShortenedURL(ctx, &users[i], "http://workers.ru/"+shortURL, ShortenOptions{Alias: shortURL})
+			require.NoError(t, err)
+			keys = append(keys, created.ShortURL)
+		}
+		jobID, err := ss.DeleteUserShortenedURLs(ctx, &users[i], keys)
+		require.NoError(t, err)
+		jobs = append(jobs, jobID)
+	}
+	close(taskChannel)
+	ss.BatchProcess(ctx, taskChannel)
+
+	for i, jobID := range jobs {
+		job, err := ss.GetDeletionJob(ctx, &users[i], jobID)
+		require.NoError(t, err)
+		assert.Equal(t, JobApplied, job.Status)
+		userURLs, err := backend.ReadUserURLs(ctx, &users[i])
+		require.NoError(t, err)
+		for _, userURL := range userURLs {
+			assert.True(t, userURL.DeletedFlag, userURL.ShortURL)
+		}
+	}
+	assert.Zero(t, ss.queued.Load())
+}
+
+func TestShortenerServiceImpl_purgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	backend := storage.NewMemoryStorage()
+	userUID := uuid.New()
+	ss := NewShortenerService(backend, make(chan Task))
+	var keys []string
+	for i := 0; i < 5; i++ {
+		shortURL := fmt.Sprintf("purge%03d", i)
+		created, err := ss.CreateShortenedURL(ctx, &userUID, "http://purge.ru/"+shortURL, ShortenOptions{Alias: shortURL})
+		require.NoError(t, err)
+		keys = append(keys, created.ShortURL)
+	}
+	require.NoError(t, backend.DeleteBulk(ctx, map[uuid.UUID][]string{userUID: keys[:4]}))
+
+	var batches [][]model.ShortenedURL
+	archive := func(batch []model.ShortenedURL) error {
+		batches = append(batches, batch)
+		return nil
+	}
+	// links deleted within the retention are kept
+	assert.Zero(t, ss.purgeDeleted(ctx, time.Now().Add(-time.Hour), 3, archive))
+	// a backlog larger than a batch is purged in a single run
+	assert.Equal(t, 4, ss.purgeDeleted(ctx, time.Now().Add(time.Second), 3, archive))
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], 3)
+	assert.Len(t, batches[1], 1)
+
+	userURLs, err := ss.GetUserShortenedURLs(ctx, &userUID, true)
+	require.NoError(t, err)
+	require.Len(t, *userURLs, 1)
+	assert.Equal(t, keys[4], (*userURLs)[0].ShortURL)
+}
+
+func TestShortenerServiceImpl_deleteExpired(t *testing.T) {
+	ctx := context.Background()
+	userUID := uuid.New()
+	ss := NewShortenerService(storage.NewMemoryStorage(), make(chan Task))
+	for i := 0; i < 5; i++ {
+		shortURL := fmt.Sprintf("expire%02d", i)
+		expiresAt := time.Now().Add(time.Minute)
+		if i == 4 {
+			expiresAt = time.Now().Add(time.Hour)
+		}
+		_, err := ss.CreateShortenedURL(ctx, &userUID, "http://expire.ru/"+shortURL, ShortenOptions{Alias: shortURL, ExpiresAt: expiresAt})
+		require.NoError(t, err)
+	}
+
+	// a backlog larger than a batch is deleted in a single run
+	assert.Equal(t, 4, ss.deleteExpired(ctx, time.Now().Add(10*time.Minute), 3))
+	assert.Zero(t, ss.deleteExpired(ctx, time.Now().Add(10*time.Minute), 3))
+	userURLs, err := ss.GetUserShortenedURLs(ctx, &userUID, true)
+	require.NoError(t, err)
+	require.Len(t, *userURLs, 1)
+	assert.Equal(t, "expire04", (*userURLs)[0].ShortURL)
+}
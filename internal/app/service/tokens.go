@@ -1,18 +1,22 @@
 package service
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/ujwegh/shortener/internal/app/config"
 	appErrors "github.com/ujwegh/shortener/internal/app/errors"
+	"github.com/ujwegh/shortener/internal/app/logger"
 	"time"
 )
 
 type TokenService interface {
 	GetUserUID(tokenString string) (string, error)
 	GenerateToken(userUID *uuid.UUID) (string, error)
+	GenerateLinkToken(shortURL string, ttl time.Duration) (string, error)
+	VerifyLinkToken(tokenString, shortURL string) error
 }
 
 type Claims struct {
@@ -20,13 +24,33 @@ type Claims struct {
 	UserUID string
 }
 
+// LinkClaims grant access to a single password-protected link until they expire.
+type LinkClaims struct {
+	jwt.RegisteredClaims
+	ShortURL string
+}
+
+const linkAccessSubject = "link access"
+
 type TokenServiceImpl struct {
 	secretKey string
+	linkKey   []byte
 }
 
 func NewTokenService(cfg config.AppConfig) *TokenServiceImpl {
+	linkKey := []byte(cfg.TokenSecretKey)
+	if cfg.TokenSecretKey == "" {
+		// link tokens signed with an empty key could be forged by anyone,
+		// a random key only costs the unlocked links on restart
+		linkKey = make([]byte, 32)
+		if _, err := rand.Read(linkKey); err != nil {
+			panic(err)
+		}
+		logger.Log.Warn("Token secret key is not set, link access tokens will not survive a restart, set -k or TOKEN_SECRET_KEY")
+	}
 	return &TokenServiceImpl{
 		secretKey: cfg.TokenSecretKey,
+		linkKey:   linkKey,
 	}
 }
 
@@ -67,3 +91,38 @@ func (ts TokenServiceImpl) GenerateToken(userUID *uuid.UUID) (string, error) {
 	}
 	return tokenString, nil
 }
+
+func (ts TokenServiceImpl) GenerateLinkToken(shortURL string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, LinkClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			Subject:   linkAccessSubject,
+		},
+		ShortURL: shortURL,
+	})
+	return token.SignedString(ts.linkKey)
+}
+
+func (ts TokenServiceImpl) VerifyLinkToken(tokenString, shortURL string) error {
+	claims := &LinkClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			}
+			return ts.linkKey, nil
+		})
+	if err != nil {
+		return appErrors.New(err, "failed to parse token")
+	}
+	// a session token carries no expiration, so the claims are checked explicitly
+	if !token.Valid || claims.Subject != linkAccessSubject || claims.ExpiresAt == nil || claims.ShortURL != shortURL {
+		return appErrors.New(
+			errors.New("token error"),
+			"token is not valid",
+		)
+	}
+	return nil
+}
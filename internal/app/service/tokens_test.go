@@ -0,0 +1,90 @@
+package service
+
+import (
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenServiceImpl_VerifyLinkToken(t *testing.T) {
+	ts := NewTokenService(config.AppConfig{TokenSecretKey: "secret"})
+	valid, err := ts.GenerateLinkToken("edVPg3ks", time.Minute)
+	require.NoError(t, err)
+	expired, err := ts.GenerateLinkToken("edVPg3ks", -time.Minute)
+	require.NoError(t, err)
+	foreign, err := NewTokenService(config.AppConfig{TokenSecretKey: "other"}).GenerateLinkToken("edVPg3ks", time.Minute)
+	require.NoError(t, err)
+	userUID := uuid.New()
+	session, err := ts.GenerateToken(&userUID)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		shortURL string
+		wantErr  bool
+	}{
+		{name: "valid", token: valid, shortURL: "edVPg3ks"},
+		{name: "other link", token: valid, shortURL: "AbCdEf12", wantErr: true},
+		{name: "expired", token: expired, shortURL: "edVPg3ks", wantErr: true},
+		{name: "other secret", token: foreign, shortURL: "edVPg3ks", wantErr: true},
+		{name: "session token", token: session, shortURL: "edVPg3ks", wantErr: true},
+		{name: "garbage", token: "garbage", shortURL: "edVPg3ks", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ts.VerifyLinkToken(tt.token, tt.shortURL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewTokenService_EmptySecretKey(t *testing.T) {
+	ts := NewTokenService(config.AppConfig{})
+	token, err := ts.GenerateLinkToken("edVPg3ks", time.Minute)
+	require.NoError(t, err)
+	assert.NoError(t, ts.VerifyLinkToken(token, "edVPg3ks"))
+	assert.Error(t, NewTokenService(config.AppConfig{}).VerifyLinkToken(token, "edVPg3ks"), "every process signs with its own key")
+
+	userUID := uuid.New()
+	session, err := ts.GenerateToken(&userUID)
+	require.NoError(t, err)
+	got, err := NewTokenService(config.AppConfig{}).GetUserUID(session)
+	require.NoError(t, err)
+	assert.Equal(t, userUID.String(), got, "auth tokens keep the configured key")
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("open sesame")
+	require.NoError(t, err)
+	protected := &model.ShortenedURL{PasswordHash: sql.NullString{String: hash, Valid: true}}
+	tests := []struct {
+		name         string
+		shortenedURL *model.ShortenedURL
+		password     string
+		want         bool
+	}{
+		{name: "right password", shortenedURL: protected, password: "open sesame", want: true},
+		{name: "wrong password", shortenedURL: protected, password: "open", want: false},
+		{name: "empty password", shortenedURL: protected, password: "", want: false},
+		{name: "public link", shortenedURL: &model.ShortenedURL{}, password: "", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CheckPassword(tt.shortenedURL, tt.password))
+		})
+	}
+
+	_, err = HashPassword(strings.Repeat("a", maxPasswordLength+1))
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const instrumentationName = "github.com/ujwegh/shortener/internal/app/service"
+
+const (
+	attrShortURL = attribute.Key("shortener.short_url")
+	attrUserUID  = attribute.Key("shortener.user_uid")
+	attrCount    = attribute.Key("shortener.count")
+	attrJobID    = attribute.Key("shortener.job_id")
+)
+
+// TracedShortenerService opens a span for every ShortenerService call, storage spans nest below it.
+type TracedShortenerService struct {
+	service ShortenerService
+}
+
+func NewTracedShortenerService(service ShortenerService) *TracedShortenerService {
+	return &TracedShortenerService{service: service}
+}
+
+func (ts *TracedShortenerService) CreateShortenedURL(ctx context.Context, userUID *uuid.UUID, originalURL string, opts ShortenOptions) (*model.ShortenedURL, error) {
+	ctx, span := startSpan(ctx, "CreateShortenedURL", userAttr(userUID)...)
+	shortenedURL, err := ts.service.CreateShortenedURL(ctx, userUID, originalURL, opts)
+	if shortenedURL != nil {
+		span.SetAttributes(attrShortURL.String(shortenedURL.ShortURL))
+	}
+	endSpan(span, err)
+	return shortenedURL, err
+}
+
+func (ts *TracedShortenerService) GetShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
+	ctx, span := startSpan(ctx, "GetShortenedURL", attrShortURL.String(url))
+	shortenedURL, err := ts.service.GetShortenedURL(ctx, url)
+	endSpan(span, err)
+	return shortenedURL, err
+}
+
+func (ts *TracedShortenerService) BatchCreateShortenedURLs(ctx context.Context, dtos []model.ShortenedURL) (*[]model.ShortenedURL, error) {
+	ctx, span := startSpan(ctx, "BatchCreateShortenedURLs", attrCount.Int(len(dtos)))
+	shortenedURLs, err := ts.service.BatchCreateShortenedURLs(ctx, dtos)
+	endSpan(span, err)
+	return shortenedURLs, err
+}
+
+func (ts *TracedShortenerService) GetUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, includeDeleted bool) (*[]model.ShortenedURL, error) {
+	ctx, span := startSpan(ctx, "GetUserShortenedURLs", userAttr(userUID)...)
+	shortenedURLs, err := ts.service.GetUserShortenedURLs(ctx, userUID, includeDeleted)
+	endSpan(span, err)
+	return shortenedURLs, err
+}
+
+func (ts *TracedShortenerService) DeleteUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, shortURLKeys []string) (uuid.UUID, error) {
+	ctx, span := startSpan(ctx, "DeleteUserShortenedURLs", append(userAttr(userUID), attrCount.Int(len(shortURLKeys)))...)
+	jobID, err := ts.service.DeleteUserShortenedURLs(ctx, userUID, shortURLKeys)
+	span.SetAttributes(attrJobID.String(jobID.String()))
+	endSpan(span, err)
+	return jobID, err
+}
+
+func (ts *TracedShortenerService) GetDeletionJob(ctx context.Context, userUID *uuid.UUID, jobID uuid.UUID) (*model.DeletionJob, error) {
+	ctx, span := startSpan(ctx, "GetDeletionJob", append(userAttr(userUID), attrJobID.String(jobID.String()))...)
+	job, err := ts.service.GetDeletionJob(ctx, userUID, jobID)
+	endSpan(span, err)
+	return job, err
+}
+
+func (ts *TracedShortenerService) RestoreUserShortenedURLs(ctx context.Context, userUID *uuid.UUID, shortURLKeys []string) ([]string, error) {
+	ctx, span := startSpan(ctx, "RestoreUserShortenedURLs", append(userAttr(userUID), attrCount.Int(len(shortURLKeys)))...)
+	restored, err := ts.service.RestoreUserShortenedURLs(ctx, userUID, shortURLKeys)
+	endSpan(span, err)
+	return restored, err
+}
+
+func (ts *TracedShortenerService) ConsumeClick(ctx context.Context, shortURL string) (bool, error) {
+	ctx, span := startSpan(ctx, "ConsumeClick", attrShortURL.String(shortURL))
+	ok, err := ts.service.ConsumeClick(ctx, shortURL)
+	endSpan(span, err)
+	return ok, err
+}
+
+// RecordClick only queues the event, there is nothing worth a span.
+func (ts *TracedShortenerService) RecordClick(click model.Click) {
+	ts.service.RecordClick(click)
+}
+
+func (ts *TracedShortenerService) GetClickStats(ctx context.Context, userUID *uuid.UUID, shortURL string, from, to time.Time) (*model.ClickStats, error) {
+	ctx, span := startSpan(ctx, "GetClickStats", append(userAttr(userUID), attrShortURL.String(shortURL))...)
+	stats, err := ts.service.GetClickStats(ctx, userUID, shortURL, from, to)
+	endSpan(span, err)
+	return stats, err
+}
+
+func (ts *TracedShortenerService) GetServiceStats(ctx context.Context) (*model.ServiceStats, error) {
+	ctx, span := startSpan(ctx, "GetServiceStats")
+	stats, err := ts.service.GetServiceStats(ctx)
+	endSpan(span, err)
+	return stats, err
+}
+
+func userAttr(userUID *uuid.UUID) []attribute.KeyValue {
+	if userUID == nil {
+		return nil
+	}
+	return []attribute.KeyValue{attrUserUID.String(userUID.String())}
+}
+
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, "service."+method, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
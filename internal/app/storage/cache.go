@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"sync"
+	"time"
+)
+
+// CachedStorage is a read-through cache of ReadShortenedURL lookups in front of another Storage.
+// Misses are cached too, for a shorter negativeTTL, and every write invalidates the affected keys.
+type CachedStorage struct {
+	Storage
+	capacity    int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	entries     map[string]*list.Element
+	byShortURL  map[string]map[string]struct{} // cache keys of the entries holding a short URL
+	lru         *list.List                     // front is the most recently used
+	// generation changes on every invalidation, a read that started before it must not be cached
+	generation uint64
+	mutex      sync.Mutex
+	now        func() time.Time
+}
+
+type cacheEntry struct {
+	key       string
+	value     model.ShortenedURL
+	err       error // ErrNotFound for a cached miss
+	expiresAt time.Time
+}
+
+func NewCachedStorage(storage Storage, capacity int, ttl, negativeTTL time.Duration) *CachedStorage {
+	return &CachedStorage{
+		Storage:     storage,
+		capacity:    capacity,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]*list.Element, capacity),
+		byShortURL:  make(map[string]map[string]struct{}, capacity),
+		lru:         list.New(),
+		now:         time.Now,
+	}
+}
+
+func (cs *CachedStorage) ReadShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
+	entry, generation, ok := cs.get(url)
+	if ok {
+		value := entry.value
+		return &value, entry.err
+	}
+
+	shortenedURL, err := cs.Storage.ReadShortenedURL(ctx, url)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		cs.put(url, model.ShortenedURL{}, err, cs.negativeTTL, generation)
+	case err != nil:
+		return nil, err
+	case shortenedURL.OriginalURL == "":
+		cs.put(url, *shortenedURL, nil, cs.negativeTTL, generation)
+	default:
+		cs.put(url, *shortenedURL, nil, cs.ttl, generation)
+	}
+	return shortenedURL, err
+}
+
+func (cs *CachedStorage) WriteShortenedURL(ctx context.Context, shortenedURL *model.ShortenedURL) error {
+	err := cs.Storage.WriteShortenedURL(ctx, shortenedURL)
+	cs.Invalidate(shortenedURL.ShortURL, shortenedURL.OriginalURL)
+	return err
+}
+
+func (cs *CachedStorage) WriteBatchShortenedURLSlice(ctx context.Context, slice []model.ShortenedURL) error {
+	err := cs.Storage.WriteBatchShortenedURLSlice(ctx, slice)
+	keys := make([]string, 0, len(slice)*2)
+	for _, shortenedURL := range slice {
+		keys = append(keys, shortenedURL.ShortURL, shortenedURL.OriginalURL)
+	}
+	cs.Invalidate(keys...)
+	return err
+}
+
+func (cs *CachedStorage) DeleteBulk(ctx context.Context, buffer map[uuid.UUID][]string) error {
+	err := cs.Storage.DeleteBulk(ctx, buffer)
+	var shortURLs []string
+	for _, keys := range buffer {
+		shortURLs = append(shortURLs, keys...)
+	}
+	cs.Invalidate(shortURLs...)
+	return err
+}
+
+func (cs *CachedStorage) RestoreBulk(ctx context.Context, userUID uuid.UUID, shortURLs []string) ([]string, error) {
+	restored, err := cs.Storage.RestoreBulk(ctx, userUID, shortURLs)
+	cs.Invalidate(restored...)
+	return restored, err
+}
+
+func (cs *CachedStorage) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	deleted, err := cs.Storage.DeleteExpired(ctx, before, limit)
+	if deleted > 0 {
+		cs.Purge()
+	}
+	return deleted, err
+}
+
+func (cs *CachedStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int,
+	archive func([]model.ShortenedURL) error) (int, error) {
+	purged, err := cs.Storage.PurgeDeleted(ctx, before, limit, archive)
+	if purged > 0 {
+		cs.Purge()
+	}
+	return purged, err
+}
+
+// Invalidate drops cached lookups of the given short or original URLs,
+// including entries cached under another key for the same short URL.
+func (cs *CachedStorage) Invalidate(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.generation++
+	for _, key := range keys {
+		if element, ok := cs.entries[key]; ok {
+			cs.remove(element)
+		}
+		for cacheKey := range cs.byShortURL[key] {
+			cs.remove(cs.entries[cacheKey])
+		}
+	}
+}
+
+// Purge drops all cached lookups.
+func (cs *CachedStorage) Purge() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.generation++
+	cs.entries = make(map[string]*list.Element, cs.capacity)
+	cs.byShortURL = make(map[string]map[string]struct{}, cs.capacity)
+	cs.lru.Init()
+}
+
+// Follow applies change events of other instances to the cache until ctx is done or events is closed.
+func (cs *CachedStorage) Follow(ctx context.Context, events <-chan Event) {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Kind == EventReset {
+				cs.Purge()
+				continue
+			}
+			cs.Invalidate(event.Keys...)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// get returns a cached entry, on a miss it returns the generation to pass to put.
+func (cs *CachedStorage) get(key string) (*cacheEntry, uint64, bool) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	element, ok := cs.entries[key]
+	if !ok {
+		return nil, cs.generation, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !cs.now().Before(entry.expiresAt) {
+		cs.remove(element)
+		return nil, cs.generation, false
+	}
+	cs.lru.MoveToFront(element)
+	return entry, cs.generation, true
+}
+
+// put caches a value read in the given generation, unless the cache was invalidated in the meantime.
+func (cs *CachedStorage) put(key string, value model.ShortenedURL, err error, ttl time.Duration, generation uint64) {
+	if ttl <= 0 || cs.capacity <= 0 {
+		return
+	}
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	if generation != cs.generation {
+		return
+	}
+	if element, ok := cs.entries[key]; ok {
+		cs.remove(element)
+	}
+	entry := &cacheEntry{key: key, value: value, err: err, expiresAt: cs.now().Add(ttl)}
+	cs.entries[key] = cs.lru.PushFront(entry)
+	if value.ShortURL != "" {
+		if cs.byShortURL[value.ShortURL] == nil {
+			cs.byShortURL[value.ShortURL] = make(map[string]struct{})
+		}
+		cs.byShortURL[value.ShortURL][key] = struct{}{}
+	}
+	for cs.lru.Len() > cs.capacity {
+		cs.remove(cs.lru.Back())
+	}
+}
+
+func (cs *CachedStorage) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	cs.lru.Remove(element)
+	delete(cs.entries, entry.key)
+	if keys, ok := cs.byShortURL[entry.value.ShortURL]; ok {
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(cs.byShortURL, entry.value.ShortURL)
+		}
+	}
+}
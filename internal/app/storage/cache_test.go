@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingStorage struct {
+	Storage
+	reads atomic.Int64
+	err   error
+}
+
+func (cs *countingStorage) ReadShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
+	cs.reads.Add(1)
+	if cs.err != nil {
+		return nil, cs.err
+	}
+	return cs.Storage.ReadShortenedURL(ctx, url)
+}
+
+func newTestCache(t *testing.T, capacity int) (*CachedStorage, *countingStorage, *time.Time, uuid.UUID) {
+	ctx := context.Background()
+	backend := &countingStorage{Storage: NewMemoryStorage()}
+	userUID := uuid.New()
+	for _, url := range []model.ShortenedURL{
+		{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"},
+		{UUID: uuid.New(), ShortURL: "edJkl5jj", OriginalURL: "http://ya.com"},
+		{UUID: uuid.New(), ShortURL: "BDurKLrm", OriginalURL: "http://yandex.ru"},
+	} {
+		url := url
+		require.NoError(t, backend.WriteShortenedURL(ctx, &url))
+		require.NoError(t, backend.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: url.UUID}))
+	}
+	now := time.Now()
+	cache := NewCachedStorage(backend, capacity, time.Minute, time.Second)
+	cache.now = func() time.Time { return now }
+	return cache, backend, &now, userUID
+}
+
+func TestCachedStorage_ReadShortenedURL(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		capacity  int
+		keys      []string
+		advance   time.Duration
+		again     string
+		wantReads int64
+	}{
+		{name: "hit", capacity: 10, keys: []string{"edVPg3ks"}, again: "edVPg3ks", wantReads: 1},
+		{name: "expired", capacity: 10, keys: []string{"edVPg3ks"}, advance: 2 * time.Minute, again: "edVPg3ks", wantReads: 2},
+		{name: "negative hit", capacity: 10, keys: []string{"unknown"}, advance: 500 * time.Millisecond, again: "unknown", wantReads: 1},
+		{name: "negative expired", capacity: 10, keys: []string{"unknown"}, advance: 2 * time.Second, again: "unknown", wantReads: 2},
+		{name: "evicted least recently used", capacity: 2, keys: []string{"edVPg3ks", "edJkl5jj", "BDurKLrm"}, again: "edVPg3ks", wantReads: 4},
+		{name: "recently used kept", capacity: 2, keys: []string{"edVPg3ks", "edJkl5jj", "edVPg3ks", "BDurKLrm"}, again: "edVPg3ks", wantReads: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, backend, now, _ := newTestCache(t, tt.capacity)
+			for _, key := range tt.keys {
+				_, err := cache.ReadShortenedURL(ctx, key)
+				require.NoError(t, err)
+			}
+			*now = now.Add(tt.advance)
+			_, err := cache.ReadShortenedURL(ctx, tt.again)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantReads, backend.reads.Load())
+		})
+	}
+}
+
+func TestCachedStorage_NotFoundError(t *testing.T) {
+	ctx := context.Background()
+	cache, backend, _, _ := newTestCache(t, 10)
+	backend.err = ErrNotFound
+	for i := 0; i < 3; i++ {
+		_, err := cache.ReadShortenedURL(ctx, "unknown")
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, int64(1), backend.reads.Load())
+}
+
+func TestCachedStorage_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	cache, backend, _, userUID := newTestCache(t, 10)
+
+	got, err := cache.ReadShortenedURL(ctx, "edVPg3ks")
+	require.NoError(t, err)
+	require.False(t, got.DeletedFlag)
+	_, err = cache.ReadShortenedURL(ctx, "http://ya.ru")
+	require.NoError(t, err)
+	_, err = cache.ReadShortenedURL(ctx, "newkey01")
+	require.NoError(t, err)
+
+	require.NoError(t, cache.DeleteBulk(ctx, map[uuid.UUID][]string{userUID: {"edVPg3ks"}}))
+	for _, key := range []string{"edVPg3ks", "http://ya.ru"} {
+		got, err = cache.ReadShortenedURL(ctx, key)
+		require.NoError(t, err)
+		assert.True(t, got.DeletedFlag, "cached %s must be invalidated by DeleteBulk", key)
+	}
+
+	require.NoError(t, cache.WriteShortenedURL(ctx, &model.ShortenedURL{UUID: uuid.New(), ShortURL: "newkey01", OriginalURL: "http://new.ru"}))
+	got, err = cache.ReadShortenedURL(ctx, "newkey01")
+	require.NoError(t, err)
+	assert.Equal(t, "http://new.ru", got.OriginalURL, "cached miss must be invalidated by a write")
+	assert.Equal(t, int64(6), backend.reads.Load())
+}
+
+type racingStorage struct {
+	Storage
+	onRead func()
+}
+
+func (rs *racingStorage) ReadShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
+	shortenedURL, err := rs.Storage.ReadShortenedURL(ctx, url)
+	if onRead := rs.onRead; onRead != nil {
+		rs.onRead = nil
+		onRead()
+	}
+	return shortenedURL, err
+}
+
+func TestCachedStorage_InvalidateDuringRead(t *testing.T) {
+	ctx := context.Background()
+	backend := &racingStorage{Storage: NewMemoryStorage()}
+	userUID := uuid.New()
+	shortenedURL := &model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}
+	require.NoError(t, backend.WriteShortenedURL(ctx, shortenedURL))
+	require.NoError(t, backend.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}))
+	cache := NewCachedStorage(backend, 10, time.Minute, time.Second)
+
+	// the link is deleted after the read got the old value but before it is cached
+	backend.onRead = func() {
+		require.NoError(t, cache.DeleteBulk(ctx, map[uuid.UUID][]string{userUID: {"edVPg3ks"}}))
+	}
+	got, err := cache.ReadShortenedURL(ctx, "edVPg3ks")
+	require.NoError(t, err)
+	assert.False(t, got.DeletedFlag)
+
+	got, err = cache.ReadShortenedURL(ctx, "edVPg3ks")
+	require.NoError(t, err)
+	assert.True(t, got.DeletedFlag, "a read started before the invalidation must not be cached")
+}
+
+func TestCachedStorage_InvalidateByShortURL(t *testing.T) {
+	ctx := context.Background()
+	cache, backend, _, _ := newTestCache(t, 10)
+	for _, key := range []string{"edVPg3ks", "http://ya.ru", "edJkl5jj"} {
+		_, err := cache.ReadShortenedURL(ctx, key)
+		require.NoError(t, err)
+	}
+
+	cache.Invalidate("edVPg3ks")
+	assert.Len(t, cache.entries, 1)
+	assert.NotContains(t, cache.byShortURL, "edVPg3ks")
+	_, err := cache.ReadShortenedURL(ctx, "edJkl5jj")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), backend.reads.Load())
+}
@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// clickInsertChunk bounds the number of rows of a single insert statement.
+const clickInsertChunk = 100
+
+func (storage *DBStorage) WriteClicks(ctx context.Context, clicks []model.Click) error {
+	query := `INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, ip_prefix)
+		VALUES (:short_url, :clicked_at, :referrer, :user_agent, :ip_prefix);`
+	for start := 0; start < len(clicks); start += clickInsertChunk {
+		end := start + clickInsertChunk
+		if end > len(clicks) {
+			end = len(clicks)
+		}
+		chunk := make([]model.Click, 0, end-start)
+		for _, click := range clicks[start:end] {
+			click.ClickedAt = click.ClickedAt.UTC()
+			chunk = append(chunk, click)
+		}
+		if _, err := storage.db.NamedExecContext(ctx, query, chunk); err != nil {
+			return fmt.Errorf("write clicks: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadClickStats aggregates the clicks of the range [from, to) with SQL, buckets are formatted
+// the same way as by clickAggregator.
+func (storage *DBStorage) ReadClickStats(ctx context.Context, shortURL string, from, to time.Time, top int) (*model.ClickStats, error) {
+	dayBucket := `to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')`
+	hourBucket := `to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:00:00"Z"')`
+	if storage.db.DriverName() == driverSQLite {
+		dayBucket = `strftime('%Y-%m-%d', clicked_at)`
+		hourBucket = `strftime('%Y-%m-%dT%H:00:00Z', clicked_at)`
+	}
+	const filter = `FROM clicks WHERE short_url = $1 AND clicked_at >= $2 AND clicked_at < $3`
+	args := []interface{}{shortURL, utcTime(sql.NullTime{Time: from, Valid: true}), utcTime(sql.NullTime{Time: to, Valid: true})}
+
+	stats := &model.ClickStats{}
+	err := storage.db.GetContext(ctx, stats, `SELECT COUNT(*) AS total,
+		COUNT(DISTINCT ip_prefix || '|' || user_agent) AS unique_visitors `+filter+`;`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("read click totals: %w", err)
+	}
+	topArgs := append(append([]interface{}{}, args...), top)
+	series := []struct {
+		dest  *[]model.ClickCount
+		query string
+		args  []interface{}
+	}{
+		{&stats.PerDay, `SELECT ` + dayBucket + ` AS value, COUNT(*) AS clicks ` + filter + ` GROUP BY value ORDER BY value;`, args},
+		{&stats.PerHour, `SELECT ` + hourBucket + ` AS value, COUNT(*) AS clicks ` + filter + ` GROUP BY value ORDER BY value;`, args},
+		{&stats.TopReferrers, `SELECT referrer AS value, COUNT(*) AS clicks ` + filter +
+			` GROUP BY referrer ORDER BY clicks DESC, value LIMIT $4;`, topArgs},
+		{&stats.TopUserAgents, `SELECT user_agent AS value, COUNT(*) AS clicks ` + filter +
+			` GROUP BY user_agent ORDER BY clicks DESC, value LIMIT $4;`, topArgs},
+	}
+	for _, q := range series {
+		if err := storage.db.SelectContext(ctx, q.dest, q.query, q.args...); err != nil {
+			return nil, fmt.Errorf("read click stats: %w", err)
+		}
+	}
+	return stats, nil
+}
+
+func (ms *MemoryStorage) WriteClicks(ctx context.Context, clicks []model.Click) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.clicks = append(ms.clicks, clicks...)
+	return nil
+}
+
+func (ms *MemoryStorage) ReadClickStats(ctx context.Context, shortURL string, from, to time.Time, top int) (*model.ClickStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	aggregator := newClickAggregator(shortURL, from, to)
+	for _, click := range ms.clicks {
+		aggregator.add(click)
+	}
+	return aggregator.result(top), nil
+}
+
+func (fs *FileStorage) WriteClicks(ctx context.Context, clicks []model.Click) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fs.clicks.append(clicks)
+}
+
+// ReadClickStats scans the whole click log, which is fine for the file storage scale.
+func (fs *FileStorage) ReadClickStats(ctx context.Context, shortURL string, from, to time.Time, top int) (*model.ClickStats, error) {
+	aggregator := newClickAggregator(shortURL, from, to)
+	if err := fs.clicks.scan(ctx, aggregator.add); err != nil {
+		return nil, err
+	}
+	return aggregator.result(top), nil
+}
+
+// clickLog appends click events to a JSON-lines file. Unlike the URL logs it is only rewritten to drop
+// the clicks of removed links, and a torn last line only loses a single event, so the lines carry no checksums.
+type clickLog struct {
+	path    string // empty keeps the events in memory
+	file    *os.File
+	records []model.Click
+	mutex   sync.Mutex
+}
+
+func (l *clickLog) append(clicks []model.Click) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.path == "" {
+		l.records = append(l.records, clicks...)
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, click := range clicks {
+		data, err := click.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("marshal click: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if l.file == nil {
+		file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return fmt.Errorf("open click log: %w", err)
+		}
+		l.file = file
+	}
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write clicks: %w", err)
+	}
+	return nil
+}
+
+func (l *clickLog) scan(ctx context.Context, fn func(model.Click)) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.path == "" {
+		for _, click := range l.records {
+			fn(click)
+		}
+		return nil
+	}
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open click log: %w", err)
+	}
+	defer file.Close()
+	_, err = scanLines(ctx, file, func(line []byte) error {
+		click := model.Click{}
+		if err := click.UnmarshalJSON(line); err != nil {
+			return err
+		}
+		fn(click)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read click log: %w", err)
+	}
+	return nil
+}
+
+// repairTail cuts a torn last line left by a crash, so the next click starts on a line of its own.
+func (l *clickLog) repairTail() error {
+	if l.path == "" {
+		return nil
+	}
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open click log: %w", err)
+	}
+	defer file.Close()
+	torn, err := scanLines(context.Background(), file, func(line []byte) error {
+		click := model.Click{}
+		return click.UnmarshalJSON(line)
+	})
+	if err != nil {
+		return fmt.Errorf("read click log: %w", err)
+	}
+	if torn >= 0 {
+		return cutTornTail(l.path, torn)
+	}
+	return nil
+}
+
+// retain rewrites the log keeping only the clicks keep accepts, the new file replaces the old one atomically.
+func (l *clickLog) retain(ctx context.Context, keep func(model.Click) bool) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	removed := 0
+	if l.path == "" {
+		kept := l.records[:0]
+		for _, click := range l.records {
+			if keep(click) {
+				kept = append(kept, click)
+			} else {
+				removed++
+			}
+		}
+		l.records = kept
+		return removed, nil
+	}
+	if l.file != nil {
+		err := errors.Join(l.file.Sync(), l.file.Close())
+		l.file = nil
+		if err != nil {
+			return 0, fmt.Errorf("close click log: %w", err)
+		}
+	}
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("open click log: %w", err)
+	}
+	defer file.Close()
+	// a torn last line is dropped with the rewrite
+	err = WriteFileAtomic(l.path, func(w io.Writer) error {
+		writer := bufio.NewWriter(w)
+		_, err := scanLines(ctx, file, func(line []byte) error {
+			click := model.Click{}
+			if err := click.UnmarshalJSON(line); err != nil {
+				return err
+			}
+			if !keep(click) {
+				removed++
+				return nil
+			}
+			writer.Write(line)
+			return writer.WriteByte('\n')
+		})
+		if err != nil {
+			return err
+		}
+		return writer.Flush()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("rewrite click log: %w", err)
+	}
+	return removed, nil
+}
+
+func (l *clickLog) close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := errors.Join(l.file.Sync(), l.file.Close())
+	l.file = nil
+	return err
+}
+
+type clickAggregator struct {
+	shortURL   string
+	from, to   time.Time
+	total      int64
+	visitors   map[string]struct{}
+	days       map[string]int64
+	hours      map[string]int64
+	referrers  map[string]int64
+	userAgents map[string]int64
+}
+
+func newClickAggregator(shortURL string, from, to time.Time) *clickAggregator {
+	return &clickAggregator{
+		shortURL:   shortURL,
+		from:       from,
+		to:         to,
+		visitors:   make(map[string]struct{}),
+		days:       make(map[string]int64),
+		hours:      make(map[string]int64),
+		referrers:  make(map[string]int64),
+		userAgents: make(map[string]int64),
+	}
+}
+
+func (a *clickAggregator) add(click model.Click) {
+	if click.ShortURL != a.shortURL || click.ClickedAt.Before(a.from) || !click.ClickedAt.Before(a.to) {
+		return
+	}
+	clickedAt := click.ClickedAt.UTC()
+	a.total++
+	a.visitors[click.IPPrefix+"|"+click.UserAgent] = struct{}{}
+	a.days[clickedAt.Format(time.DateOnly)]++
+	a.hours[clickedAt.Truncate(time.Hour).Format(time.RFC3339)]++
+	a.referrers[click.Referrer]++
+	a.userAgents[click.UserAgent]++
+}
+
+func (a *clickAggregator) result(top int) *model.ClickStats {
+	return &model.ClickStats{
+		Total:          a.total,
+		UniqueVisitors: int64(len(a.visitors)),
+		PerDay:         sortedClickCounts(a.days, false, 0),
+		PerHour:        sortedClickCounts(a.hours, false, 0),
+		TopReferrers:   sortedClickCounts(a.referrers, true, top),
+		TopUserAgents:  sortedClickCounts(a.userAgents, true, top),
+	}
+}
+
+// sortedClickCounts orders by value, or by clicks first when byClicks is set, and keeps at most limit entries if limit > 0.
+func sortedClickCounts(counts map[string]int64, byClicks bool, limit int) []model.ClickCount {
+	result := make([]model.ClickCount, 0, len(counts))
+	for value, clicks := range counts {
+		result = append(result, model.ClickCount{Value: value, Clicks: clicks})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if byClicks && result[i].Clicks != result[j].Clicks {
+			return result[i].Clicks > result[j].Clicks
+		}
+		return result[i].Value < result[j].Value
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStorage_WriteClicks(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	clickedAt := time.Date(2023, 11, 20, 10, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	clicks := make([]model.Click, 0, clickInsertChunk+1)
+	for i := 0; i < clickInsertChunk+1; i++ {
+		clicks = append(clicks, model.Click{
+			ShortURL:  "edVPg3ks",
+			ClickedAt: clickedAt.Add(time.Duration(i) * time.Second),
+			Referrer:  "https://ya.ru/",
+			UserAgent: "curl/8.4.0",
+			IPPrefix:  "203.0.113.0/24",
+		})
+	}
+	tests := []struct {
+		name string
+		open func() Storage
+		read func(t *testing.T, s Storage) []model.Click
+	}{
+		{
+			name: "memory",
+			open: func() Storage { return NewMemoryStorage() },
+			read: func(t *testing.T, s Storage) []model.Click { return s.(*MemoryStorage).clicks },
+		},
+		{
+			name: "file",
+			open: func() Storage {
+				return NewFileStorage(config.AppConfig{
+					ShortenedURLsFilePath: dir + "/short-url-db.json",
+					UserURLsFilePath:      dir + "/user-url-db.json",
+				})
+			},
+			read: func(t *testing.T, s Storage) []model.Click {
+				require.NoError(t, s.(*FileStorage).Close())
+				file, err := os.Open(dir + "/short-url-db.json.clicks")
+				require.NoError(t, err)
+				defer file.Close()
+				var got []model.Click
+				scanner := bufio.NewScanner(file)
+				for scanner.Scan() {
+					click := model.Click{}
+					require.NoError(t, click.UnmarshalJSON(scanner.Bytes()))
+					got = append(got, click)
+				}
+				require.NoError(t, scanner.Err())
+				return got
+			},
+		},
+		{
+			name: "sqlite",
+			open: func() Storage {
+				return NewDBStorage(config.AppConfig{DatabaseDSN: "sqlite://" + dir + "/shortener.db"})
+			},
+			read: func(t *testing.T, s Storage) []model.Click {
+				var got []model.Click
+				require.NoError(t, s.(*DBStorage).db.SelectContext(ctx, &got,
+					`SELECT short_url, clicked_at, referrer, user_agent, ip_prefix FROM clicks ORDER BY id;`))
+				return got
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open()
+			require.NoError(t, s.WriteClicks(ctx, clicks[:1]))
+			require.NoError(t, s.WriteClicks(ctx, clicks[1:]))
+
+			got := tt.read(t, s)
+			require.Len(t, got, len(clicks))
+			for i := range clicks {
+				assert.True(t, clicks[i].ClickedAt.Equal(got[i].ClickedAt))
+				got[i].ClickedAt = clicks[i].ClickedAt
+			}
+			assert.Equal(t, clicks, got)
+		})
+	}
+}
+
+func TestStorage_ReadClickStats(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	day := time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)
+	clicks := []model.Click{
+		// before the range
+		{ShortURL: "edVPg3ks", ClickedAt: day.Add(-time.Second), Referrer: "https://old.ru/", UserAgent: "curl", IPPrefix: "10.0.0.0/24"},
+		{ShortURL: "edVPg3ks", ClickedAt: day.Add(10*time.Hour + 5*time.Minute), Referrer: "https://ya.ru/", UserAgent: "curl", IPPrefix: "10.0.0.0/24"},
+		{ShortURL: "edVPg3ks", ClickedAt: day.Add(10*time.Hour + 30*time.Minute + 500*time.Millisecond), Referrer: "https://ya.ru/", UserAgent: "curl", IPPrefix: "10.0.0.0/24"},
+		{ShortURL: "edVPg3ks", ClickedAt: day.Add(11 * time.Hour), UserAgent: "firefox", IPPrefix: "10.0.0.0/24"},
+		// 02:00 on the next day in UTC
+		{ShortURL: "edVPg3ks", ClickedAt: time.Date(2023, 11, 21, 5, 0, 0, 0, time.FixedZone("MSK", 3*60*60)),
+			Referrer: "https://google.com/", UserAgent: "firefox", IPPrefix: "192.0.2.0/24"},
+		{ShortURL: "AbCdEf12", ClickedAt: day.Add(time.Hour), Referrer: "https://ya.ru/", UserAgent: "curl", IPPrefix: "10.0.0.0/24"},
+		// the end of the range is exclusive
+		{ShortURL: "edVPg3ks", ClickedAt: day.AddDate(0, 0, 2), Referrer: "https://ya.ru/", UserAgent: "curl", IPPrefix: "10.0.0.0/24"},
+	}
+	want := &model.ClickStats{
+		Total:          4,
+		UniqueVisitors: 3,
+		PerDay:         []model.ClickCount{{Value: "2023-11-20", Clicks: 3}, {Value: "2023-11-21", Clicks: 1}},
+		PerHour: []model.ClickCount{
+			{Value: "2023-11-20T10:00:00Z", Clicks: 2},
+			{Value: "2023-11-20T11:00:00Z", Clicks: 1},
+			{Value: "2023-11-21T02:00:00Z", Clicks: 1},
+		},
+		TopReferrers:  []model.ClickCount{{Value: "https://ya.ru/", Clicks: 2}, {Value: "", Clicks: 1}},
+		TopUserAgents: []model.ClickCount{{Value: "curl", Clicks: 2}, {Value: "firefox", Clicks: 2}},
+	}
+	tests := []struct {
+		name string
+		open func() Storage
+	}{
+		{name: "memory", open: func() Storage { return NewMemoryStorage() }},
+		{
+			name: "file",
+			open: func() Storage {
+				return NewFileStorage(config.AppConfig{
+					ShortenedURLsFilePath: dir + "/short-url-db.json",
+					UserURLsFilePath:      dir + "/user-url-db.json",
+				})
+			},
+		},
+		{
+			name: "sqlite",
+			open: func() Storage {
+				return NewDBStorage(config.AppConfig{DatabaseDSN: "sqlite://" + dir + "/shortener.db"})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open()
+			require.NoError(t, s.WriteClicks(ctx, clicks))
+
+			got, err := s.ReadClickStats(ctx, "edVPg3ks", day, day.AddDate(0, 0, 2), 2)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+
+			got, err = s.ReadClickStats(ctx, "unknown1", day, day.AddDate(0, 0, 2), 2)
+			require.NoError(t, err)
+			assert.Zero(t, got.Total)
+			assert.Empty(t, got.PerDay)
+		})
+	}
+}
+
+func TestClickLog_TornTail(t *testing.T) {
+	ctx := context.Background()
+	appConfig := config.AppConfig{ShortenedURLsFilePath: t.TempDir() + "/short-url-db.json"}
+	clickedAt := time.Date(2023, 11, 20, 10, 0, 0, 0, time.UTC)
+	fss := NewFileStorage(appConfig)
+	require.NoError(t, fss.WriteClicks(ctx, []model.Click{{ShortURL: "edVPg3ks", ClickedAt: clickedAt}}))
+	require.NoError(t, fss.Close())
+	file, err := os.OpenFile(fss.clicks.path, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"short_url":"edVPg3ks","clicked`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// the torn click is cut off, the next one starts on a line of its own
+	fss = NewFileStorage(appConfig)
+	defer fss.Close()
+	require.NoError(t, fss.WriteClicks(ctx, []model.Click{{ShortURL: "edVPg3ks", ClickedAt: clickedAt.Add(time.Minute)}}))
+	stats, err := fss.ReadClickStats(ctx, "edVPg3ks", clickedAt, clickedAt.Add(time.Hour), 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Total)
+
+	removed, err := fss.clicks.retain(ctx, func(click model.Click) bool { return click.ClickedAt.After(clickedAt) })
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	info, err := os.Stat(fss.clicks.path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestClickLog_CorruptedRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := dir + "/clicks"
+	clickedAt := time.Date(2023, 11, 20, 10, 0, 0, 0, time.UTC)
+	l := &clickLog{path: path}
+	require.NoError(t, l.append([]model.Click{{ShortURL: "edVPg3ks", ClickedAt: clickedAt}}))
+	_, err := l.file.WriteString("garbage\n")
+	require.NoError(t, err)
+	require.NoError(t, l.append([]model.Click{{ShortURL: "edVPg3ks", ClickedAt: clickedAt}}))
+	require.NoError(t, l.close())
+	before, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, l.repairTail(), errCorruption)
+	assert.ErrorIs(t, l.scan(ctx, func(model.Click) {}), errCorruption)
+	_, err = l.retain(ctx, func(model.Click) bool { return true })
+	assert.ErrorIs(t, err, errCorruption)
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, before, after, "clicks after a damaged record must not be dropped silently")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "a failed rewrite leaves no temporary file behind")
+	assert.Equal(t, "clicks", entries[0].Name())
+}
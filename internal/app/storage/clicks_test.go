@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStorage_ConsumeClick(t *testing.T) {
+	const (
+		maxClicks = 5
+		requests  = 50
+	)
+	ctx := context.Background()
+	dir := t.TempDir()
+	fileConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/short-url-db.json",
+		UserURLsFilePath:      dir + "/user-url-db.json",
+		FileSyncPolicy:        SyncAlways,
+	}
+	tests := []struct {
+		name   string
+		open   func() Storage
+		reopen func() Storage
+	}{
+		{name: "memory", open: func() Storage { return NewMemoryStorage() }},
+		{
+			name:   "file",
+			open:   func() Storage { return NewFileStorage(fileConfig) },
+			reopen: func() Storage { return NewFileStorage(fileConfig) },
+		},
+		{
+			name: "sqlite",
+			open: func() Storage {
+				return NewDBStorage(config.AppConfig{DatabaseDSN: "sqlite://" + dir + "/shortener.db"})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open()
+			require.NoError(t, s.WriteShortenedURL(ctx, &model.ShortenedURL{
+				UUID: uuid.New(), ShortURL: "onetime1", OriginalURL: "http://secret.ru",
+				ClicksLeft: sql.NullInt64{Int64: maxClicks, Valid: true},
+			}))
+			require.NoError(t, s.WriteShortenedURL(ctx, &model.ShortenedURL{
+				UUID: uuid.New(), ShortURL: "unlimit1", OriginalURL: "http://public.ru",
+			}))
+
+			var allowed atomic.Int64
+			wg := sync.WaitGroup{}
+			for i := 0; i < requests; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ok, err := s.ConsumeClick(ctx, "onetime1")
+					assert.NoError(t, err)
+					if ok {
+						allowed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			assert.Equal(t, int64(maxClicks), allowed.Load())
+
+			ok, err := s.ConsumeClick(ctx, "unlimit1")
+			require.NoError(t, err)
+			assert.False(t, ok, "links without a budget are not click-limited")
+
+			if tt.reopen != nil {
+				require.NoError(t, s.(*FileStorage).Close())
+				s = tt.reopen()
+			}
+			got, err := s.ReadShortenedURL(ctx, "onetime1")
+			require.NoError(t, err)
+			assert.Equal(t, sql.NullInt64{Int64: 0, Valid: true}, got.ClicksLeft)
+			ok, err = s.ConsumeClick(ctx, "onetime1")
+			require.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/XSAM/otelsql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pressly/goose/v3"
+	"github.com/ujwegh/shortener/migrations"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"io/fs"
+	"strings"
+)
+
+const (
+	driverPgx    = "pgx"
+	driverSQLite = "sqlite3"
+)
+
+var sqliteSchemes = []string{"sqlite://", "sqlite3://"}
+
+// Open connects through an instrumented driver, every statement issued within a traced request
+// becomes a span carrying its SQL text.
+func Open(driverName, dataSourceName string) *sqlx.DB {
+	system := semconv.DBSystemPostgreSQL
+	if driverName == driverSQLite {
+		system = semconv.DBSystemSqlite
+	}
+	sqlDB, err := otelsql.Open(driverName, dataSourceName,
+		otelsql.WithAttributes(system),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+			OmitConnectorConnect: true,
+			SpanFilter:           tracedOnly,
+		}))
+	if err != nil {
+		panic(err)
+	}
+	db := sqlx.NewDb(sqlDB, driverName)
+	if driverName == driverSQLite {
+		// sqlite allows a single writer, serialize access instead of failing with SQLITE_BUSY
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(10)
+	}
+	return db
+}
+
+// tracedOnly skips statements outside of a trace like migrations and background purges.
+func tracedOnly(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+	return trace.SpanContextFromContext(ctx).IsValid()
+}
+
+// ParseDSN maps a database DSN to the sql driver and its data source name.
+// DSNs like sqlite:///var/lib/shortener.db select SQLite, everything else is passed to pgx.
+func ParseDSN(dsn string) (string, string) {
+	for _, scheme := range sqliteSchemes {
+		if strings.HasPrefix(dsn, scheme) {
+			path := strings.TrimPrefix(dsn, scheme)
+			separator := "?"
+			if strings.Contains(path, "?") {
+				separator = "&"
+			}
+			return driverSQLite, path + separator + "_foreign_keys=on&_busy_timeout=5000"
+		}
+	}
+	return driverPgx, dsn
+}
+
+func IsSQLiteDSN(dsn string) bool {
+	driverName, _ := ParseDSN(dsn)
+	return driverName == driverSQLite
+}
+
+func dialect(db *sqlx.DB) string {
+	if db.DriverName() == driverSQLite {
+		return migrations.DialectSQLite
+	}
+	return migrations.DialectPostgres
+}
+
+func Migrate(db *sqlx.DB, dir string) error {
+	err := goose.SetDialect(dialect(db))
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	err = goose.Up(db.DB, dir)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+func MigrateFS(db *sqlx.DB, migrationsFS fs.FS, dir string) error {
+	if dir == "" {
+		dir = "."
+	}
+	goose.SetBaseFS(migrationsFS)
+	defer func() {
+		goose.SetBaseFS(nil)
+	}()
+	return Migrate(db, dir)
+}
@@ -10,19 +10,28 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 	"github.com/ujwegh/shortener/internal/app/config"
 	appErrors "github.com/ujwegh/shortener/internal/app/errors"
 	"github.com/ujwegh/shortener/internal/app/model"
 	"github.com/ujwegh/shortener/migrations"
 	"strings"
+	"time"
 )
 
+const exportPageSize = 500
+
+const shortenedURLColumns = `uuid, short_url, original_url, correlation_id, is_deleted, deleted_at, expires_at, clicks_left, password_hash`
+
 type DBStorage struct {
-	db *sqlx.DB
+	db     *sqlx.DB
+	dsn    string
+	events eventBus
 }
 
 func (storage *DBStorage) ReadUserURLs(ctx context.Context, uid *uuid.UUID) ([]model.ShortenedURL, error) {
-	query := `SELECT su.uuid, su.short_url, su.original_url, su.correlation_id, su.is_deleted
+	query := `SELECT su.uuid, su.short_url, su.original_url, su.correlation_id, su.is_deleted, su.deleted_at, su.expires_at,
+	su.clicks_left, su.password_hash
 	FROM shortened_urls su
 	JOIN user_urls uu on su.uuid = uu.shortened_url_uuid
 	WHERE uu.uuid = $1;`
@@ -38,14 +47,19 @@ func (storage *DBStorage) ReadUserURLs(ctx context.Context, uid *uuid.UUID) ([]m
 }
 
 func NewDBStorage(cfg config.AppConfig) *DBStorage {
-	db := Open(cfg.DatabaseDSN)
+	db := Open(ParseDSN(cfg.DatabaseDSN))
 	// Migrate the database
-	err := MigrateFS(db, migrations.FS, ".")
+	migrationsFS, dir, err := migrations.ForDialect(dialect(db))
+	if err != nil {
+		panic(err)
+	}
+	err = MigrateFS(db, migrationsFS, dir)
 	if err != nil {
 		panic(err)
 	}
 
-	return &DBStorage{db: db}
+	_, dsn := ParseDSN(cfg.DatabaseDSN)
+	return &DBStorage{db: db, dsn: dsn}
 }
 
 func (storage *DBStorage) WriteShortenedURL(ctx context.Context, shortenedURL *model.ShortenedURL) error {
@@ -53,62 +67,86 @@ func (storage *DBStorage) WriteShortenedURL(ctx context.Context, shortenedURL *m
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
-	insertQuery := `INSERT INTO shortened_urls (uuid, short_url, original_url) VALUES ($1, $2, $3);`
+	insertQuery := `INSERT INTO shortened_urls (uuid, short_url, original_url, correlation_id, is_deleted, expires_at, clicks_left,
+		password_hash, deleted_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);`
 	stmt, err := tx.PrepareContext(ctx, insertQuery)
 	if err != nil {
 		return fmt.Errorf("prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, shortenedURL.UUID, shortenedURL.ShortURL, shortenedURL.OriginalURL)
+	_, err = stmt.ExecContext(ctx, shortenedURL.UUID, shortenedURL.ShortURL, shortenedURL.OriginalURL,
+		shortenedURL.CorrelationID, shortenedURL.DeletedFlag, utcTime(shortenedURL.ExpiresAt),
+		shortenedURL.ClicksLeft, shortenedURL.PasswordHash, utcTime(shortenedURL.DeletedAt))
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		if err := tx.Rollback(); err != nil {
+			return fmt.Errorf("rollback transaction: %w", err)
+		}
+		if isShortURLCollision(err) {
+			return appErrors.New(err, "short url collision")
+		}
+		if isUniqueViolation(err) {
 			return appErrors.New(err, "unique violation")
 		}
+		return fmt.Errorf("write shortened URL: %w", err)
+	}
+	err = storage.notify(ctx, tx, EventWrite, []string{shortenedURL.ShortURL, shortenedURL.OriginalURL})
+	if err != nil {
 		if err := tx.Rollback(); err != nil {
 			return fmt.Errorf("rollback transaction: %w", err)
 		}
-		return fmt.Errorf("write shortened URL: %w", err)
+		return err
 	}
 	return tx.Commit()
 }
 
 func (storage *DBStorage) ReadShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
-	query := `SELECT uuid, short_url, original_url, correlation_id, is_deleted
+	query := `SELECT ` + shortenedURLColumns + `
 	FROM shortened_urls WHERE short_url = $1 or original_url = $1;`
 	shortenedURL := &model.ShortenedURL{}
 	err := storage.db.GetContext(ctx, shortenedURL, query, url)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("shortened URL not found")
+			return nil, ErrNotFound
 		}
 		return nil, fmt.Errorf("read shortened URL: %w", err)
 	}
 	return shortenedURL, nil
 }
 
+// DB returns the connection pool, e.g. to export its stats.
+func (storage *DBStorage) DB() *sql.DB {
+	return storage.db.DB
+}
+
 func (storage *DBStorage) Ping(ctx context.Context) error {
 	return storage.db.PingContext(ctx)
 }
 
 func (storage *DBStorage) WriteBatchShortenedURLSlice(ctx context.Context, urlsSlice []model.ShortenedURL) error {
-	tx, err := storage.db.BeginTx(ctx, nil)
+	tx, err := storage.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
-	query := `INSERT INTO shortened_urls (uuid, short_url, original_url, correlation_id) 
-		VALUES (:uuid, :short_url, :original_url, :correlation_id);`
+	query := `INSERT INTO shortened_urls (uuid, short_url, original_url, correlation_id, expires_at, clicks_left, password_hash) 
+		VALUES (:uuid, :short_url, :original_url, :correlation_id, :expires_at, :clicks_left, :password_hash);`
 
 	toSave := make([]model.ShortenedURL, 0, len(urlsSlice)*20)
 	for i, url := range urlsSlice {
+		url.ExpiresAt = utcTime(url.ExpiresAt)
 		toSave = append(toSave, url)
 		if i == len(urlsSlice)-1 || len(toSave) == 20 {
-			_, err := storage.db.NamedExecContext(ctx, query, toSave)
+			_, err := tx.NamedExecContext(ctx, query, toSave)
 			if err != nil {
 				if err := tx.Rollback(); err != nil {
 					return fmt.Errorf("rollback transaction: %w", err)
 				}
+				if isShortURLCollision(err) {
+					return appErrors.New(err, "short url collision")
+				}
+				if isUniqueViolation(err) {
+					return appErrors.New(err, "unique violation")
+				}
 				return fmt.Errorf("write batch shortened URL: %w", err)
 			}
 			toSave = make([]model.ShortenedURL, 0, len(urlsSlice)*20)
@@ -116,6 +154,16 @@ func (storage *DBStorage) WriteBatchShortenedURLSlice(ctx context.Context, urlsS
 			continue
 		}
 	}
+	keys := make([]string, 0, len(urlsSlice)*2)
+	for _, url := range urlsSlice {
+		keys = append(keys, url.ShortURL, url.OriginalURL)
+	}
+	if err := storage.notify(ctx, tx, EventWrite, keys); err != nil {
+		if err := tx.Rollback(); err != nil {
+			return fmt.Errorf("rollback transaction: %w", err)
+		}
+		return err
+	}
 	return tx.Commit()
 }
 
@@ -137,25 +185,51 @@ func (storage *DBStorage) CreateUserURL(ctx context.Context, userURL *model.User
 		if err := tx.Rollback(); err != nil {
 			return fmt.Errorf("rollback transaction: %w", err)
 		}
+		if isUniqueViolation(err) {
+			return appErrors.New(err, "unique violation")
+		}
 		return fmt.Errorf("write user URL: %w", err)
 	}
 	return tx.Commit()
 }
 
-func (storage *DBStorage) DeleteBulk(ctx context.Context, userURLs map[uuid.UUID][]string) error {
+func (storage *DBStorage) DeleteBulk(ctx context.Context, buffer map[uuid.UUID][]string) error {
+	userURLs := make(map[uuid.UUID][]string, len(buffer))
+	for userUID, urls := range buffer {
+		if len(urls) > 0 {
+			userURLs[userUID] = urls
+		}
+	}
+	if len(userURLs) == 0 {
+		return nil
+	}
 	tx, err := storage.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
 
-	query := `UPDATE shortened_urls SET is_deleted = true 
+	query := `UPDATE shortened_urls SET is_deleted = true, deleted_at = COALESCE(shortened_urls.deleted_at, $1)
               FROM user_urls uu
               WHERE shortened_urls.uuid = uu.shortened_url_uuid AND (`
 
-	var params []interface{}
-	paramIndex := 1
+	params := []interface{}{utcTime(sql.NullTime{Time: time.Now(), Valid: true})}
+	paramIndex := 2
 
 	for userUID, urls := range userURLs {
+		if storage.db.DriverName() == driverSQLite {
+			// sqlite has no arrays, expand the keys into an IN list
+			placeholders := make([]string, len(urls))
+			for i := range urls {
+				placeholders[i] = fmt.Sprintf("$%d", paramIndex+1+i)
+			}
+			query += fmt.Sprintf("(uu.uuid = $%d AND shortened_urls.short_url IN (%s)) OR ", paramIndex, strings.Join(placeholders, ", "))
+			params = append(params, userUID)
+			for _, url := range urls {
+				params = append(params, url)
+			}
+			paramIndex += 1 + len(urls)
+			continue
+		}
 		query += fmt.Sprintf("(uu.uuid = $%d AND shortened_urls.short_url = ANY($%d)) OR ", paramIndex, paramIndex+1)
 		params = append(params, userUID, pq.Array(urls))
 		paramIndex += 2
@@ -171,5 +245,181 @@ func (storage *DBStorage) DeleteBulk(ctx context.Context, userURLs map[uuid.UUID
 		return fmt.Errorf("delete user URLs: %w", err)
 	}
 
+	var keys []string
+	for _, urls := range userURLs {
+		keys = append(keys, urls...)
+	}
+	if err := storage.notify(ctx, tx, EventDelete, keys); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("rollback transaction: %w", rbErr)
+		}
+		return err
+	}
 	return tx.Commit()
 }
+
+func (storage *DBStorage) RestoreBulk(ctx context.Context, userUID uuid.UUID, shortURLs []string) ([]string, error) {
+	if len(shortURLs) == 0 {
+		return nil, nil
+	}
+	tx, err := storage.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	keyCondition := "shortened_urls.short_url = ANY($2)"
+	params := []interface{}{userUID, pq.Array(shortURLs)}
+	if storage.db.DriverName() == driverSQLite {
+		placeholders := make([]string, len(shortURLs))
+		params = []interface{}{userUID}
+		for i, shortURL := range shortURLs {
+			placeholders[i] = fmt.Sprintf("$%d", i+2)
+			params = append(params, shortURL)
+		}
+		keyCondition = fmt.Sprintf("shortened_urls.short_url IN (%s)", strings.Join(placeholders, ", "))
+	}
+	query := `UPDATE shortened_urls SET is_deleted = false, deleted_at = NULL
+		FROM user_urls uu
+		WHERE shortened_urls.uuid = uu.shortened_url_uuid AND uu.uuid = $1 AND shortened_urls.is_deleted AND ` +
+		keyCondition + ` RETURNING shortened_urls.short_url;`
+
+	var restored []string
+	if err := tx.SelectContext(ctx, &restored, query, params...); err != nil {
+		return nil, fmt.Errorf("restore user URLs: %w", err)
+	}
+	if err := storage.notify(ctx, tx, EventWrite, restored); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return restored, nil
+}
+
+func (storage *DBStorage) ExportShortenedURLs(ctx context.Context, after uuid.UUID, fn func(model.ShortenedURL) error) error {
+	query := `SELECT ` + shortenedURLColumns + `
+	FROM shortened_urls WHERE uuid > $1 ORDER BY uuid LIMIT $2;`
+	for {
+		page := make([]model.ShortenedURL, 0, exportPageSize)
+		err := storage.db.SelectContext(ctx, &page, query, after, exportPageSize)
+		if err != nil {
+			return fmt.Errorf("export shortened URLs: %w", err)
+		}
+		for _, shortenedURL := range page {
+			if err := fn(shortenedURL); err != nil {
+				return err
+			}
+			after = shortenedURL.UUID
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+func (storage *DBStorage) ExportUserURLs(ctx context.Context, after model.UserURL, fn func(model.UserURL) error) error {
+	query := `SELECT uuid, shortened_url_uuid FROM user_urls
+	WHERE (uuid, shortened_url_uuid) > ($1, $2) ORDER BY uuid, shortened_url_uuid LIMIT $3;`
+	for {
+		page := make([]model.UserURL, 0, exportPageSize)
+		err := storage.db.SelectContext(ctx, &page, query, after.UUID, after.ShortenedURLUUID, exportPageSize)
+		if err != nil {
+			return fmt.Errorf("export user URLs: %w", err)
+		}
+		for _, userURL := range page {
+			if err := fn(userURL); err != nil {
+				return err
+			}
+			after = userURL
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+// ConsumeClick spends one redirect of a click-limited link, false means the budget is used up.
+func (storage *DBStorage) ConsumeClick(ctx context.Context, shortURL string) (bool, error) {
+	query := `UPDATE shortened_urls SET clicks_left = clicks_left - 1
+	WHERE short_url = $1 AND clicks_left > 0 RETURNING clicks_left;`
+	var clicksLeft int64
+	err := storage.db.GetContext(ctx, &clicksLeft, query, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("consume click: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteExpired hard deletes up to limit links that expired before the given time, earliest first,
+// together with their user links and clicks.
+func (storage *DBStorage) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	tx, err := storage.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var deleted []model.ShortenedURL
+	err = tx.SelectContext(ctx, &deleted, `DELETE FROM shortened_urls WHERE uuid IN
+		(SELECT uuid FROM shortened_urls WHERE expires_at < $1 ORDER BY expires_at, uuid LIMIT $2)
+		RETURNING `+shortenedURLColumns+`;`, utcTime(sql.NullTime{Time: before, Valid: true}), limit)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired shortened URLs: %w", err)
+	}
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+	if err := deleteDependents(ctx, tx, deleted); err != nil {
+		return 0, fmt.Errorf("delete expired URLs: %w", err)
+	}
+	keys := make([]string, 0, len(deleted)*2)
+	for _, shortenedURL := range deleted {
+		keys = append(keys, shortenedURL.ShortURL, shortenedURL.OriginalURL)
+	}
+	if err := storage.notify(ctx, tx, EventDelete, keys); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+	return len(deleted), nil
+}
+
+// utcTime stores times in UTC, sqlite compares them as strings.
+func utcTime(t sql.NullTime) sql.NullTime {
+	if t.Valid {
+		t.Time = t.Time.UTC()
+	}
+	return t
+}
+
+// isShortURLCollision reports a unique violation of the short_url column,
+// other unique violations mean the original URL or the record itself already exists.
+func isShortURLCollision(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgerrcode.UniqueViolation && pgErr.ConstraintName == "shortened_urls_short_url_key"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique &&
+			strings.Contains(sqliteErr.Error(), "shortened_urls.short_url")
+	}
+	return false
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgerrcode.UniqueViolation
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
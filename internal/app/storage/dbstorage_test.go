@@ -8,6 +8,8 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
 	appErrors "github.com/ujwegh/shortener/internal/app/errors"
 	"github.com/ujwegh/shortener/internal/app/model"
 	"reflect"
@@ -21,7 +23,11 @@ CREATE TABLE IF NOT EXISTS shortened_urls
     short_url TEXT UNIQUE NOT NULL,
     original_url TEXT NOT NULL,
     correlation_id TEXT,
-    is_deleted BOOLEAN DEFAULT FALSE NOT NULL
+    is_deleted BOOLEAN DEFAULT FALSE NOT NULL,
+    deleted_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    clicks_left INTEGER,
+    password_hash TEXT
 );
 
 CREATE UNIQUE INDEX IF NOT EXISTS shortened_urls_correlation_id_idx ON shortened_urls (correlation_id)
@@ -338,7 +344,7 @@ VALUES ('c12ff52b-970a-479c-bd45-1c6043c98736', 'abxW9ymI', 'https://ya.ru', 'co
 			if err != nil {
 				if tt.wantErr == true {
 					target := &appErrors.ShortenerError{}
-					assert.True(t, true, errors.As(err, target) && target.Msg() == "unique violation")
+					assert.True(t, errors.As(err, target) && target.Msg() == "unique violation")
 				} else {
 					t.Errorf("WriteShortenedURL() error = %v, wantErr %v", err, tt.wantErr)
 				}
@@ -436,3 +442,162 @@ values ('a16ad92b-b277-4640-a44e-167001cf5b86', 'c12ff52b-970a-479c-bd45-1c6043c
 		})
 	}
 }
+
+func TestDBStorage_DeleteBulk(t *testing.T) {
+	db := setupInMemoryDB(t)
+	defer db.Close()
+
+	dbTestData := `
+DELETE FROM user_urls;
+DELETE FROM shortened_urls;
+INSERT INTO shortened_urls (uuid, short_url, original_url, correlation_id, is_deleted) 
+VALUES ('c12ff52b-970a-479c-bd45-1c6043c98736', 'abxW9ymI', 'https://ya.ru', null, false),
+       ('cb280de3-c5ba-4fab-92d9-30bd72282afc', 'E9M9zboP', 'https://google.com', null, false),
+       ('f2c7c737-b70d-49cb-a0eb-079e10e8ed29', 'BDurKLrm', 'https://yandex.ru', null, false);
+
+INSERT INTO user_urls (uuid, shortened_url_uuid)
+values ('a16ad92b-b277-4640-a44e-167001cf5b86', 'c12ff52b-970a-479c-bd45-1c6043c98736'),
+       ('a16ad92b-b277-4640-a44e-167001cf5b86', 'cb280de3-c5ba-4fab-92d9-30bd72282afc'),
+       ('929a3464-5e15-4269-8707-99ce9a522c14', 'f2c7c737-b70d-49cb-a0eb-079e10e8ed29');
+`
+	owner := uuid.MustParse("a16ad92b-b277-4640-a44e-167001cf5b86")
+
+	tests := []struct {
+		name        string
+		userURLs    map[uuid.UUID][]string
+		wantDeleted []string
+	}{
+		{
+			name:        "delete owned urls",
+			userURLs:    map[uuid.UUID][]string{owner: {"abxW9ymI", "E9M9zboP"}},
+			wantDeleted: []string{"abxW9ymI", "E9M9zboP"},
+		},
+		{
+			name:        "skip not owned urls",
+			userURLs:    map[uuid.UUID][]string{owner: {"abxW9ymI", "BDurKLrm"}},
+			wantDeleted: []string{"abxW9ymI"},
+		},
+		{
+			name:        "empty buffer",
+			userURLs:    map[uuid.UUID][]string{},
+			wantDeleted: []string{},
+		},
+		{
+			name:        "user without keys",
+			userURLs:    map[uuid.UUID][]string{owner: {"E9M9zboP"}, uuid.New(): {}},
+			wantDeleted: []string{"E9M9zboP"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Exec(dbTestData)
+			if err != nil {
+				t.Fatalf("could not insert test data: %v", err)
+			}
+			storage := &DBStorage{
+				db: db,
+			}
+			buffer := make(map[uuid.UUID][]string, len(tt.userURLs))
+			for userUID, urls := range tt.userURLs {
+				buffer[userUID] = urls
+			}
+			if err := storage.DeleteBulk(context.Background(), buffer); err != nil {
+				t.Fatalf("DeleteBulk() error = %v", err)
+			}
+			assert.Equal(t, tt.userURLs, buffer, "the caller's buffer must not be modified")
+			deleted := make([]string, 0)
+			err = db.Select(&deleted, "SELECT short_url FROM shortened_urls WHERE is_deleted ORDER BY short_url")
+			if err != nil {
+				t.Fatalf("could not select deleted urls: %v", err)
+			}
+			assert.ElementsMatch(t, tt.wantDeleted, deleted)
+		})
+	}
+}
+
+func TestDBStorage_RestoreBulk(t *testing.T) {
+	db := setupInMemoryDB(t)
+	defer db.Close()
+
+	dbTestData := `
+DELETE FROM user_urls;
+DELETE FROM shortened_urls;
+INSERT INTO shortened_urls (uuid, short_url, original_url, correlation_id, is_deleted) 
+VALUES ('c12ff52b-970a-479c-bd45-1c6043c98736', 'abxW9ymI', 'https://ya.ru', null, true),
+       ('cb280de3-c5ba-4fab-92d9-30bd72282afc', 'E9M9zboP', 'https://google.com', null, false),
+       ('f2c7c737-b70d-49cb-a0eb-079e10e8ed29', 'BDurKLrm', 'https://yandex.ru', null, true);
+
+INSERT INTO user_urls (uuid, shortened_url_uuid)
+values ('a16ad92b-b277-4640-a44e-167001cf5b86', 'c12ff52b-970a-479c-bd45-1c6043c98736'),
+       ('a16ad92b-b277-4640-a44e-167001cf5b86', 'cb280de3-c5ba-4fab-92d9-30bd72282afc'),
+       ('929a3464-5e15-4269-8707-99ce9a522c14', 'f2c7c737-b70d-49cb-a0eb-079e10e8ed29');
+`
+	owner := uuid.MustParse("a16ad92b-b277-4640-a44e-167001cf5b86")
+
+	tests := []struct {
+		name         string
+		shortURLs    []string
+		wantRestored []string
+		wantDeleted  []string
+	}{
+		{
+			name:         "restore owned url",
+			shortURLs:    []string{"abxW9ymI"},
+			wantRestored: []string{"abxW9ymI"},
+			wantDeleted:  []string{"BDurKLrm"},
+		},
+		{
+			name:         "skip not owned, not deleted and unknown urls",
+			shortURLs:    []string{"E9M9zboP", "BDurKLrm", "unknown"},
+			wantRestored: nil,
+			wantDeleted:  []string{"abxW9ymI", "BDurKLrm"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.Exec(dbTestData)
+			require.NoError(t, err)
+			storage := &DBStorage{
+				db: db,
+			}
+			restored, err := storage.RestoreBulk(context.Background(), owner, tt.shortURLs)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.wantRestored, restored)
+
+			deleted := make([]string, 0)
+			require.NoError(t, db.Select(&deleted, "SELECT short_url FROM shortened_urls WHERE is_deleted ORDER BY short_url"))
+			assert.ElementsMatch(t, tt.wantDeleted, deleted)
+		})
+	}
+}
+
+func TestNewDBStorage_SQLite(t *testing.T) {
+	cfg := config.AppConfig{DatabaseDSN: "sqlite://" + t.TempDir() + "/shortener.db"}
+	storage := NewDBStorage(cfg)
+	defer storage.db.Close()
+	ctx := context.Background()
+
+	shortenedURL := &model.ShortenedURL{
+		UUID:        uuid.New(),
+		ShortURL:    "abxW9ymI",
+		OriginalURL: "https://ya.ru",
+	}
+	userUID := uuid.New()
+	require.NoError(t, storage.WriteShortenedURL(ctx, shortenedURL))
+	require.NoError(t, storage.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}))
+
+	err := storage.WriteShortenedURL(ctx, &model.ShortenedURL{UUID: uuid.New(), ShortURL: "E9M9zboP", OriginalURL: "https://ya.ru"})
+	target := &appErrors.ShortenerError{}
+	assert.True(t, errors.As(err, target) && target.Msg() == "unique violation")
+	err = storage.WriteShortenedURL(ctx, &model.ShortenedURL{UUID: uuid.New(), ShortURL: "abxW9ymI", OriginalURL: "https://google.com"})
+	assert.True(t, errors.As(err, target) && target.Msg() == "short url collision")
+
+	require.NoError(t, storage.DeleteBulk(ctx, map[uuid.UUID][]string{userUID: {"abxW9ymI"}}))
+	got, err := storage.ReadUserURLs(ctx, &userUID)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.True(t, got[0].DeletedFlag)
+
+	// running migrations again on an up-to-date database is a no-op
+	require.NoError(t, NewDBStorage(cfg).db.Close())
+}
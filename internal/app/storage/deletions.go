@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	appErrors "github.com/ujwegh/shortener/internal/app/errors"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"os"
+	"sync"
+)
+
+// DeletionQueue persists accepted deletion tasks until they are applied, so a deletion acknowledged
+// to the user survives a restart. The memory storage keeps the queue only for the life of the process.
+type DeletionQueue interface {
+	// EnqueueDeletions stores all tasks or none of them.
+	EnqueueDeletions(ctx context.Context, tasks []model.DeletionTask) error
+	// PendingDeletions returns the stored tasks in the order they were accepted.
+	PendingDeletions(ctx context.Context) ([]model.DeletionTask, error)
+	// CompleteDeletions drops applied tasks, unknown IDs are ignored.
+	CompleteDeletions(ctx context.Context, ids []uuid.UUID) error
+}
+
+// deletionRow keeps the short keys of a task as a JSON array, sqlite has no array type.
+type deletionRow struct {
+	model.DeletionTask
+	ShortURLs string `db:"short_urls"`
+}
+
+func (storage *DBStorage) EnqueueDeletions(ctx context.Context, tasks []model.DeletionTask) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	rows := make([]deletionRow, 0, len(tasks))
+	for _, task := range tasks {
+		shortURLs, err := json.Marshal(task.ShortURLKeys)
+		if err != nil {
+			return fmt.Errorf("marshal short urls: %w", err)
+		}
+		task.CreatedAt = task.CreatedAt.UTC()
+		rows = append(rows, deletionRow{DeletionTask: task, ShortURLs: string(shortURLs)})
+	}
+	query := `INSERT INTO pending_deletions (id, job_id, user_uuid, short_urls, created_at)
+		VALUES (:id, :job_id, :user_uuid, :short_urls, :created_at);`
+	_, err := storage.db.NamedExecContext(ctx, query, rows)
+	if err != nil {
+		return appErrors.New(err, "enqueue deletions")
+	}
+	return nil
+}
+
+func (storage *DBStorage) PendingDeletions(ctx context.Context) ([]model.DeletionTask, error) {
+	query := `SELECT id, job_id, user_uuid, short_urls, created_at FROM pending_deletions ORDER BY created_at, id;`
+	var rows []deletionRow
+	if err := storage.db.SelectContext(ctx, &rows, query); err != nil {
+		return nil, appErrors.New(err, "read pending deletions")
+	}
+	tasks := make([]model.DeletionTask, 0, len(rows))
+	for _, row := range rows {
+		task := row.DeletionTask
+		if err := json.Unmarshal([]byte(row.ShortURLs), &task.ShortURLKeys); err != nil {
+			return nil, fmt.Errorf("unmarshal short urls of deletion %s: %w", task.ID, err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (storage *DBStorage) CompleteDeletions(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	tx, err := storage.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM pending_deletions WHERE id = $1;`, id); err != nil {
+			return appErrors.New(err, "complete deletions")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) EnqueueDeletions(ctx context.Context, tasks []model.DeletionTask) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ms.deletions.enqueue(tasks)
+}
+
+func (ms *MemoryStorage) PendingDeletions(ctx context.Context) ([]model.DeletionTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ms.deletions.pending(), nil
+}
+
+func (ms *MemoryStorage) CompleteDeletions(ctx context.Context, ids []uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ms.deletions.complete(ids)
+}
+
+func (fs *FileStorage) EnqueueDeletions(ctx context.Context, tasks []model.DeletionTask) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fs.deletions.enqueue(tasks)
+}
+
+func (fs *FileStorage) PendingDeletions(ctx context.Context) ([]model.DeletionTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.deletions.pending(), nil
+}
+
+func (fs *FileStorage) CompleteDeletions(ctx context.Context, ids []uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fs.deletions.complete(ids)
+}
+
+// spoolRecord is a line of the deletion spool, either an accepted task or the IDs of applied ones.
+type spoolRecord struct {
+	Task *model.DeletionTask `json:"task,omitempty"`
+	Done []uuid.UUID         `json:"done,omitempty"`
+}
+
+// deletionSpool journals deletion tasks to a JSON-lines file. Accepted tasks are synced before
+// EnqueueDeletions returns, the file is truncated whenever no task is pending.
+type deletionSpool struct {
+	path  string // empty keeps the tasks in memory only
+	file  *os.File
+	tasks []model.DeletionTask // pending, in the order they were accepted
+	mutex sync.Mutex
+}
+
+func newDeletionSpool(path string) (*deletionSpool, error) {
+	spool := &deletionSpool{path: path}
+	if path == "" {
+		return spool, nil
+	}
+	if err := spool.load(); err != nil {
+		return nil, err
+	}
+	return spool, nil
+}
+
+func (s *deletionSpool) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open deletion spool: %w", err)
+	}
+	defer file.Close()
+	torn, err := scanLines(context.Background(), file, func(line []byte) error {
+		record := spoolRecord{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		if record.Task != nil {
+			s.tasks = append(s.tasks, *record.Task)
+		}
+		s.remove(record.Done)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("read deletion spool: %w", err)
+	}
+	if torn >= 0 {
+		// the task of a torn last line was never acknowledged, it is synced before EnqueueDeletions returns
+		if err := cutTornTail(s.path, torn); err != nil {
+			return fmt.Errorf("truncate deletion spool: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *deletionSpool) enqueue(tasks []model.DeletionTask) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.path != "" {
+		var buf bytes.Buffer
+		for i := range tasks {
+			data, err := json.Marshal(spoolRecord{Task: &tasks[i]})
+			if err != nil {
+				return fmt.Errorf("marshal deletion: %w", err)
+			}
+			buf.Write(data)
+			buf.WriteByte('\n')
+		}
+		if err := s.write(buf.Bytes()); err != nil {
+			return err
+		}
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("sync deletion spool: %w", err)
+		}
+	}
+	s.tasks = append(s.tasks, tasks...)
+	return nil
+}
+
+func (s *deletionSpool) pending() []model.DeletionTask {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tasks := make([]model.DeletionTask, len(s.tasks))
+	copy(tasks, s.tasks)
+	return tasks
+}
+
+func (s *deletionSpool) complete(ids []uuid.UUID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.remove(ids)
+	if s.path == "" {
+		return nil
+	}
+	if len(s.tasks) == 0 {
+		return s.truncate()
+	}
+	// a lost done record only applies the deletion once more on replay, no sync needed
+	data, err := json.Marshal(spoolRecord{Done: ids})
+	if err != nil {
+		return fmt.Errorf("marshal applied deletions: %w", err)
+	}
+	return s.write(append(data, '\n'))
+}
+
+func (s *deletionSpool) remove(ids []uuid.UUID) {
+	if len(ids) == 0 {
+		return
+	}
+	done := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		done[id] = struct{}{}
+	}
+	tasks := s.tasks[:0]
+	for _, task := range s.tasks {
+		if _, ok := done[task.ID]; !ok {
+			tasks = append(tasks, task)
+		}
+	}
+	s.tasks = tasks
+}
+
+func (s *deletionSpool) write(data []byte) error {
+	if s.file == nil {
+		file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return fmt.Errorf("open deletion spool: %w", err)
+		}
+		s.file = file
+	}
+	if _, err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write deletion spool: %w", err)
+	}
+	return nil
+}
+
+func (s *deletionSpool) truncate() error {
+	if s.file == nil {
+		err := os.Truncate(s.path, 0)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("truncate deletion spool: %w", err)
+	}
+	return nil
+}
+
+func (s *deletionSpool) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := errors.Join(s.file.Sync(), s.file.Close())
+	s.file = nil
+	return err
+}
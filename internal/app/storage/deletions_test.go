@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStorage_DeletionQueue(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fileConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/short-url-db.json",
+		UserURLsFilePath:      dir + "/user-url-db.json",
+	}
+	dbConfig := config.AppConfig{DatabaseDSN: "sqlite://" + dir + "/shortener.db"}
+	tests := []struct {
+		name    string
+		open    func() DeletionQueue
+		durable bool
+	}{
+		{name: "memory", open: func() DeletionQueue { return NewMemoryStorage() }},
+		{name: "file", open: func() DeletionQueue { return NewFileStorage(fileConfig) }, durable: true},
+		{name: "sqlite", open: func() DeletionQueue { return NewDBStorage(dbConfig) }, durable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := tt.open()
+			userUID, jobID := uuid.New(), uuid.New()
+			createdAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+			tasks := []model.DeletionTask{
+				{ID: uuid.New(), JobID: jobID, UserUID: userUID, ShortURLKeys: []string{"del00001", "del00002"}, CreatedAt: createdAt},
+				{ID: uuid.New(), JobID: jobID, UserUID: userUID, ShortURLKeys: []string{"del00003"}, CreatedAt: createdAt.Add(time.Second)},
+				{ID: uuid.New(), UserUID: uuid.New(), ShortURLKeys: []string{"del00004"}, CreatedAt: createdAt.Add(2 * time.Second)},
+			}
+			require.NoError(t, queue.EnqueueDeletions(ctx, tasks))
+			require.NoError(t, queue.CompleteDeletions(ctx, []uuid.UUID{tasks[1].ID, uuid.New()}))
+
+			if tt.durable {
+				if closer, ok := queue.(interface{ Close() error }); ok {
+					require.NoError(t, closer.Close())
+				}
+				queue = tt.open()
+			}
+			pending, err := queue.PendingDeletions(ctx)
+			require.NoError(t, err)
+			require.Len(t, pending, 2)
+			for i, want := range []model.DeletionTask{tasks[0], tasks[2]} {
+				assert.Equal(t, want.ID, pending[i].ID)
+				assert.Equal(t, want.JobID, pending[i].JobID)
+				assert.Equal(t, want.UserUID, pending[i].UserUID)
+				assert.Equal(t, want.ShortURLKeys, pending[i].ShortURLKeys)
+				assert.True(t, want.CreatedAt.Equal(pending[i].CreatedAt))
+			}
+
+			require.NoError(t, queue.CompleteDeletions(ctx, []uuid.UUID{tasks[0].ID, tasks[2].ID}))
+			pending, err = queue.PendingDeletions(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, pending)
+		})
+	}
+}
+
+func TestDeletionSpool_TruncatedWhenDrained(t *testing.T) {
+	path := t.TempDir() + "/spool"
+	spool, err := newDeletionSpool(path)
+	require.NoError(t, err)
+	task := model.DeletionTask{ID: uuid.New(), UserUID: uuid.New(), ShortURLKeys: []string{"del00001"}}
+	require.NoError(t, spool.enqueue([]model.DeletionTask{task}))
+	synced, err := os.Stat(path)
+	require.NoError(t, err)
+	// a torn line written by a crash is cut off on load
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"task":{"id":`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	reloaded, err := newDeletionSpool(path)
+	require.NoError(t, err)
+	assert.Len(t, reloaded.pending(), 1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, synced.Size(), info.Size())
+
+	require.NoError(t, spool.complete([]uuid.UUID{task.ID}))
+	require.NoError(t, spool.close())
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+func TestDeletionSpool_CorruptedRecord(t *testing.T) {
+	path := t.TempDir() + "/spool"
+	spool, err := newDeletionSpool(path)
+	require.NoError(t, err)
+	first := model.DeletionTask{ID: uuid.New(), UserUID: uuid.New(), ShortURLKeys: []string{"del00001"}}
+	require.NoError(t, spool.enqueue([]model.DeletionTask{first}))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString("garbage\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	second := model.DeletionTask{ID: uuid.New(), UserUID: uuid.New(), ShortURLKeys: []string{"del00002"}}
+	require.NoError(t, spool.enqueue([]model.DeletionTask{second}))
+	require.NoError(t, spool.close())
+	before, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// acknowledged deletions after a damaged record must not be dropped silently
+	_, err = newDeletionSpool(path)
+	assert.ErrorIs(t, err, errCorruption)
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+}
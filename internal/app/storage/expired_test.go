@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"testing"
+	"time"
+)
+
+func TestStorage_DeleteExpired(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fileConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/short-url-db.json",
+		UserURLsFilePath:      dir + "/user-url-db.json",
+		FileSyncPolicy:        SyncAlways,
+	}
+	tests := []struct {
+		name   string
+		open   func() Storage
+		reopen func() Storage
+	}{
+		{name: "memory", open: func() Storage { return NewMemoryStorage() }},
+		{
+			name:   "file",
+			open:   func() Storage { return NewFileStorage(fileConfig) },
+			reopen: func() Storage { return NewFileStorage(fileConfig) },
+		},
+		{
+			name: "sqlite",
+			open: func() Storage {
+				return NewDBStorage(config.AppConfig{DatabaseDSN: "sqlite://" + dir + "/shortener.db"})
+			},
+		},
+	}
+	now := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open()
+			userUID := uuid.New()
+			urls := []model.ShortenedURL{
+				{UUID: uuid.New(), ShortURL: "expired1", OriginalURL: "http://expired.ru",
+					ExpiresAt: sql.NullTime{Time: now.Add(-2 * time.Hour), Valid: true}},
+				{UUID: uuid.New(), ShortURL: "grace001", OriginalURL: "http://grace.ru",
+					ExpiresAt: sql.NullTime{Time: now.Add(-time.Minute), Valid: true}},
+				{UUID: uuid.New(), ShortURL: "forever1", OriginalURL: "http://forever.ru"},
+			}
+			for _, url := range urls {
+				url := url
+				require.NoError(t, s.WriteShortenedURL(ctx, &url))
+				require.NoError(t, s.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: url.UUID}))
+			}
+
+			clickedAt := now.Add(-3 * time.Hour).Truncate(time.Second)
+			require.NoError(t, s.WriteClicks(ctx, []model.Click{
+				{ShortURL: "expired1", ClickedAt: clickedAt},
+				{ShortURL: "grace001", ClickedAt: clickedAt},
+			}))
+
+			for _, want := range []int{1, 0} {
+				deleted, err := s.DeleteExpired(ctx, now.Add(-time.Hour), 1)
+				require.NoError(t, err)
+				assert.Equal(t, want, deleted)
+			}
+
+			if tt.reopen != nil {
+				require.NoError(t, s.(*FileStorage).Close())
+				s = tt.reopen()
+			}
+			got, err := s.ReadShortenedURL(ctx, "grace001")
+			require.NoError(t, err)
+			assert.True(t, got.Expired(now))
+			assert.True(t, got.ExpiresAt.Time.Equal(urls[1].ExpiresAt.Time))
+
+			got, err = s.ReadShortenedURL(ctx, "expired1")
+			if err == nil {
+				assert.Empty(t, got.OriginalURL)
+			} else {
+				assert.ErrorIs(t, err, ErrNotFound)
+			}
+			userURLs, err := s.ReadUserURLs(ctx, &userUID)
+			require.NoError(t, err)
+			assert.Len(t, userURLs, 2)
+			for shortURL, want := range map[string]int64{"expired1": 0, "grace001": 1} {
+				stats, err := s.ReadClickStats(ctx, shortURL, clickedAt, now, 5)
+				require.NoError(t, err)
+				assert.Equal(t, want, stats.Total, "clicks of %s", shortURL)
+			}
+		})
+	}
+}
+
+func TestFileStorage_DeleteExpired_SurvivesRestartMidRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	appConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/short-url-db.json",
+		UserURLsFilePath:      dir + "/user-url-db.json",
+	}
+	fss := NewFileStorage(appConfig)
+	userUID := uuid.New()
+	now := time.Now()
+	for i, shortURL := range []string{"expired1", "expired2"} {
+		url := model.ShortenedURL{UUID: uuid.New(), ShortURL: shortURL, OriginalURL: "http://" + shortURL + ".ru",
+			ExpiresAt: sql.NullTime{Time: now.Add(time.Duration(i-10) * time.Minute), Valid: true}}
+		require.NoError(t, fss.WriteShortenedURL(ctx, &url))
+		require.NoError(t, fss.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: url.UUID}))
+	}
+	deleted, err := fss.DeleteExpired(ctx, now, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	// the process dies before the run compacts
+	fss = NewFileStorage(appConfig)
+	defer fss.Close()
+	got, err := fss.ReadShortenedURL(ctx, "expired1")
+	require.NoError(t, err)
+	assert.Empty(t, got.OriginalURL, "expired links removed by the janitor stay removed")
+	userURLs, err := fss.ReadUserURLs(ctx, &userUID)
+	require.NoError(t, err)
+	require.Len(t, userURLs, 1)
+	assert.Equal(t, "expired2", userURLs[0].ShortURL)
+}
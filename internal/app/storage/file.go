@@ -1,41 +1,155 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"go.uber.org/zap"
+	"hash/crc32"
+	"io"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 )
 
+const (
+	SyncAlways   = "always"
+	SyncInterval = "interval"
+	SyncNever    = "never"
+)
+
+var (
+	crcTable        = crc32.MakeTable(crc32.Castagnoli)
+	errTornRecord   = errors.New("torn log record")
+	errCorruption   = errors.New("corrupted log record")
+	defaultSyncTick = time.Second
+)
+
+// Producer appends records to a log, one per line as "<crc32c hex> <json>\n".
 type Producer struct {
-	file    *os.File
-	encoder *json.Encoder
+	file   *os.File
+	policy string
+	dirty  bool
+	mutex  sync.Mutex
+	done   chan struct{}
+	wg     sync.WaitGroup
 }
 
-func newProducer(filename string) (*Producer, error) {
+func newProducer(filename string, policy string, interval time.Duration) (*Producer, error) {
+	switch policy {
+	case "":
+		policy = SyncAlways
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("unknown fsync policy %q", policy)
+	}
 	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Producer{
-		file:    file,
-		encoder: json.NewEncoder(file),
-	}, nil
+	p := &Producer{
+		file:   file,
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+	if policy == SyncInterval {
+		if interval <= 0 {
+			interval = defaultSyncTick
+		}
+		p.wg.Add(1)
+		go p.syncLoop(interval)
+	}
+	return p, nil
 }
 
 func (p *Producer) writeObject(obj interface{}) error {
-	if err := p.encoder.Encode(obj); err != nil {
+	return p.writeObjects(obj)
+}
+
+// writeObjects appends all records with a single write, so a batch is synced together.
+func (p *Producer) writeObjects(objs ...interface{}) error {
+	var buf bytes.Buffer
+	for _, obj := range objs {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(fmt.Sprintf("%08x ", crc32.Checksum(data, crcTable)))
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, err := p.file.Write(buf.Bytes()); err != nil {
 		return err
 	}
+	if p.policy == SyncAlways {
+		return p.file.Sync()
+	}
+	p.dirty = true
 	return nil
 }
 
+// truncate drops every record of the log, used once the records are covered by a snapshot.
+func (p *Producer) truncate() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := p.file.Truncate(0); err != nil {
+		return err
+	}
+	p.dirty = false
+	return p.file.Sync()
+}
+
+func (p *Producer) syncLoop(interval time.Duration) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.sync(); err != nil {
+				logger.Log.Error("failed to sync log", zap.String("file", p.file.Name()), zap.Error(err))
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *Producer) sync() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.dirty {
+		return nil
+	}
+	p.dirty = false
+	return p.file.Sync()
+}
+
 func (p *Producer) close() error {
+	close(p.done)
+	p.wg.Wait()
+	if p.policy != SyncNever {
+		if err := p.sync(); err != nil {
+			p.file.Close()
+			return err
+		}
+	}
 	return p.file.Close()
 }
 
 type Consumer struct {
-	file    *os.File
-	decoder *json.Decoder
+	file   *os.File
+	reader *bufio.Reader
+	offset int64 // end of the last valid record
 }
 
 func newConsumer(filename string) (*Consumer, error) {
@@ -45,18 +159,113 @@ func newConsumer(filename string) (*Consumer, error) {
 	}
 
 	return &Consumer{
-		file:    file,
-		decoder: json.NewDecoder(file),
+		file:   file,
+		reader: bufio.NewReader(file),
 	}, nil
 }
 
 func (c *Consumer) readObject(obj interface{}) error {
-	if err := c.decoder.Decode(obj); err != nil {
+	line, err := c.reader.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return io.EOF
+	}
+	if err == io.EOF {
+		// the last write didn't make it to disk completely
+		return errTornRecord
+	}
+	if err != nil {
 		return err
 	}
+
+	data, err := decodeRecord(bytes.TrimRight(line, "\r\n"))
+	if err == nil {
+		err = json.Unmarshal(data, obj)
+	}
+	if err != nil {
+		return c.badRecord(err)
+	}
+	c.offset += int64(len(line))
 	return nil
 }
 
+// badRecord tells a torn last line, which an interrupted write leaves behind, from a damaged record
+// followed by valid ones, which must not be dropped silently.
+func (c *Consumer) badRecord(err error) error {
+	if _, peekErr := c.reader.Peek(1); peekErr == io.EOF {
+		return fmt.Errorf("%w: %s", errTornRecord, err)
+	}
+	return fmt.Errorf("%w in %s at offset %d: %s", errCorruption, c.file.Name(), c.offset, err)
+}
+
+// truncateTail cuts the log right after the last valid record.
+func (c *Consumer) truncateTail() error {
+	info, err := c.file.Stat()
+	if err != nil {
+		return err
+	}
+	logger.Log.Warn("truncating torn log tail",
+		zap.String("file", c.file.Name()),
+		zap.Int64("offset", c.offset),
+		zap.Int64("dropped bytes", info.Size()-c.offset),
+	)
+	return os.Truncate(c.file.Name(), c.offset)
+}
+
 func (c *Consumer) close() error {
 	return c.file.Close()
 }
+
+// scanLines calls fn with every line of a journal without checksums. A last line that is incomplete or that
+// fn rejects was left by an interrupted append: the scan stops before it and returns its offset, which is -1
+// when the file ends cleanly. A rejected line followed by others is errCorruption.
+func scanLines(ctx context.Context, file *os.File, fn func(line []byte) error) (int64, error) {
+	reader := bufio.NewReader(file)
+	var offset int64
+	for n := 1; ; n++ {
+		if n%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return -1, nil
+		}
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := fn(bytes.TrimRight(line, "\r\n")); err != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				return offset, nil
+			}
+			return 0, fmt.Errorf("%w in %s at offset %d: %s", errCorruption, file.Name(), offset, err)
+		}
+		offset += int64(len(line))
+	}
+}
+
+// cutTornTail drops the torn last line found by scanLines.
+func cutTornTail(path string, offset int64) error {
+	logger.Log.Warn("truncating torn log tail", zap.String("file", path), zap.Int64("offset", offset))
+	return os.Truncate(path, offset)
+}
+
+// decodeRecord verifies the checksum of a log line and returns its payload.
+// Lines starting with '{' were written before checksums were introduced and are accepted as is.
+func decodeRecord(line []byte) ([]byte, error) {
+	if len(line) > 0 && line[0] == '{' {
+		return line, nil
+	}
+	checksum, data, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return nil, errors.New("missing checksum")
+	}
+	want, err := strconv.ParseUint(string(checksum), 16, 32)
+	if err != nil || uint32(want) != crc32.Checksum(data, crcTable) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
@@ -2,96 +2,319 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/ujwegh/shortener/internal/app/config"
+	appErrors "github.com/ujwegh/shortener/internal/app/errors"
 	"github.com/ujwegh/shortener/internal/app/model"
 	"io"
 	"sync"
+	"time"
 )
 
 type FileStorage struct {
 	shortenedURLsFilePath string
 	userURLsFilePath      string
+	snapshotFilePath      string
 	shortURLMap           map[string]model.ShortenedURL    // shortURL -> ShortenedURL
 	uuidURLMap            map[uuid.UUID]model.ShortenedURL // uuid -> ShortenedURL
+	userURLMap            map[uuid.UUID][]uuid.UUID        // user uuid -> shortened URL uuids
+	ownerSet              map[model.UserURL]struct{}
+	shortenedURLsProducer *Producer
+	userURLsProducer      *Producer
+	removalsFilePath      string
+	removalsProducer      *Producer
+	compactionTrigger     chan struct{}
+	sequence              *blockCounter
+	clicks                *clickLog
+	deletions             *deletionSpool
+	removalPending        bool // links were removed since the last compaction of a purge or expiry run
 	mutex                 sync.Mutex
 }
 
-func (fs *FileStorage) DeleteBulk(background context.Context, buffer map[uuid.UUID][]string) error {
-	//TODO implement me
-	panic("implement me")
+func (fs *FileStorage) DeleteBulk(ctx context.Context, buffer map[uuid.UUID][]string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	var tombstones []model.ShortenedURL
+	now := time.Now()
+	for userUID, shortURLs := range buffer {
+		for _, shortURL := range shortURLs {
+			shortenedURL, ok := fs.shortURLMap[shortURL]
+			if !ok || shortenedURL.DeletedFlag {
+				continue
+			}
+			if _, ok := fs.ownerSet[model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}]; !ok {
+				continue
+			}
+			shortenedURL.DeletedFlag = true
+			shortenedURL.DeletedAt = sql.NullTime{Time: now, Valid: true}
+			tombstones = append(tombstones, shortenedURL)
+		}
+	}
+	if len(tombstones) == 0 {
+		return nil
+	}
+
+	if fs.shortenedURLsProducer != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			records := make([]interface{}, 0, len(tombstones))
+			for _, tombstone := range tombstones {
+				records = append(records, tombstone)
+			}
+			err := fs.shortenedURLsProducer.writeObjects(records...)
+			if err != nil {
+				return fmt.Errorf("can't write tombstone: %w", err)
+			}
+		}
+	}
+	for _, tombstone := range tombstones {
+		fs.putShortenedURL(tombstone)
+	}
+	return nil
+}
+
+// RestoreBulk logs the restored records, so they override the tombstones on restart.
+func (fs *FileStorage) RestoreBulk(ctx context.Context, userUID uuid.UUID, shortURLs []string) ([]string, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var restored []model.ShortenedURL
+	for _, shortURL := range shortURLs {
+		shortenedURL, ok := fs.shortURLMap[shortURL]
+		if !ok || !shortenedURL.DeletedFlag {
+			continue
+		}
+		if _, ok := fs.ownerSet[model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}]; !ok {
+			continue
+		}
+		shortenedURL.DeletedFlag = false
+		shortenedURL.DeletedAt = sql.NullTime{}
+		restored = append(restored, shortenedURL)
+	}
+	if len(restored) == 0 {
+		return nil, nil
+	}
+
+	if fs.shortenedURLsProducer != nil {
+		records := make([]interface{}, 0, len(restored))
+		for _, shortenedURL := range restored {
+			records = append(records, shortenedURL)
+		}
+		if err := fs.shortenedURLsProducer.writeObjects(records...); err != nil {
+			return nil, fmt.Errorf("can't write restored shortened URL: %w", err)
+		}
+	}
+	keys := make([]string, 0, len(restored))
+	for _, shortenedURL := range restored {
+		fs.putShortenedURL(shortenedURL)
+		keys = append(keys, shortenedURL.ShortURL)
+	}
+	return keys, nil
+}
+
+// ConsumeClick logs the decremented record, so the spent clicks survive a restart.
+func (fs *FileStorage) ConsumeClick(ctx context.Context, shortURL string) (bool, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	shortenedURL, ok := fs.shortURLMap[shortURL]
+	if !ok || !shortenedURL.ClicksLeft.Valid || shortenedURL.ClicksLeft.Int64 <= 0 {
+		return false, nil
+	}
+	shortenedURL.ClicksLeft.Int64--
+	if fs.shortenedURLsProducer != nil {
+		if err := fs.shortenedURLsProducer.writeObject(shortenedURL); err != nil {
+			return false, fmt.Errorf("can't write shortened URL: %w", err)
+		}
+	}
+	fs.putShortenedURL(shortenedURL)
+	return true, nil
 }
 
 func NewFileStorage(cfg config.AppConfig) *FileStorage {
-	urlMap := make(map[string]model.ShortenedURL)
-	uuidMap := make(map[uuid.UUID]model.ShortenedURL)
 	storage := FileStorage{
 		shortenedURLsFilePath: cfg.ShortenedURLsFilePath,
 		userURLsFilePath:      cfg.UserURLsFilePath,
+		shortURLMap:           make(map[string]model.ShortenedURL),
+		uuidURLMap:            make(map[uuid.UUID]model.ShortenedURL),
+		userURLMap:            make(map[uuid.UUID][]uuid.UUID),
+		ownerSet:              make(map[model.UserURL]struct{}),
+		compactionTrigger:     make(chan struct{}, 1),
+		sequence:              &blockCounter{},
+		clicks:                &clickLog{},
+		deletions:             &deletionSpool{},
 	}
 	if cfg.ShortenedURLsFilePath != "" {
+		storage.snapshotFilePath = cfg.ShortenedURLsFilePath + ".snapshot"
+		storage.sequence.path = cfg.ShortenedURLsFilePath + ".sequence"
+		storage.clicks.path = cfg.ShortenedURLsFilePath + ".clicks"
+		if err := storage.clicks.repairTail(); err != nil {
+			panic(err)
+		}
+		storage.removalsFilePath = cfg.ShortenedURLsFilePath + ".removals"
+		deletions, err := newDeletionSpool(cfg.ShortenedURLsFilePath + ".deletions")
+		if err != nil {
+			panic(err)
+		}
+		storage.deletions = deletions
+		snapshot, err := readSnapshot(storage.snapshotFilePath)
+		if err != nil {
+			panic(err)
+		}
+		for _, l := range snapshot.ShortenedURLs {
+			storage.putShortenedURL(l)
+		}
+		for _, l := range snapshot.UserURLs {
+			storage.putUserURL(l)
+		}
+
 		ls, err := storage.readAllShortenedURLs()
 		if err != nil {
 			panic(err)
 		}
+		// later records (e.g. deletion tombstones) override earlier ones
 		for _, l := range ls {
-			urlMap[l.ShortURL] = l
-			uuidMap[l.UUID] = l
+			storage.putShortenedURL(l)
+		}
+	}
+	userURLs, err := storage.readAllUserURLs()
+	if err != nil {
+		panic(err)
+	}
+	for _, l := range userURLs {
+		storage.putUserURL(l)
+	}
+	removals, err := storage.readAllRemovals()
+	if err != nil {
+		panic(err)
+	}
+	storage.applyRemovals(removals)
+	// a run interrupted before its compaction still has the clicks of the removed links to drop
+	storage.removalPending = len(removals) > 0
+	// tombstones written before deleted_at existed start their retention now
+	var backfilled []interface{}
+	now := time.Now()
+	for _, l := range storage.shortURLMap {
+		if l.DeletedFlag && !l.DeletedAt.Valid {
+			l.DeletedAt = sql.NullTime{Time: now, Valid: true}
+			storage.putShortenedURL(l)
+			backfilled = append(backfilled, l)
+		}
+	}
+
+	syncInterval := time.Duration(cfg.FileSyncIntervalMs) * time.Millisecond
+	if cfg.ShortenedURLsFilePath != "" {
+		storage.shortenedURLsProducer, err = newProducer(cfg.ShortenedURLsFilePath, cfg.FileSyncPolicy, syncInterval)
+		if err != nil {
+			panic(err)
+		}
+		// logged once, so the retention is not restarted by every restart
+		if len(backfilled) > 0 {
+			if err := storage.shortenedURLsProducer.writeObjects(backfilled...); err != nil {
+				panic(err)
+			}
+		}
+	}
+	if cfg.UserURLsFilePath != "" {
+		storage.userURLsProducer, err = newProducer(cfg.UserURLsFilePath, cfg.FileSyncPolicy, syncInterval)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if storage.removalsFilePath != "" {
+		// removals are rare and must not come back, they are synced whatever the policy
+		storage.removalsProducer, err = newProducer(storage.removalsFilePath, SyncAlways, 0)
+		if err != nil {
+			panic(err)
 		}
 	}
-	storage.shortURLMap = urlMap
-	storage.uuidURLMap = uuidMap
 	return &storage
 }
 
+// Close flushes and closes the logs, the storage must not be used afterwards.
+func (fs *FileStorage) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	var errs []error
+	for _, producer := range []*Producer{fs.shortenedURLsProducer, fs.userURLsProducer, fs.removalsProducer} {
+		if producer != nil {
+			errs = append(errs, producer.close())
+		}
+	}
+	fs.shortenedURLsProducer, fs.userURLsProducer, fs.removalsProducer = nil, nil, nil
+	errs = append(errs, fs.clicks.close(), fs.deletions.close())
+	return errors.Join(errs...)
+}
+
 func (fs *FileStorage) ReadUserURLs(ctx context.Context, uid *uuid.UUID) ([]model.ShortenedURL, error) {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
+
+	var shortenedURLs []model.ShortenedURL
+	for _, shortenedURLUUID := range fs.userURLMap[*uid] {
+		shortenedURLs = append(shortenedURLs, fs.uuidURLMap[shortenedURLUUID])
+	}
+	return shortenedURLs, nil
+}
+
+func (fs *FileStorage) readAllUserURLs() ([]model.UserURL, error) {
+	if fs.userURLsFilePath == "" {
+		return nil, nil
+	}
 	consumer, err := newConsumer(fs.userURLsFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("can't create Consumer: %w", err)
 	}
 	defer consumer.close()
 
-	var shortenedURLs []model.ShortenedURL
+	var userURLs []model.UserURL
 	for {
 		userURL := &model.UserURL{}
 		err := consumer.readObject(userURL)
 		if err == io.EOF {
 			break
 		}
+		if errors.Is(err, errTornRecord) {
+			if err := consumer.truncateTail(); err != nil {
+				return nil, fmt.Errorf("can't truncate torn log: %w", err)
+			}
+			break
+		}
 		if err != nil {
 			return nil, err
 		}
-		if userURL.UUID == *uid {
-			shortenedURLs = append(shortenedURLs, fs.uuidURLMap[userURL.ShortenedURLUUID])
-		}
+		userURLs = append(userURLs, *userURL)
 	}
-	return shortenedURLs, nil
+	return userURLs, nil
 }
 
 func (fs *FileStorage) CreateUserURL(ctx context.Context, userURL *model.UserURL) error {
 
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
-	if fs.userURLsFilePath != "" {
-		producer, err := newProducer(fs.userURLsFilePath)
-		if err != nil {
-			return fmt.Errorf("can't create Producer: %w", err)
-		}
-		defer producer.close()
-
+	if fs.userURLsProducer != nil {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			err = producer.writeObject(userURL)
+			err := fs.userURLsProducer.writeObject(userURL)
 			if err != nil {
 				return fmt.Errorf("can't write user URL: %w", err)
 			}
 		}
 	}
+	fs.putUserURL(*userURL)
 	return nil
 }
 
@@ -115,6 +338,12 @@ func (fs *FileStorage) readAllShortenedURLs() ([]model.ShortenedURL, error) {
 		if err == io.EOF {
 			break
 		}
+		if errors.Is(err, errTornRecord) {
+			if err := consumer.truncateTail(); err != nil {
+				return nil, fmt.Errorf("can't truncate torn log: %w", err)
+			}
+			break
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -126,28 +355,27 @@ func (fs *FileStorage) readAllShortenedURLs() ([]model.ShortenedURL, error) {
 func (fs *FileStorage) WriteShortenedURL(ctx context.Context, shortenedURL *model.ShortenedURL) error {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
-	if fs.shortenedURLsFilePath != "" {
-		producer, err := newProducer(fs.shortenedURLsFilePath)
-		if err != nil {
-			return fmt.Errorf("can't create Producer: %w", err)
-		}
-		defer producer.close()
-
+	if _, ok := fs.shortURLMap[shortenedURL.ShortURL]; ok {
+		return appErrors.New(errors.New("short URL already exists"), "short url collision")
+	}
+	if fs.shortenedURLsProducer != nil {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			err = producer.writeObject(shortenedURL)
+			err := fs.shortenedURLsProducer.writeObject(shortenedURL)
 			if err != nil {
 				return fmt.Errorf("can't write shortened URL: %w", err)
 			}
 		}
 	}
-	fs.shortURLMap[shortenedURL.ShortURL] = *shortenedURL
+	fs.putShortenedURL(*shortenedURL)
 	return nil
 }
 
 func (fs *FileStorage) ReadShortenedURL(ctx context.Context, shortURL string) (*model.ShortenedURL, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
@@ -160,28 +388,68 @@ func (fs *FileStorage) ReadShortenedURL(ctx context.Context, shortURL string) (*
 func (fs *FileStorage) WriteBatchShortenedURLSlice(ctx context.Context, slice []model.ShortenedURL) error {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
-
-	if fs.shortenedURLsFilePath != "" {
-		producer, err := newProducer(fs.shortenedURLsFilePath)
-		if err != nil {
-			return fmt.Errorf("can't create Producer: %w", err)
+	shortURLs := make(map[string]struct{}, len(slice))
+	for _, shortenedURL := range slice {
+		_, inBatch := shortURLs[shortenedURL.ShortURL]
+		_, stored := fs.shortURLMap[shortenedURL.ShortURL]
+		if inBatch || stored {
+			return appErrors.New(errors.New("short URL already exists"), "short url collision")
 		}
-		defer producer.close()
+		shortURLs[shortenedURL.ShortURL] = struct{}{}
+	}
 
+	if fs.shortenedURLsProducer != nil {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
+			records := make([]interface{}, 0, len(slice))
 			for _, shortenedURL := range slice {
-				err = producer.writeObject(shortenedURL)
-				if err != nil {
-					return fmt.Errorf("can't write shortened URL: %w", err)
-				}
+				records = append(records, shortenedURL)
+			}
+			err := fs.shortenedURLsProducer.writeObjects(records...)
+			if err != nil {
+				return fmt.Errorf("can't write shortened URL: %w", err)
 			}
 		}
 	}
 	for _, shortenedURL := range slice {
-		fs.shortURLMap[shortenedURL.ShortURL] = shortenedURL
+		fs.putShortenedURL(shortenedURL)
 	}
 	return nil
 }
+
+func (fs *FileStorage) ExportShortenedURLs(ctx context.Context, after uuid.UUID, fn func(model.ShortenedURL) error) error {
+	fs.mutex.Lock()
+	shortenedURLs := make([]model.ShortenedURL, 0, len(fs.uuidURLMap))
+	for _, shortenedURL := range fs.uuidURLMap {
+		shortenedURLs = append(shortenedURLs, shortenedURL)
+	}
+	fs.mutex.Unlock()
+	return exportSorted(ctx, shortenedURLs, func(a, b model.ShortenedURL) bool {
+		return uuidLess(a.UUID, b.UUID)
+	}, model.ShortenedURL{UUID: after}, fn)
+}
+
+func (fs *FileStorage) ExportUserURLs(ctx context.Context, after model.UserURL, fn func(model.UserURL) error) error {
+	fs.mutex.Lock()
+	userURLs := make([]model.UserURL, 0, len(fs.ownerSet))
+	for userURL := range fs.ownerSet {
+		userURLs = append(userURLs, userURL)
+	}
+	fs.mutex.Unlock()
+	return exportSorted(ctx, userURLs, userURLLess, after, fn)
+}
+
+func (fs *FileStorage) putShortenedURL(shortenedURL model.ShortenedURL) {
+	fs.shortURLMap[shortenedURL.ShortURL] = shortenedURL
+	fs.uuidURLMap[shortenedURL.UUID] = shortenedURL
+}
+
+func (fs *FileStorage) putUserURL(userURL model.UserURL) {
+	if _, ok := fs.ownerSet[userURL]; ok {
+		return
+	}
+	fs.ownerSet[userURL] = struct{}{}
+	fs.userURLMap[userURL.UUID] = append(fs.userURLMap[userURL.UUID], userURL.ShortenedURLUUID)
+}
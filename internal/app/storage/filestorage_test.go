@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/ujwegh/shortener/internal/app/config"
 	"github.com/ujwegh/shortener/internal/app/model"
 	"os"
@@ -134,13 +136,13 @@ func TestFileStorage_WriteShortenedURL(t *testing.T) {
 			}
 
 			// check if the data was written to the file
-			file, err := os.OpenFile(testShortenedURLsFileName, os.O_RDONLY, 0666)
+			consumer, err := newConsumer(testShortenedURLsFileName)
 			if err != nil {
 				t.Error(err)
 			}
-			decoder := json.NewDecoder(file)
+			defer consumer.close()
 			var shortenedURL model.ShortenedURL
-			err = decoder.Decode(&shortenedURL)
+			err = consumer.readObject(&shortenedURL)
 			if err != nil {
 				t.Error(err)
 			}
@@ -222,3 +224,237 @@ func TestFileStorage_readAllShortenedURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestFileStorage_DeleteBulk(t *testing.T) {
+	dir := t.TempDir()
+	appConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/shortened-urls-test.json",
+		UserURLsFilePath:      dir + "/user-urls-test.json",
+	}
+	owner := uuid.New()
+	stranger := uuid.New()
+	owned := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}
+	foreign := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edJkl5jj", OriginalURL: "http://ya.com"}
+
+	fss := NewFileStorage(appConfig)
+	ctx := context.Background()
+	for _, url := range []model.ShortenedURL{owned, foreign} {
+		url := url
+		if err := fss.WriteShortenedURL(ctx, &url); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fss.CreateUserURL(ctx, &model.UserURL{UUID: owner, ShortenedURLUUID: owned.UUID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fss.CreateUserURL(ctx, &model.UserURL{UUID: stranger, ShortenedURLUUID: foreign.UUID}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		buffer      map[uuid.UUID][]string
+		wantDeleted map[string]bool
+	}{
+		{
+			name:        "not owned url is kept",
+			buffer:      map[uuid.UUID][]string{owner: {foreign.ShortURL, "unknown"}},
+			wantDeleted: map[string]bool{owned.ShortURL: false, foreign.ShortURL: false},
+		},
+		{
+			name:        "owned url is deleted",
+			buffer:      map[uuid.UUID][]string{owner: {owned.ShortURL}},
+			wantDeleted: map[string]bool{owned.ShortURL: true, foreign.ShortURL: false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := fss.DeleteBulk(ctx, tt.buffer); err != nil {
+				t.Fatalf("DeleteBulk() error = %v", err)
+			}
+			// tombstones must survive a restart
+			for _, storage := range []*FileStorage{fss, NewFileStorage(appConfig)} {
+				for shortURL, want := range tt.wantDeleted {
+					got, err := storage.ReadShortenedURL(ctx, shortURL)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got.DeletedFlag != want {
+						t.Errorf("ReadShortenedURL(%s).DeletedFlag = %v, want %v", shortURL, got.DeletedFlag, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFileStorage_RestoreBulk(t *testing.T) {
+	dir := t.TempDir()
+	appConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/shortened-urls-test.json",
+		UserURLsFilePath:      dir + "/user-urls-test.json",
+	}
+	ctx := context.Background()
+	owner := uuid.New()
+	stranger := uuid.New()
+	owned := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}
+
+	fss := NewFileStorage(appConfig)
+	require.NoError(t, fss.WriteShortenedURL(ctx, &owned))
+	require.NoError(t, fss.CreateUserURL(ctx, &model.UserURL{UUID: owner, ShortenedURLUUID: owned.UUID}))
+	require.NoError(t, fss.DeleteBulk(ctx, map[uuid.UUID][]string{owner: {owned.ShortURL}}))
+
+	restored, err := fss.RestoreBulk(ctx, stranger, []string{owned.ShortURL})
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+
+	restored, err = fss.RestoreBulk(ctx, owner, []string{owned.ShortURL, "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{owned.ShortURL}, restored)
+
+	// the restored record overrides the tombstone after a restart
+	for _, storage := range []*FileStorage{fss, NewFileStorage(appConfig)} {
+		got, err := storage.ReadShortenedURL(ctx, owned.ShortURL)
+		require.NoError(t, err)
+		assert.False(t, got.DeletedFlag)
+	}
+}
+
+func TestFileStorage_Compact(t *testing.T) {
+	dir := t.TempDir()
+	appConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/shortened-urls-test.json",
+		UserURLsFilePath:      dir + "/user-urls-test.json",
+	}
+	ctx := context.Background()
+	userUID := uuid.New()
+	kept := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}
+	deleted := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edJkl5jj", OriginalURL: "http://ya.com"}
+	afterCompaction := model.ShortenedURL{UUID: uuid.New(), ShortURL: "BDurKLrm", OriginalURL: "http://yandex.ru"}
+
+	fss := NewFileStorage(appConfig)
+	require.NoError(t, fss.WriteBatchShortenedURLSlice(ctx, []model.ShortenedURL{kept, deleted}))
+	for _, url := range []model.ShortenedURL{kept, deleted} {
+		require.NoError(t, fss.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: url.UUID}))
+	}
+	require.NoError(t, fss.DeleteBulk(ctx, map[uuid.UUID][]string{userUID: {deleted.ShortURL}}))
+
+	require.NoError(t, fss.Compact(ctx))
+	for _, path := range []string{appConfig.ShortenedURLsFilePath, appConfig.UserURLsFilePath} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Zero(t, info.Size(), "log %s must be truncated", path)
+	}
+
+	require.NoError(t, fss.WriteShortenedURL(ctx, &afterCompaction))
+	require.NoError(t, fss.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: afterCompaction.UUID}))
+
+	// a restart restores the snapshot and replays the log written after it
+	restarted := NewFileStorage(appConfig)
+	got, err := restarted.ReadUserURLs(ctx, &userUID)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.True(t, got[1].DeletedAt.Valid)
+	deleted.DeletedFlag = true
+	deleted.DeletedAt = got[1].DeletedAt
+	assert.Equal(t, []model.ShortenedURL{kept, deleted, afterCompaction}, got)
+}
+
+func TestNewFileStorage_BackfillsDeletedAtOnce(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	appConfig := config.AppConfig{ShortenedURLsFilePath: dir + "/short-url-db.json"}
+	producer, err := newProducer(appConfig.ShortenedURLsFilePath, SyncAlways, 0)
+	require.NoError(t, err)
+	legacy := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru", DeletedFlag: true}
+	require.NoError(t, producer.writeObject(legacy))
+	require.NoError(t, producer.close())
+
+	fss := NewFileStorage(appConfig)
+	first, err := fss.ReadShortenedURL(ctx, legacy.ShortURL)
+	require.NoError(t, err)
+	require.True(t, first.DeletedAt.Valid)
+	require.NoError(t, fss.Close())
+
+	restarted := NewFileStorage(appConfig)
+	defer restarted.Close()
+	got, err := restarted.ReadShortenedURL(ctx, legacy.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, got.DeletedAt.Time.Equal(first.DeletedAt.Time), "a restart does not restart the retention")
+}
+
+func TestNewFileStorage_TornTail(t *testing.T) {
+	valid := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{name: "partial line", tail: `4a5b6c7d {"uuid":"`},
+		{name: "checksum mismatch", tail: `00000000 {"uuid":"cb280de3-c5ba-4fab-92d9-30bd72282afc","short_url":"E9M9zboP"}` + "\n"},
+		{name: "garbage", tail: "\x00\x00\x00\x00\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := config.AppConfig{
+				ShortenedURLsFilePath: t.TempDir() + "/shortened-urls-test.json",
+			}
+			producer, err := newProducer(appConfig.ShortenedURLsFilePath, SyncAlways, 0)
+			require.NoError(t, err)
+			require.NoError(t, producer.writeObject(valid))
+			require.NoError(t, producer.close())
+			info, err := os.Stat(appConfig.ShortenedURLsFilePath)
+			require.NoError(t, err)
+
+			file, err := os.OpenFile(appConfig.ShortenedURLsFilePath, os.O_WRONLY|os.O_APPEND, 0666)
+			require.NoError(t, err)
+			_, err = file.WriteString(tt.tail)
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+
+			fss := NewFileStorage(appConfig)
+			defer fss.Close()
+			got, err := fss.ReadShortenedURL(context.Background(), valid.ShortURL)
+			require.NoError(t, err)
+			assert.Equal(t, valid, *got)
+
+			truncated, err := os.Stat(appConfig.ShortenedURLsFilePath)
+			require.NoError(t, err)
+			assert.Equal(t, info.Size(), truncated.Size(), "torn tail must be truncated")
+		})
+	}
+}
+
+func TestNewFileStorage_CorruptedRecord(t *testing.T) {
+	appConfig := config.AppConfig{
+		ShortenedURLsFilePath: t.TempDir() + "/shortened-urls-test.json",
+	}
+	producer, err := newProducer(appConfig.ShortenedURLsFilePath, SyncAlways, 0)
+	require.NoError(t, err)
+	require.NoError(t, producer.writeObject(model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}))
+	require.NoError(t, producer.close())
+
+	file, err := os.OpenFile(appConfig.ShortenedURLsFilePath, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`00000000 {"uuid":"cb280de3-c5ba-4fab-92d9-30bd72282afc","short_url":"E9M9zboP"}` + "\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	producer, err = newProducer(appConfig.ShortenedURLsFilePath, SyncAlways, 0)
+	require.NoError(t, err)
+	require.NoError(t, producer.writeObject(model.ShortenedURL{UUID: uuid.New(), ShortURL: "AbCdEf12", OriginalURL: "http://ya.ru"}))
+	require.NoError(t, producer.close())
+	info, err := os.Stat(appConfig.ShortenedURLsFilePath)
+	require.NoError(t, err)
+
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		NewFileStorage(appConfig)
+	}()
+	err, ok := recovered.(error)
+	require.True(t, ok, "a damaged record followed by valid ones must stop the startup")
+	assert.ErrorIs(t, err, errCorruption)
+
+	after, err := os.Stat(appConfig.ShortenedURLsFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), after.Size(), "valid records must not be truncated")
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	appErrors "github.com/ujwegh/shortener/internal/app/errors"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type MemoryStorage struct {
+	shortURLMap    map[string]model.ShortenedURL // shortURL -> ShortenedURL
+	originalURLMap map[string]string             // originalURL -> shortURL
+	uuidURLMap     map[uuid.UUID]string          // uuid -> shortURL
+	userURLMap     map[uuid.UUID][]uuid.UUID     // user uuid -> shortened URL uuids
+	ownerSet       map[model.UserURL]struct{}
+	clicks         []model.Click
+	deletions      *deletionSpool
+	sequence       atomic.Uint64
+	mutex          sync.RWMutex
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		shortURLMap:    make(map[string]model.ShortenedURL),
+		originalURLMap: make(map[string]string),
+		uuidURLMap:     make(map[uuid.UUID]string),
+		userURLMap:     make(map[uuid.UUID][]uuid.UUID),
+		ownerSet:       make(map[model.UserURL]struct{}),
+		deletions:      &deletionSpool{},
+	}
+}
+
+func (ms *MemoryStorage) WriteShortenedURL(ctx context.Context, shortenedURL *model.ShortenedURL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if err := ms.checkUnique(shortenedURL); err != nil {
+		return err
+	}
+	ms.put(*shortenedURL)
+	return nil
+}
+
+func (ms *MemoryStorage) ReadShortenedURL(ctx context.Context, url string) (*model.ShortenedURL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	shortenedURL, ok := ms.shortURLMap[url]
+	if !ok {
+		shortenedURL = ms.shortURLMap[ms.originalURLMap[url]]
+	}
+	return &shortenedURL, nil
+}
+
+func (ms *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ms *MemoryStorage) WriteBatchShortenedURLSlice(ctx context.Context, slice []model.ShortenedURL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	shortURLs := make(map[string]struct{}, len(slice))
+	originalURLs := make(map[string]struct{}, len(slice))
+	for i := range slice {
+		if err := ms.checkUnique(&slice[i]); err != nil {
+			return err
+		}
+		if _, ok := shortURLs[slice[i].ShortURL]; ok {
+			return appErrors.New(errors.New("duplicate short URL in batch"), "short url collision")
+		}
+		if _, ok := originalURLs[slice[i].OriginalURL]; ok {
+			return appErrors.New(errors.New("duplicate URL in batch"), "unique violation")
+		}
+		shortURLs[slice[i].ShortURL] = struct{}{}
+		originalURLs[slice[i].OriginalURL] = struct{}{}
+	}
+	for _, shortenedURL := range slice {
+		ms.put(shortenedURL)
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) CreateUserURL(ctx context.Context, userURL *model.UserURL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if _, ok := ms.uuidURLMap[userURL.ShortenedURLUUID]; !ok {
+		return errors.New("shortened URL not found")
+	}
+	if _, ok := ms.ownerSet[*userURL]; ok {
+		return appErrors.New(errors.New("user URL already exists"), "unique violation")
+	}
+	ms.ownerSet[*userURL] = struct{}{}
+	ms.userURLMap[userURL.UUID] = append(ms.userURLMap[userURL.UUID], userURL.ShortenedURLUUID)
+	return nil
+}
+
+func (ms *MemoryStorage) ReadUserURLs(ctx context.Context, uid *uuid.UUID) ([]model.ShortenedURL, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	shortenedURLs := make([]model.ShortenedURL, 0, len(ms.userURLMap[*uid]))
+	for _, shortenedURLUUID := range ms.userURLMap[*uid] {
+		shortenedURLs = append(shortenedURLs, ms.shortURLMap[ms.uuidURLMap[shortenedURLUUID]])
+	}
+	return shortenedURLs, nil
+}
+
+func (ms *MemoryStorage) DeleteBulk(ctx context.Context, buffer map[uuid.UUID][]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	now := time.Now()
+	for userUID, shortURLs := range buffer {
+		for _, shortURL := range shortURLs {
+			shortenedURL, ok := ms.shortURLMap[shortURL]
+			if !ok {
+				continue
+			}
+			if _, ok := ms.ownerSet[model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}]; !ok {
+				continue
+			}
+			if !shortenedURL.DeletedFlag {
+				shortenedURL.DeletedAt = sql.NullTime{Time: now, Valid: true}
+			}
+			shortenedURL.DeletedFlag = true
+			ms.shortURLMap[shortURL] = shortenedURL
+		}
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) RestoreBulk(ctx context.Context, userUID uuid.UUID, shortURLs []string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	var restored []string
+	for _, shortURL := range shortURLs {
+		shortenedURL, ok := ms.shortURLMap[shortURL]
+		if !ok || !shortenedURL.DeletedFlag {
+			continue
+		}
+		if _, ok := ms.ownerSet[model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}]; !ok {
+			continue
+		}
+		shortenedURL.DeletedFlag = false
+		shortenedURL.DeletedAt = sql.NullTime{}
+		ms.shortURLMap[shortURL] = shortenedURL
+		restored = append(restored, shortURL)
+	}
+	return restored, nil
+}
+
+func (ms *MemoryStorage) ExportShortenedURLs(ctx context.Context, after uuid.UUID, fn func(model.ShortenedURL) error) error {
+	ms.mutex.RLock()
+	shortenedURLs := make([]model.ShortenedURL, 0, len(ms.shortURLMap))
+	for _, shortenedURL := range ms.shortURLMap {
+		shortenedURLs = append(shortenedURLs, shortenedURL)
+	}
+	ms.mutex.RUnlock()
+	return exportSorted(ctx, shortenedURLs, func(a, b model.ShortenedURL) bool {
+		return uuidLess(a.UUID, b.UUID)
+	}, model.ShortenedURL{UUID: after}, fn)
+}
+
+func (ms *MemoryStorage) ExportUserURLs(ctx context.Context, after model.UserURL, fn func(model.UserURL) error) error {
+	ms.mutex.RLock()
+	userURLs := make([]model.UserURL, 0, len(ms.ownerSet))
+	for userURL := range ms.ownerSet {
+		userURLs = append(userURLs, userURL)
+	}
+	ms.mutex.RUnlock()
+	return exportSorted(ctx, userURLs, userURLLess, after, fn)
+}
+
+func (ms *MemoryStorage) ConsumeClick(ctx context.Context, shortURL string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	shortenedURL, ok := ms.shortURLMap[shortURL]
+	if !ok || !shortenedURL.ClicksLeft.Valid || shortenedURL.ClicksLeft.Int64 <= 0 {
+		return false, nil
+	}
+	shortenedURL.ClicksLeft.Int64--
+	ms.shortURLMap[shortURL] = shortenedURL
+	return true, nil
+}
+
+func (ms *MemoryStorage) checkUnique(shortenedURL *model.ShortenedURL) error {
+	if _, ok := ms.shortURLMap[shortenedURL.ShortURL]; ok {
+		return appErrors.New(errors.New("short URL already exists"), "short url collision")
+	}
+	if _, ok := ms.originalURLMap[shortenedURL.OriginalURL]; ok {
+		return appErrors.New(errors.New("original URL already exists"), "unique violation")
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) put(shortenedURL model.ShortenedURL) {
+	ms.shortURLMap[shortenedURL.ShortURL] = shortenedURL
+	ms.originalURLMap[shortenedURL.OriginalURL] = shortenedURL.ShortURL
+	ms.uuidURLMap[shortenedURL.UUID] = shortenedURL.ShortURL
+}
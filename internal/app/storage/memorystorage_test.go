@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appErrors "github.com/ujwegh/shortener/internal/app/errors"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"testing"
+)
+
+func TestMemoryStorage_WriteShortenedURL(t *testing.T) {
+	ms := NewMemoryStorage()
+	existing := &model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}
+	require.NoError(t, ms.WriteShortenedURL(context.Background(), existing))
+
+	tests := []struct {
+		name         string
+		shortenedURL *model.ShortenedURL
+		wantErr      bool
+		wantMsg      string
+	}{
+		{
+			name:         "write - success",
+			shortenedURL: &model.ShortenedURL{UUID: uuid.New(), ShortURL: "edJkl5jj", OriginalURL: "http://ya.com"},
+			wantErr:      false,
+		},
+		{
+			name:         "write - original url unique violation",
+			shortenedURL: &model.ShortenedURL{UUID: uuid.New(), ShortURL: "BDurKLrm", OriginalURL: "http://ya.ru"},
+			wantErr:      true,
+			wantMsg:      "unique violation",
+		},
+		{
+			name:         "write - short url collision",
+			shortenedURL: &model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://google.com"},
+			wantErr:      true,
+			wantMsg:      "short url collision",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ms.WriteShortenedURL(context.Background(), tt.shortenedURL)
+			if !tt.wantErr {
+				require.NoError(t, err)
+				got, err := ms.ReadShortenedURL(context.Background(), tt.shortenedURL.ShortURL)
+				require.NoError(t, err)
+				assert.Equal(t, tt.shortenedURL, got)
+				return
+			}
+			target := &appErrors.ShortenerError{}
+			require.True(t, errors.As(err, target))
+			assert.Equal(t, tt.wantMsg, target.Msg())
+		})
+	}
+}
+
+func TestMemoryStorage_ReadShortenedURL(t *testing.T) {
+	ms := NewMemoryStorage()
+	stored := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}
+	require.NoError(t, ms.WriteShortenedURL(context.Background(), &stored))
+
+	tests := []struct {
+		name string
+		url  string
+		want model.ShortenedURL
+	}{
+		{name: "read by short url", url: "edVPg3ks", want: stored},
+		{name: "read by original url", url: "http://ya.ru", want: stored},
+		{name: "read non-existent url", url: "unknown", want: model.ShortenedURL{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ms.ReadShortenedURL(context.Background(), tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *got)
+		})
+	}
+}
+
+func TestMemoryStorage_DeleteBulk(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemoryStorage()
+	owner := uuid.New()
+	stranger := uuid.New()
+	owned := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru"}
+	foreign := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edJkl5jj", OriginalURL: "http://ya.com"}
+	require.NoError(t, ms.WriteBatchShortenedURLSlice(ctx, []model.ShortenedURL{owned, foreign}))
+	require.NoError(t, ms.CreateUserURL(ctx, &model.UserURL{UUID: owner, ShortenedURLUUID: owned.UUID}))
+	require.NoError(t, ms.CreateUserURL(ctx, &model.UserURL{UUID: stranger, ShortenedURLUUID: foreign.UUID}))
+
+	require.NoError(t, ms.DeleteBulk(ctx, map[uuid.UUID][]string{owner: {owned.ShortURL, foreign.ShortURL, "unknown"}}))
+
+	got, err := ms.ReadShortenedURL(ctx, owned.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, got.DeletedFlag)
+	got, err = ms.ReadShortenedURL(ctx, foreign.ShortURL)
+	require.NoError(t, err)
+	assert.False(t, got.DeletedFlag)
+
+	userURLs, err := ms.ReadUserURLs(ctx, &owner)
+	require.NoError(t, err)
+	require.Len(t, userURLs, 1)
+	assert.True(t, userURLs[0].DeletedFlag)
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const (
+	notifyChannel = "shortener_events"
+	// postgres rejects NOTIFY payloads of 8000 bytes and more
+	maxNotifyPayload = 7000
+	subscriberBuffer = 256
+
+	maxListenBackoff = 30 * time.Second
+)
+
+type EventKind string
+
+const (
+	EventWrite  EventKind = "write"
+	EventDelete EventKind = "delete"
+	// EventReset means some events may have been lost and all derived state must be dropped.
+	EventReset EventKind = "reset"
+)
+
+type Event struct {
+	Kind EventKind `json:"kind"`
+	Keys []string  `json:"keys,omitempty"` // affected short and original URLs
+}
+
+// Notifier delivers changes made to the storage by any instance sharing it.
+type Notifier interface {
+	Subscribe() (<-chan Event, func())
+}
+
+type txExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type subscriber struct {
+	events     chan Event
+	overflowed bool
+}
+
+type eventBus struct {
+	subscribers map[*subscriber]struct{}
+	mutex       sync.Mutex
+}
+
+func (b *eventBus) subscribe() (<-chan Event, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.subscribers == nil {
+		b.subscribers = make(map[*subscriber]struct{})
+	}
+	sub := &subscriber{events: make(chan Event, subscriberBuffer)}
+	b.subscribers[sub] = struct{}{}
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			delete(b.subscribers, sub)
+			close(sub.events)
+		})
+	}
+}
+
+// publish never blocks: a subscriber that falls behind gets a reset event instead of the missed ones.
+func (b *eventBus) publish(event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for sub := range b.subscribers {
+		if sub.overflowed {
+			select {
+			case sub.events <- Event{Kind: EventReset}:
+				sub.overflowed = false
+			default:
+				continue
+			}
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.overflowed = true
+		}
+	}
+}
+
+func (storage *DBStorage) Subscribe() (<-chan Event, func()) {
+	return storage.events.subscribe()
+}
+
+// Listen receives notifications of all instances and publishes them to subscribers until ctx is done.
+// The connection is re-established with exponential backoff, subscribers get EventReset after every
+// reconnect because notifications sent while disconnected are lost.
+func (storage *DBStorage) Listen(ctx context.Context) {
+	if storage.db.DriverName() != driverPgx {
+		return
+	}
+	backoff := time.Second
+	for {
+		connected, err := storage.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		logger.Log.Error("notification listener disconnected", zap.Error(err), zap.Duration("retry in", backoff))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+	}
+}
+
+func (storage *DBStorage) listen(ctx context.Context) (bool, error) {
+	conn, err := pgx.Connect(ctx, storage.dsn)
+	if err != nil {
+		return false, fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return false, fmt.Errorf("listen: %w", err)
+	}
+	storage.events.publish(Event{Kind: EventReset})
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, fmt.Errorf("wait for notification: %w", err)
+		}
+		event := Event{}
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			logger.Log.Warn("malformed notification", zap.String("payload", notification.Payload), zap.Error(err))
+			event = Event{Kind: EventReset}
+		}
+		storage.events.publish(event)
+	}
+}
+
+// notify sends the event to all listening instances once the transaction commits.
+func (storage *DBStorage) notify(ctx context.Context, tx txExecer, kind EventKind, keys []string) error {
+	if storage.db.DriverName() != driverPgx {
+		return nil
+	}
+	for _, payload := range notificationPayloads(kind, keys) {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_notify($1, $2);", notifyChannel, payload); err != nil {
+			return fmt.Errorf("notify: %w", err)
+		}
+	}
+	return nil
+}
+
+// notificationPayloads splits the keys into events that fit into a single NOTIFY payload.
+func notificationPayloads(kind EventKind, keys []string) []string {
+	var payloads []string
+	event := Event{Kind: kind}
+	overhead := len(`{"kind":"","keys":[]}`) + len(kind)
+	size := 0
+	flush := func() {
+		data, _ := json.Marshal(event)
+		payloads = append(payloads, string(data))
+		event.Keys, size = nil, 0
+	}
+	for _, key := range keys {
+		encoded, _ := json.Marshal(key)
+		keySize := len(encoded) + 1
+		if overhead+keySize > maxNotifyPayload {
+			// a key this long can't be sent, make listeners drop everything instead
+			resetPayload, _ := json.Marshal(Event{Kind: EventReset})
+			payloads = append(payloads, string(resetPayload))
+			continue
+		}
+		if overhead+size+keySize > maxNotifyPayload {
+			flush()
+		}
+		event.Keys = append(event.Keys, key)
+		size += keySize
+	}
+	if len(event.Keys) > 0 || len(payloads) == 0 {
+		flush()
+	}
+	return payloads
+}
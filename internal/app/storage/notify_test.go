@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBus_Overflow(t *testing.T) {
+	bus := eventBus{}
+	events, unsubscribe := bus.subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.publish(Event{Kind: EventWrite, Keys: []string{fmt.Sprint(i)}})
+	}
+	for i := 0; i < subscriberBuffer; i++ {
+		event := <-events
+		assert.Equal(t, EventWrite, event.Kind)
+	}
+	bus.publish(Event{Kind: EventDelete, Keys: []string{"next"}})
+	assert.Equal(t, Event{Kind: EventReset}, <-events, "lost events must be reported with a reset")
+	assert.Equal(t, Event{Kind: EventDelete, Keys: []string{"next"}}, <-events)
+
+	unsubscribe()
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestNotificationPayloads(t *testing.T) {
+	manyKeys := make([]string, 1000)
+	for i := range manyKeys {
+		manyKeys[i] = fmt.Sprintf("https://example.com/%d", i)
+	}
+	tests := []struct {
+		name      string
+		keys      []string
+		wantCount int
+		wantReset bool
+	}{
+		{name: "no keys", keys: nil, wantCount: 1},
+		{name: "single payload", keys: []string{"edVPg3ks", "http://ya.ru"}, wantCount: 1},
+		{name: "split", keys: manyKeys, wantCount: 4},
+		{name: "oversized key", keys: []string{"edVPg3ks", strings.Repeat("a", maxNotifyPayload)}, wantCount: 2, wantReset: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads := notificationPayloads(EventWrite, tt.keys)
+			require.Len(t, payloads, tt.wantCount)
+			var keys []string
+			reset := false
+			for _, payload := range payloads {
+				assert.LessOrEqual(t, len(payload), maxNotifyPayload)
+				event := Event{}
+				require.NoError(t, json.Unmarshal([]byte(payload), &event))
+				reset = reset || event.Kind == EventReset
+				keys = append(keys, event.Keys...)
+			}
+			assert.Equal(t, tt.wantReset, reset)
+			if !tt.wantReset {
+				assert.Equal(t, tt.keys, keys)
+			}
+		})
+	}
+}
+
+func TestCachedStorage_Follow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache, backend, _, _ := newTestCache(t, 10)
+	for _, key := range []string{"edVPg3ks", "edJkl5jj"} {
+		_, err := cache.ReadShortenedURL(ctx, key)
+		require.NoError(t, err)
+	}
+
+	events := make(chan Event)
+	done := make(chan struct{})
+	go func() {
+		cache.Follow(ctx, events)
+		close(done)
+	}()
+
+	events <- Event{Kind: EventDelete, Keys: []string{"edVPg3ks"}}
+	events <- Event{Kind: EventWrite}
+	_, err := cache.ReadShortenedURL(ctx, "edVPg3ks")
+	require.NoError(t, err)
+	_, err = cache.ReadShortenedURL(ctx, "edJkl5jj")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), backend.reads.Load(), "only the notified key must be invalidated")
+
+	events <- Event{Kind: EventReset}
+	events <- Event{Kind: EventWrite}
+	_, err = cache.ReadShortenedURL(ctx, "edJkl5jj")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), backend.reads.Load(), "reset must purge the whole cache")
+
+	close(events)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Follow must return when events are closed")
+	}
+}
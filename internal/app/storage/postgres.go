@@ -1,41 +0,0 @@
-package storage
-
-import (
-	"fmt"
-	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/jmoiron/sqlx"
-	"github.com/pressly/goose/v3"
-	"io/fs"
-)
-
-func Open(dataSourceName string) *sqlx.DB {
-	db, err := sqlx.Open("pgx", dataSourceName)
-	db.SetMaxOpenConns(10)
-	if err != nil {
-		panic(err)
-	}
-	return db
-}
-
-func Migrate(db *sqlx.DB, dir string) error {
-	err := goose.SetDialect("postgres")
-	if err != nil {
-		return fmt.Errorf("migrate: %w", err)
-	}
-	err = goose.Up(db.DB, dir)
-	if err != nil {
-		return fmt.Errorf("migrate: %w", err)
-	}
-	return nil
-}
-
-func MigrateFS(db *sqlx.DB, migrationsFS fs.FS, dir string) error {
-	if dir == "" {
-		dir = "."
-	}
-	goose.SetBaseFS(migrationsFS)
-	defer func() {
-		goose.SetBaseFS(nil)
-	}()
-	return Migrate(db, dir)
-}
@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PurgeDeleted hard deletes up to limit links soft deleted before the given time, oldest first,
+// together with their user links and clicks. archive gets the batch before the transaction commits,
+// its error rolls the purge back.
+func (storage *DBStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int,
+	archive func([]model.ShortenedURL) error) (int, error) {
+	tx, err := storage.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var purged []model.ShortenedURL
+	err = tx.SelectContext(ctx, &purged, `DELETE FROM shortened_urls WHERE uuid IN
+		(SELECT uuid FROM shortened_urls WHERE is_deleted AND deleted_at < $1 ORDER BY deleted_at, uuid LIMIT $2)
+		RETURNING `+shortenedURLColumns+`;`, utcTime(sql.NullTime{Time: before, Valid: true}), limit)
+	if err != nil {
+		return 0, fmt.Errorf("purge deleted shortened URLs: %w", err)
+	}
+	if len(purged) == 0 {
+		return 0, nil
+	}
+	if err := deleteDependents(ctx, tx, purged); err != nil {
+		return 0, fmt.Errorf("purge deleted URLs: %w", err)
+	}
+	if archive != nil {
+		if err := archive(purged); err != nil {
+			return 0, fmt.Errorf("archive purged URLs: %w", err)
+		}
+	}
+	keys := make([]string, 0, len(purged)*2)
+	for _, shortenedURL := range purged {
+		keys = append(keys, shortenedURL.ShortURL, shortenedURL.OriginalURL)
+	}
+	if err := storage.notify(ctx, tx, EventDelete, keys); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
+	return len(purged), nil
+}
+
+// deleteDependents removes the user links and clicks of hard deleted shortened URLs.
+func deleteDependents(ctx context.Context, tx *sqlx.Tx, removed []model.ShortenedURL) error {
+	// the foreign key cascades, unless sqlite runs without foreign key enforcement
+	placeholders := make([]string, len(removed))
+	uuids := make([]interface{}, len(removed))
+	shortURLs := make([]interface{}, len(removed))
+	for i, shortenedURL := range removed {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		uuids[i] = shortenedURL.UUID
+		shortURLs[i] = shortenedURL.ShortURL
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM user_urls WHERE shortened_url_uuid IN (`+strings.Join(placeholders, ", ")+`);`,
+		uuids...)
+	if err != nil {
+		return fmt.Errorf("delete user URLs: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM clicks WHERE short_url IN (`+strings.Join(placeholders, ", ")+`);`,
+		shortURLs...)
+	if err != nil {
+		return fmt.Errorf("delete clicks: %w", err)
+	}
+	return nil
+}
+
+func (ms *MemoryStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int,
+	archive func([]model.ShortenedURL) error) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	purged := oldestBefore(ms.shortURLMap, before, limit, deletedAt)
+	if len(purged) == 0 {
+		return 0, nil
+	}
+	if archive != nil {
+		if err := archive(purged); err != nil {
+			return 0, fmt.Errorf("archive purged URLs: %w", err)
+		}
+	}
+	ms.remove(purged)
+	return len(purged), nil
+}
+
+// DeleteExpired removes up to limit links that expired before the given time, earliest first.
+func (ms *MemoryStorage) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	expired := oldestBefore(ms.shortURLMap, before, limit, expiresAt)
+	ms.remove(expired)
+	return len(expired), nil
+}
+
+// remove drops the links with their user links and clicks, the caller holds the mutex.
+func (ms *MemoryStorage) remove(shortenedURLs []model.ShortenedURL) {
+	if len(shortenedURLs) == 0 {
+		return
+	}
+	removed := make(map[uuid.UUID]struct{}, len(shortenedURLs))
+	removedShortURLs := make(map[string]struct{}, len(shortenedURLs))
+	for _, shortenedURL := range shortenedURLs {
+		removed[shortenedURL.UUID] = struct{}{}
+		removedShortURLs[shortenedURL.ShortURL] = struct{}{}
+		delete(ms.shortURLMap, shortenedURL.ShortURL)
+		delete(ms.originalURLMap, shortenedURL.OriginalURL)
+		delete(ms.uuidURLMap, shortenedURL.UUID)
+	}
+	ms.clicks = withoutClicks(ms.clicks, removedShortURLs)
+	for userURL := range ms.ownerSet {
+		if _, ok := removed[userURL.ShortenedURLUUID]; ok {
+			delete(ms.ownerSet, userURL)
+		}
+	}
+	for userUID, shortenedURLUUIDs := range ms.userURLMap {
+		ms.userURLMap[userUID] = removeUUIDs(shortenedURLUUIDs, removed)
+	}
+}
+
+// PurgeDeleted logs the removal of every batch before applying it, so purged links stay purged across
+// a restart. The storage is compacted once a batch smaller than limit ends the purge run, dropping the
+// tombstones, the removal log and the clicks of every link purged by the run.
+func (fs *FileStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int,
+	archive func([]model.ShortenedURL) error) (int, error) {
+	return fs.removeOldest(ctx, before, limit, deletedAt, archive)
+}
+
+// DeleteExpired logs every batch before removing it and compacts once a batch smaller than limit ends
+// the run, like PurgeDeleted.
+func (fs *FileStorage) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	return fs.removeOldest(ctx, before, limit, expiresAt, nil)
+}
+
+func (fs *FileStorage) removeOldest(ctx context.Context, before time.Time, limit int,
+	at func(model.ShortenedURL) sql.NullTime, archive func([]model.ShortenedURL) error) (int, error) {
+	fs.mutex.Lock()
+	if err := ctx.Err(); err != nil {
+		fs.mutex.Unlock()
+		return 0, err
+	}
+	batch := oldestBefore(fs.shortURLMap, before, limit, at)
+	if archive != nil && len(batch) > 0 {
+		if err := archive(batch); err != nil {
+			fs.mutex.Unlock()
+			return 0, fmt.Errorf("archive purged URLs: %w", err)
+		}
+	}
+	removals := make([]removal, 0, len(batch))
+	for _, shortenedURL := range batch {
+		removals = append(removals, removal{UUID: shortenedURL.UUID, ShortURL: shortenedURL.ShortURL})
+	}
+	if fs.removalsProducer != nil && len(removals) > 0 {
+		records := make([]interface{}, 0, len(removals))
+		for _, r := range removals {
+			records = append(records, r)
+		}
+		if err := fs.removalsProducer.writeObjects(records...); err != nil {
+			fs.mutex.Unlock()
+			return 0, fmt.Errorf("can't write removal: %w", err)
+		}
+	}
+	fs.applyRemovals(removals)
+	fs.removalPending = fs.removalPending || len(batch) > 0
+	compact := fs.removalPending && len(batch) < limit
+	if compact {
+		fs.removalPending = false
+	}
+	fs.mutex.Unlock()
+
+	if !compact {
+		return len(batch), nil
+	}
+	if err := fs.compactRemovals(ctx); err != nil {
+		fs.mutex.Lock()
+		fs.removalPending = true
+		fs.mutex.Unlock()
+		return len(batch), fmt.Errorf("compact after removal: %w", err)
+	}
+	return len(batch), nil
+}
+
+// removal is logged for every link removed by a purge or expiry run until the next compaction.
+type removal struct {
+	UUID     uuid.UUID `json:"uuid"`
+	ShortURL string    `json:"short_url"`
+}
+
+func (fs *FileStorage) readAllRemovals() ([]removal, error) {
+	if fs.removalsFilePath == "" {
+		return nil, nil
+	}
+	consumer, err := newConsumer(fs.removalsFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("can't create Consumer: %w", err)
+	}
+	defer consumer.close()
+
+	var removals []removal
+	for {
+		r := removal{}
+		err := consumer.readObject(&r)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errTornRecord) {
+			if err := consumer.truncateTail(); err != nil {
+				return nil, fmt.Errorf("can't truncate torn log: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		removals = append(removals, r)
+	}
+	return removals, nil
+}
+
+// applyRemovals drops the removed links with their user links, the caller holds the mutex.
+// A short URL taken over by a newer link is left to it.
+func (fs *FileStorage) applyRemovals(removals []removal) {
+	removed := make(map[uuid.UUID]struct{}, len(removals))
+	for _, r := range removals {
+		removed[r.UUID] = struct{}{}
+		delete(fs.uuidURLMap, r.UUID)
+		if shortenedURL, ok := fs.shortURLMap[r.ShortURL]; ok && shortenedURL.UUID == r.UUID {
+			delete(fs.shortURLMap, r.ShortURL)
+		}
+	}
+	fs.removeUserURLs(removed)
+}
+
+// removeUserURLs drops the user links of the removed shortened URLs, the caller holds the mutex.
+func (fs *FileStorage) removeUserURLs(removed map[uuid.UUID]struct{}) {
+	if len(removed) == 0 {
+		return
+	}
+	for userURL := range fs.ownerSet {
+		if _, ok := removed[userURL.ShortenedURLUUID]; ok {
+			delete(fs.ownerSet, userURL)
+		}
+	}
+	for userUID, shortenedURLUUIDs := range fs.userURLMap {
+		fs.userURLMap[userUID] = removeUUIDs(shortenedURLUUIDs, removed)
+	}
+}
+
+// compactRemovals compacts the storage and drops the clicks of links that no longer exist. Clicks recorded
+// after it started are kept, they may belong to a link created in the meantime.
+func (fs *FileStorage) compactRemovals(ctx context.Context) error {
+	start := time.Now()
+	if err := fs.Compact(ctx); err != nil {
+		return err
+	}
+	fs.mutex.Lock()
+	existing := make(map[string]struct{}, len(fs.shortURLMap))
+	for shortURL := range fs.shortURLMap {
+		existing[shortURL] = struct{}{}
+	}
+	fs.mutex.Unlock()
+	_, err := fs.clicks.retain(ctx, func(click model.Click) bool {
+		_, ok := existing[click.ShortURL]
+		return ok || !click.ClickedAt.Before(start)
+	})
+	return err
+}
+
+func withoutClicks(clicks []model.Click, shortURLs map[string]struct{}) []model.Click {
+	kept := clicks[:0]
+	for _, click := range clicks {
+		if _, ok := shortURLs[click.ShortURL]; !ok {
+			kept = append(kept, click)
+		}
+	}
+	return kept
+}
+
+// oldestBefore returns up to limit links whose time given by at is before the given one, oldest first.
+func oldestBefore(shortenedURLs map[string]model.ShortenedURL, before time.Time, limit int,
+	at func(model.ShortenedURL) sql.NullTime) []model.ShortenedURL {
+	var found []model.ShortenedURL
+	for _, shortenedURL := range shortenedURLs {
+		if t := at(shortenedURL); t.Valid && t.Time.Before(before) {
+			found = append(found, shortenedURL)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		ti, tj := at(found[i]).Time, at(found[j]).Time
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return uuidLess(found[i].UUID, found[j].UUID)
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
+
+func deletedAt(shortenedURL model.ShortenedURL) sql.NullTime {
+	if !shortenedURL.DeletedFlag {
+		return sql.NullTime{}
+	}
+	return shortenedURL.DeletedAt
+}
+
+func expiresAt(shortenedURL model.ShortenedURL) sql.NullTime {
+	return shortenedURL.ExpiresAt
+}
+
+// Archive appends purged links to a JSON-lines file, a batch is synced before it is removed from the storage.
+// A purge that fails after archiving archives its links again on the next run.
+type Archive struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewArchive(path string) *Archive {
+	return &Archive{path: path}
+}
+
+func (a *Archive) Append(shortenedURLs []model.ShortenedURL) error {
+	var buf bytes.Buffer
+	for i := range shortenedURLs {
+		data, err := shortenedURLs[i].MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("marshal purged URL: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	// the records keep the password hashes, the archive is readable by the owner only
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("write archive: %w", err)
+	}
+	return errors.Join(file.Sync(), file.Close())
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStorage_PurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fileConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/short-url-db.json",
+		UserURLsFilePath:      dir + "/user-url-db.json",
+		FileSyncPolicy:        SyncAlways,
+	}
+	tests := []struct {
+		name   string
+		open   func() Storage
+		reopen func() Storage
+	}{
+		{name: "memory", open: func() Storage { return NewMemoryStorage() }},
+		{
+			name:   "file",
+			open:   func() Storage { return NewFileStorage(fileConfig) },
+			reopen: func() Storage { return NewFileStorage(fileConfig) },
+		},
+		{
+			name: "sqlite",
+			open: func() Storage {
+				return NewDBStorage(config.AppConfig{DatabaseDSN: "sqlite://" + dir + "/shortener.db"})
+			},
+		},
+	}
+	now := time.Now()
+	deletedAt := func(ago time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-ago), Valid: true}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open()
+			userUID := uuid.New()
+			urls := []model.ShortenedURL{
+				{UUID: uuid.New(), ShortURL: "oldest01", OriginalURL: "http://oldest.ru", DeletedFlag: true, DeletedAt: deletedAt(3 * time.Hour)},
+				{UUID: uuid.New(), ShortURL: "older001", OriginalURL: "http://older.ru", DeletedFlag: true, DeletedAt: deletedAt(2 * time.Hour)},
+				{UUID: uuid.New(), ShortURL: "recent01", OriginalURL: "http://recent.ru", DeletedFlag: true, DeletedAt: deletedAt(time.Minute)},
+				{UUID: uuid.New(), ShortURL: "alive001", OriginalURL: "http://alive.ru"},
+			}
+			for _, url := range urls {
+				url := url
+				require.NoError(t, s.WriteShortenedURL(ctx, &url))
+				require.NoError(t, s.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: url.UUID}))
+			}
+			clickedAt := now.Add(-4 * time.Hour).Truncate(time.Second)
+			require.NoError(t, s.WriteClicks(ctx, []model.Click{
+				{ShortURL: "oldest01", ClickedAt: clickedAt},
+				{ShortURL: "older001", ClickedAt: clickedAt},
+				{ShortURL: "alive001", ClickedAt: clickedAt},
+			}))
+
+			failing := func([]model.ShortenedURL) error { return errors.New("disk full") }
+			purged, err := s.PurgeDeleted(ctx, now.Add(-time.Hour), 1, failing)
+			require.Error(t, err)
+			assert.Zero(t, purged)
+
+			var archived []string
+			archive := func(batch []model.ShortenedURL) error {
+				for _, shortenedURL := range batch {
+					archived = append(archived, shortenedURL.ShortURL)
+				}
+				return nil
+			}
+			for _, want := range []int{1, 1, 0} {
+				purged, err := s.PurgeDeleted(ctx, now.Add(-time.Hour), 1, archive)
+				require.NoError(t, err)
+				assert.Equal(t, want, purged)
+			}
+			assert.Equal(t, []string{"oldest01", "older001"}, archived)
+
+			if tt.reopen != nil {
+				require.NoError(t, s.(*FileStorage).Close())
+				s = tt.reopen()
+			}
+			got, err := s.ReadUserURLs(ctx, &userUID)
+			require.NoError(t, err)
+			var shortURLs []string
+			for _, shortenedURL := range got {
+				shortURLs = append(shortURLs, shortenedURL.ShortURL)
+			}
+			assert.ElementsMatch(t, []string{"recent01", "alive001"}, shortURLs)
+			for shortURL, want := range map[string]int64{"oldest01": 0, "older001": 0, "alive001": 1} {
+				stats, err := s.ReadClickStats(ctx, shortURL, clickedAt, now, 5)
+				require.NoError(t, err)
+				assert.Equal(t, want, stats.Total, "clicks of %s", shortURL)
+			}
+
+			// the original URL of a purged link can be shortened again
+			reused := model.ShortenedURL{UUID: uuid.New(), ShortURL: "reused01", OriginalURL: "http://oldest.ru"}
+			require.NoError(t, s.WriteShortenedURL(ctx, &reused))
+		})
+	}
+}
+
+func TestArchive_Append(t *testing.T) {
+	path := t.TempDir() + "/purged.jsonl"
+	archive := NewArchive(path)
+	first := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edVPg3ks", OriginalURL: "http://ya.ru", DeletedFlag: true}
+	second := model.ShortenedURL{UUID: uuid.New(), ShortURL: "edJkl5jj", OriginalURL: "http://ya.com", DeletedFlag: true}
+	require.NoError(t, archive.Append([]model.ShortenedURL{first}))
+	require.NoError(t, archive.Append([]model.ShortenedURL{second}))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var got []model.ShortenedURL
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		shortenedURL := model.ShortenedURL{}
+		require.NoError(t, shortenedURL.UnmarshalJSON(scanner.Bytes()))
+		got = append(got, shortenedURL)
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []model.ShortenedURL{first, second}, got)
+}
+
+func TestFileStorage_PurgeDeleted_CompactsOncePerRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fss := NewFileStorage(config.AppConfig{
+		ShortenedURLsFilePath: dir + "/short-url-db.json",
+		UserURLsFilePath:      dir + "/user-url-db.json",
+	})
+	defer fss.Close()
+	deletedAt := sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+	for _, shortURL := range []string{"purge001", "purge002"} {
+		require.NoError(t, fss.WriteShortenedURL(ctx, &model.ShortenedURL{
+			UUID: uuid.New(), ShortURL: shortURL, OriginalURL: "http://" + shortURL + ".ru", DeletedFlag: true, DeletedAt: deletedAt,
+		}))
+	}
+
+	for i := 0; i < 2; i++ {
+		purged, err := fss.PurgeDeleted(ctx, time.Now(), 1, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, purged)
+		assert.NoFileExists(t, fss.snapshotFilePath, "full batches do not compact")
+	}
+	purged, err := fss.PurgeDeleted(ctx, time.Now(), 1, nil)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	assert.FileExists(t, fss.snapshotFilePath, "the last batch of the run compacts")
+}
+
+func TestFileStorage_PurgeDeleted_SurvivesRestartMidRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	appConfig := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/short-url-db.json",
+		UserURLsFilePath:      dir + "/user-url-db.json",
+	}
+	fss := NewFileStorage(appConfig)
+	userUID := uuid.New()
+	deletedAt := sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+	for i, shortURL := range []string{"purge001", "purge002"} {
+		url := model.ShortenedURL{
+			UUID: uuid.New(), ShortURL: shortURL, OriginalURL: "http://" + shortURL + ".ru", DeletedFlag: true,
+			DeletedAt: sql.NullTime{Time: deletedAt.Time.Add(time.Duration(i) * time.Minute), Valid: true},
+		}
+		require.NoError(t, fss.WriteShortenedURL(ctx, &url))
+		require.NoError(t, fss.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: url.UUID}))
+	}
+	clickedAt := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	require.NoError(t, fss.WriteClicks(ctx, []model.Click{{ShortURL: "purge001", ClickedAt: clickedAt}}))
+
+	var archived []string
+	archive := func(batch []model.ShortenedURL) error {
+		for _, shortenedURL := range batch {
+			archived = append(archived, shortenedURL.ShortURL)
+		}
+		return nil
+	}
+	purged, err := fss.PurgeDeleted(ctx, time.Now(), 1, archive)
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	require.NoFileExists(t, fss.snapshotFilePath)
+
+	// the process dies before the run compacts
+	fss = NewFileStorage(appConfig)
+	defer fss.Close()
+	shortenedURL, err := fss.ReadShortenedURL(ctx, "purge001")
+	require.NoError(t, err)
+	assert.Empty(t, shortenedURL.OriginalURL, "purged links stay purged")
+	got, err := fss.ReadUserURLs(ctx, &userUID)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "purge002", got[0].ShortURL)
+
+	for _, want := range []int{1, 0} {
+		purged, err := fss.PurgeDeleted(ctx, time.Now(), 1, archive)
+		require.NoError(t, err)
+		assert.Equal(t, want, purged)
+	}
+	assert.Equal(t, []string{"purge001", "purge002"}, archived, "a link is archived once")
+	stats, err := fss.ReadClickStats(ctx, "purge001", clickedAt, time.Now(), 5)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Total)
+	info, err := os.Stat(fss.removalsFilePath)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size(), "the compaction drops the removal log")
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sequenceBlockSize is the number of IDs the file storage reserves with a single write,
+// IDs of a reserved block that were not handed out before a restart are skipped.
+const sequenceBlockSize = 1000
+
+// Sequencer hands out monotonically increasing IDs starting from 1, never returning the same ID twice.
+type Sequencer interface {
+	NextID(ctx context.Context) (uint64, error)
+}
+
+func (storage *DBStorage) NextID(ctx context.Context) (uint64, error) {
+	query := `SELECT nextval('short_key_seq');`
+	if storage.db.DriverName() == driverSQLite {
+		query = `UPDATE sequences SET value = value + 1 WHERE name = 'short_key_seq' RETURNING value;`
+	}
+	var id uint64
+	if err := storage.db.GetContext(ctx, &id, query); err != nil {
+		return 0, fmt.Errorf("next id: %w", err)
+	}
+	return id, nil
+}
+
+func (ms *MemoryStorage) NextID(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ms.sequence.Add(1), nil
+}
+
+func (fs *FileStorage) NextID(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return fs.sequence.next()
+}
+
+// blockCounter persists only the upper bound of the reserved block, so a write is needed once per block.
+type blockCounter struct {
+	path   string // empty keeps the counter in memory
+	loaded bool
+	last   uint64 // last handed out ID
+	limit  uint64 // IDs up to limit are reserved
+	mutex  sync.Mutex
+}
+
+func (c *blockCounter) next() (uint64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded {
+		limit, err := readCounter(c.path)
+		if err != nil {
+			return 0, err
+		}
+		c.last, c.limit, c.loaded = limit, limit, true
+	}
+	if c.last == c.limit {
+		if err := writeCounter(c.path, c.limit+sequenceBlockSize); err != nil {
+			return 0, err
+		}
+		c.limit += sequenceBlockSize
+	}
+	c.last++
+	return c.last, nil
+}
+
+func readCounter(path string) (uint64, error) {
+	if path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read sequence: %w", err)
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse sequence: %w", err)
+	}
+	return value, nil
+}
+
+func writeCounter(path string, value uint64) error {
+	if path == "" {
+		return nil
+	}
+	err := WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%d\n", value)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("write sequence: %w", err)
+	}
+	return nil
+}
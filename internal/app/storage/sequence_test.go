@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"testing"
+)
+
+func TestFileStorage_NextID(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := config.AppConfig{
+		ShortenedURLsFilePath: dir + "/short-url-db.json",
+		UserURLsFilePath:      dir + "/user-url-db.json",
+		FileSyncPolicy:        SyncAlways,
+	}
+	fs := NewFileStorage(cfg)
+	for want := uint64(1); want <= sequenceBlockSize+1; want++ {
+		id, err := fs.NextID(ctx)
+		require.NoError(t, err)
+		require.Equal(t, want, id)
+	}
+	require.NoError(t, fs.Close())
+
+	// the rest of the reserved block is skipped after a restart
+	fs = NewFileStorage(cfg)
+	defer fs.Close()
+	id, err := fs.NextID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2*sequenceBlockSize+1), id)
+}
+
+func TestDBStorage_NextID_SQLite(t *testing.T) {
+	ctx := context.Background()
+	storage := NewDBStorage(config.AppConfig{DatabaseDSN: "sqlite://" + t.TempDir() + "/shortener.db"})
+	defer storage.db.Close()
+	for want := uint64(1); want <= 3; want++ {
+		id, err := storage.NextID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, id)
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileSnapshot struct {
+	ShortenedURLs []model.ShortenedURL `json:"shortened_urls"`
+	UserURLs      []model.UserURL      `json:"user_urls"`
+}
+
+// Compact writes the current state of the storage to the snapshot file and truncates the append-only logs.
+// The snapshot replaces the previous one atomically, so a crash at any point leaves either the old
+// snapshot with the full logs or the new snapshot with the logs not yet truncated. Replaying those on top
+// of the new snapshot restores the same state: records overwrite their own copies, and the removal log,
+// replayed last, removes the links it lists again.
+func (fs *FileStorage) Compact(ctx context.Context) error {
+	if fs.snapshotFilePath == "" {
+		return nil
+	}
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	snapshot := fileSnapshot{
+		ShortenedURLs: make([]model.ShortenedURL, 0, len(fs.uuidURLMap)),
+		UserURLs:      make([]model.UserURL, 0, len(fs.ownerSet)),
+	}
+	for _, shortenedURL := range fs.uuidURLMap {
+		snapshot.ShortenedURLs = append(snapshot.ShortenedURLs, shortenedURL)
+	}
+	for userUID, shortenedURLUUIDs := range fs.userURLMap {
+		for _, shortenedURLUUID := range shortenedURLUUIDs {
+			snapshot.UserURLs = append(snapshot.UserURLs, model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURLUUID})
+		}
+	}
+	if err := writeSnapshot(fs.snapshotFilePath, &snapshot); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	for _, producer := range []*Producer{fs.shortenedURLsProducer, fs.userURLsProducer, fs.removalsProducer} {
+		if producer == nil {
+			continue
+		}
+		if err := producer.truncate(); err != nil {
+			return fmt.Errorf("truncate log: %w", err)
+		}
+	}
+	return nil
+}
+
+// TriggerCompaction asks the running compaction loop to compact as soon as possible.
+func (fs *FileStorage) TriggerCompaction() {
+	select {
+	case fs.compactionTrigger <- struct{}{}:
+	default:
+		// a compaction is already pending
+	}
+}
+
+// RunCompaction compacts the storage every interval and on TriggerCompaction until ctx is done.
+// A non-positive interval disables periodic compaction, leaving only on-demand runs.
+func (fs *FileStorage) RunCompaction(ctx context.Context, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-fs.compactionTrigger:
+		case <-ctx.Done():
+			return
+		}
+		start := time.Now()
+		if err := fs.Compact(ctx); err != nil {
+			logger.Log.Error("failed to compact file storage", zap.Error(err))
+			continue
+		}
+		logger.Log.Info("file storage compacted", zap.Duration("duration", time.Since(start)))
+	}
+}
+
+func readSnapshot(path string) (*fileSnapshot, error) {
+	snapshot := &fileSnapshot{}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return snapshot, nil
+		}
+		return nil, fmt.Errorf("open snapshot: %w", err)
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+func writeSnapshot(path string, snapshot *fileSnapshot) error {
+	return WriteFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(snapshot)
+	})
+}
+
+// WriteFileAtomic replaces the file with the content written by write. The content goes to a unique
+// temporary file in the same directory, readable by the owner only, which is synced and renamed over
+// the file before the directory is synced, so a crash leaves either the old or the new file complete.
+func WriteFileAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
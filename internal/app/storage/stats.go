@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"time"
+)
+
+func (storage *DBStorage) ReadServiceStats(ctx context.Context, clicksSince time.Time) (*model.ServiceStats, error) {
+	stats := &model.ServiceStats{}
+	err := storage.db.GetContext(ctx, stats, `SELECT
+		(SELECT COUNT(*) FROM shortened_urls) AS urls,
+		(SELECT COUNT(DISTINCT uuid) FROM user_urls) AS users,
+		(SELECT COUNT(*) FROM shortened_urls WHERE is_deleted) AS deleted_urls,
+		(SELECT COUNT(*) FROM clicks WHERE clicked_at >= $1) AS recent_clicks;`,
+		utcTime(sql.NullTime{Time: clicksSince, Valid: true}))
+	if err != nil {
+		return nil, fmt.Errorf("read service stats: %w", err)
+	}
+	return stats, nil
+}
+
+func (ms *MemoryStorage) ReadServiceStats(ctx context.Context, clicksSince time.Time) (*model.ServiceStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+	stats := &model.ServiceStats{
+		URLs: int64(len(ms.shortURLMap)),
+	}
+	for _, shortenedURLUUIDs := range ms.userURLMap {
+		// the lists of users whose links were purged stay behind empty
+		if len(shortenedURLUUIDs) > 0 {
+			stats.Users++
+		}
+	}
+	for _, shortenedURL := range ms.shortURLMap {
+		if shortenedURL.DeletedFlag {
+			stats.DeletedURLs++
+		}
+	}
+	for _, click := range ms.clicks {
+		if !click.ClickedAt.Before(clicksSince) {
+			stats.RecentClicks++
+		}
+	}
+	return stats, nil
+}
+
+func (fs *FileStorage) ReadServiceStats(ctx context.Context, clicksSince time.Time) (*model.ServiceStats, error) {
+	fs.mutex.Lock()
+	stats := &model.ServiceStats{
+		URLs: int64(len(fs.shortURLMap)),
+	}
+	for _, shortenedURLUUIDs := range fs.userURLMap {
+		if len(shortenedURLUUIDs) > 0 {
+			stats.Users++
+		}
+	}
+	for _, shortenedURL := range fs.shortURLMap {
+		if shortenedURL.DeletedFlag {
+			stats.DeletedURLs++
+		}
+	}
+	fs.mutex.Unlock()
+
+	err := fs.clicks.scan(ctx, func(click model.Click) {
+		if !click.ClickedAt.Before(clicksSince) {
+			stats.RecentClicks++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"testing"
+	"time"
+)
+
+func TestStorage_ReadServiceStats(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now()
+	tests := []struct {
+		name string
+		open func() Storage
+	}{
+		{name: "memory", open: func() Storage { return NewMemoryStorage() }},
+		{
+			name: "file",
+			open: func() Storage {
+				return NewFileStorage(config.AppConfig{
+					ShortenedURLsFilePath: dir + "/short-url-db.json",
+					UserURLsFilePath:      dir + "/user-url-db.json",
+				})
+			},
+		},
+		{
+			name: "sqlite",
+			open: func() Storage {
+				return NewDBStorage(config.AppConfig{DatabaseDSN: "sqlite://" + dir + "/shortener.db"})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open()
+			alice, bob := uuid.New(), uuid.New()
+			owners := map[string]uuid.UUID{"stats001": alice, "stats002": alice, "stats003": bob}
+			for shortURL, owner := range owners {
+				shortenedURL := &model.ShortenedURL{UUID: uuid.New(), ShortURL: shortURL, OriginalURL: "http://stats.ru/" + shortURL}
+				require.NoError(t, s.WriteShortenedURL(ctx, shortenedURL))
+				require.NoError(t, s.CreateUserURL(ctx, &model.UserURL{UUID: owner, ShortenedURLUUID: shortenedURL.UUID}))
+			}
+			require.NoError(t, s.DeleteBulk(ctx, map[uuid.UUID][]string{bob: {"stats003"}}))
+			require.NoError(t, s.WriteClicks(ctx, []model.Click{
+				{ShortURL: "stats001", ClickedAt: now.Add(-48 * time.Hour)},
+				{ShortURL: "stats001", ClickedAt: now.Add(-time.Hour)},
+				{ShortURL: "stats002", ClickedAt: now.Add(-time.Minute)},
+			}))
+
+			got, err := s.ReadServiceStats(ctx, now.Add(-24*time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, &model.ServiceStats{URLs: 3, Users: 2, DeletedURLs: 1, RecentClicks: 2}, got)
+		})
+	}
+}
@@ -1,13 +1,28 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/ujwegh/shortener/internal/app/config"
 	"github.com/ujwegh/shortener/internal/app/logger"
 	"github.com/ujwegh/shortener/internal/app/model"
+	"go.uber.org/zap"
+	"sort"
+	"time"
 )
 
+const (
+	TypeMemory   = "memory"
+	TypeFile     = "file"
+	TypePostgres = "postgres"
+	TypeSQLite   = "sqlite"
+)
+
+var ErrNotFound = errors.New("shortened URL not found")
+
 type Storage interface {
 	WriteShortenedURL(ctx context.Context, shortenedURL *model.ShortenedURL) error
 	ReadShortenedURL(ctx context.Context, shortURL string) (*model.ShortenedURL, error)
@@ -16,14 +31,107 @@ type Storage interface {
 	CreateUserURL(ctx context.Context, userURL *model.UserURL) error
 	ReadUserURLs(ctx context.Context, userURL *uuid.UUID) ([]model.ShortenedURL, error)
 	DeleteBulk(background context.Context, buffer map[uuid.UUID][]string) error
+	// RestoreBulk clears the deleted flag of links owned by the user and returns the restored short URLs,
+	// links of other users, links that are not deleted and purged links are skipped.
+	RestoreBulk(ctx context.Context, userUID uuid.UUID, shortURLs []string) ([]string, error)
+	// DeleteExpired hard deletes up to limit links that expired before the given time together with their
+	// user links and clicks.
+	DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error)
+	// PurgeDeleted hard deletes up to limit links soft deleted before the given time together with their
+	// user links and clicks, archive, when set, gets them before they are removed and aborts the purge on error.
+	PurgeDeleted(ctx context.Context, before time.Time, limit int, archive func([]model.ShortenedURL) error) (int, error)
+	// ConsumeClick atomically spends one redirect of a click-limited link, false means the budget is used up.
+	ConsumeClick(ctx context.Context, shortURL string) (bool, error)
+	// WriteClicks appends redirect events for analytics.
+	WriteClicks(ctx context.Context, clicks []model.Click) error
+	// ReadClickStats aggregates the clicks of a link within [from, to), top bounds the referrer and user agent lists.
+	ReadClickStats(ctx context.Context, shortURL string, from, to time.Time, top int) (*model.ClickStats, error)
+	// ReadServiceStats counts all links and users, RecentClicks are the clicks since clicksSince.
+	ReadServiceStats(ctx context.Context, clicksSince time.Time) (*model.ServiceStats, error)
+}
+
+// Exporter streams every record of a storage ordered by UUID, starting right after the given position.
+// It is used to move data between storage backends.
+type Exporter interface {
+	ExportShortenedURLs(ctx context.Context, after uuid.UUID, fn func(model.ShortenedURL) error) error
+	ExportUserURLs(ctx context.Context, after model.UserURL, fn func(model.UserURL) error) error
 }
 
 func NewStorage(cfg config.AppConfig) Storage {
-	if cfg.DatabaseDSN != "" {
-		logger.Log.Info("Using database storage.")
-		return NewDBStorage(cfg)
-	} else {
+	st := storageType(cfg)
+	switch st {
+	case TypeMemory:
 		logger.Log.Info("Using in-memory storage.")
+		return NewMemoryStorage()
+	case TypeFile:
+		logger.Log.Info("Using file storage.")
 		return NewFileStorage(cfg)
+	case TypePostgres, TypeSQLite:
+		if cfg.DatabaseDSN == "" {
+			panic(fmt.Sprintf("database dsn is required for %s storage", st))
+		}
+		if IsSQLiteDSN(cfg.DatabaseDSN) != (st == TypeSQLite) {
+			panic(fmt.Sprintf("database dsn doesn't match %s storage", st))
+		}
+		logger.Log.Info("Using database storage.", zap.String("type", st))
+		return NewDBStorage(cfg)
+	default:
+		panic(fmt.Sprintf("unknown storage type %q", st))
+	}
+}
+
+func storageType(cfg config.AppConfig) string {
+	if cfg.StorageType != "" {
+		return cfg.StorageType
+	}
+	if IsSQLiteDSN(cfg.DatabaseDSN) {
+		return TypeSQLite
+	}
+	if cfg.DatabaseDSN != "" {
+		return TypePostgres
+	}
+	if cfg.ShortenedURLsFilePath == "" {
+		return TypeMemory
+	}
+	return TypeFile
+}
+
+// removeUUIDs filters the removed UUIDs out of the slice in place.
+func removeUUIDs(uuids []uuid.UUID, removed map[uuid.UUID]struct{}) []uuid.UUID {
+	kept := uuids[:0]
+	for _, id := range uuids {
+		if _, ok := removed[id]; !ok {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+func uuidLess(a, b uuid.UUID) bool {
+	return bytes.Compare(a[:], b[:]) < 0
+}
+
+func userURLLess(a, b model.UserURL) bool {
+	if a.UUID != b.UUID {
+		return uuidLess(a.UUID, b.UUID)
+	}
+	return uuidLess(a.ShortenedURLUUID, b.ShortenedURLUUID)
+}
+
+func exportSorted[T any](ctx context.Context, items []T, less func(a, b T) bool, after T, fn func(T) error) error {
+	sort.Slice(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+	for _, item := range items {
+		if !less(after, item) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
 	}
+	return nil
 }
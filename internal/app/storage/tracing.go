@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const instrumentationName = "github.com/ujwegh/shortener/internal/app/storage"
+
+const (
+	attrShortURL = attribute.Key("shortener.short_url")
+	attrUserUID  = attribute.Key("shortener.user_uid")
+	attrCount    = attribute.Key("shortener.count")
+)
+
+// TracedStorage wraps every Storage call into a span, SQL statements of a DBStorage become its children.
+type TracedStorage struct {
+	storage Storage
+}
+
+func NewTracedStorage(storage Storage) *TracedStorage {
+	return &TracedStorage{storage: storage}
+}
+
+func (ts *TracedStorage) WriteShortenedURL(ctx context.Context, shortenedURL *model.ShortenedURL) error {
+	ctx, span := startSpan(ctx, "WriteShortenedURL", attrShortURL.String(shortenedURL.ShortURL))
+	err := ts.storage.WriteShortenedURL(ctx, shortenedURL)
+	endSpan(span, err)
+	return err
+}
+
+func (ts *TracedStorage) ReadShortenedURL(ctx context.Context, shortURL string) (*model.ShortenedURL, error) {
+	ctx, span := startSpan(ctx, "ReadShortenedURL", attrShortURL.String(shortURL))
+	shortenedURL, err := ts.storage.ReadShortenedURL(ctx, shortURL)
+	endSpan(span, err)
+	return shortenedURL, err
+}
+
+func (ts *TracedStorage) Ping(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "Ping")
+	err := ts.storage.Ping(ctx)
+	endSpan(span, err)
+	return err
+}
+
+func (ts *TracedStorage) WriteBatchShortenedURLSlice(ctx context.Context, slice []model.ShortenedURL) error {
+	ctx, span := startSpan(ctx, "WriteBatchShortenedURLSlice", attrCount.Int(len(slice)))
+	err := ts.storage.WriteBatchShortenedURLSlice(ctx, slice)
+	endSpan(span, err)
+	return err
+}
+
+func (ts *TracedStorage) CreateUserURL(ctx context.Context, userURL *model.UserURL) error {
+	ctx, span := startSpan(ctx, "CreateUserURL", attrUserUID.String(userURL.UUID.String()))
+	err := ts.storage.CreateUserURL(ctx, userURL)
+	endSpan(span, err)
+	return err
+}
+
+func (ts *TracedStorage) ReadUserURLs(ctx context.Context, uid *uuid.UUID) ([]model.ShortenedURL, error) {
+	ctx, span := startSpan(ctx, "ReadUserURLs")
+	if uid != nil {
+		span.SetAttributes(attrUserUID.String(uid.String()))
+	}
+	shortenedURLs, err := ts.storage.ReadUserURLs(ctx, uid)
+	span.SetAttributes(attrCount.Int(len(shortenedURLs)))
+	endSpan(span, err)
+	return shortenedURLs, err
+}
+
+func (ts *TracedStorage) DeleteBulk(ctx context.Context, buffer map[uuid.UUID][]string) error {
+	ctx, span := startSpan(ctx, "DeleteBulk", attrCount.Int(len(buffer)))
+	err := ts.storage.DeleteBulk(ctx, buffer)
+	endSpan(span, err)
+	return err
+}
+
+func (ts *TracedStorage) RestoreBulk(ctx context.Context, userUID uuid.UUID, shortURLs []string) ([]string, error) {
+	ctx, span := startSpan(ctx, "RestoreBulk", attrUserUID.String(userUID.String()), attrCount.Int(len(shortURLs)))
+	restored, err := ts.storage.RestoreBulk(ctx, userUID, shortURLs)
+	endSpan(span, err)
+	return restored, err
+}
+
+func (ts *TracedStorage) PurgeDeleted(ctx context.Context, before time.Time, limit int,
+	archive func([]model.ShortenedURL) error) (int, error) {
+	ctx, span := startSpan(ctx, "PurgeDeleted")
+	purged, err := ts.storage.PurgeDeleted(ctx, before, limit, archive)
+	span.SetAttributes(attrCount.Int(purged))
+	endSpan(span, err)
+	return purged, err
+}
+
+func (ts *TracedStorage) DeleteExpired(ctx context.Context, before time.Time, limit int) (int, error) {
+	ctx, span := startSpan(ctx, "DeleteExpired")
+	deleted, err := ts.storage.DeleteExpired(ctx, before, limit)
+	span.SetAttributes(attrCount.Int(deleted))
+	endSpan(span, err)
+	return deleted, err
+}
+
+func (ts *TracedStorage) ConsumeClick(ctx context.Context, shortURL string) (bool, error) {
+	ctx, span := startSpan(ctx, "ConsumeClick", attrShortURL.String(shortURL))
+	ok, err := ts.storage.ConsumeClick(ctx, shortURL)
+	endSpan(span, err)
+	return ok, err
+}
+
+func (ts *TracedStorage) WriteClicks(ctx context.Context, clicks []model.Click) error {
+	ctx, span := startSpan(ctx, "WriteClicks", attrCount.Int(len(clicks)))
+	err := ts.storage.WriteClicks(ctx, clicks)
+	endSpan(span, err)
+	return err
+}
+
+func (ts *TracedStorage) ReadClickStats(ctx context.Context, shortURL string, from, to time.Time, top int) (*model.ClickStats, error) {
+	ctx, span := startSpan(ctx, "ReadClickStats", attrShortURL.String(shortURL))
+	stats, err := ts.storage.ReadClickStats(ctx, shortURL, from, to, top)
+	endSpan(span, err)
+	return stats, err
+}
+
+func (ts *TracedStorage) ReadServiceStats(ctx context.Context, clicksSince time.Time) (*model.ServiceStats, error) {
+	ctx, span := startSpan(ctx, "ReadServiceStats")
+	stats, err := ts.storage.ReadServiceStats(ctx, clicksSince)
+	endSpan(span, err)
+	return stats, err
+}
+
+// The tracer is looked up on every call so a provider installed after startup is picked up.
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, "storage."+method, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	// a lookup miss is an expected answer, not a failure
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
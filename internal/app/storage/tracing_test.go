@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"strings"
+	"testing"
+)
+
+func TestTracedStorage(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	s := NewTracedStorage(NewDBStorage(config.AppConfig{DatabaseDSN: "sqlite://" + t.TempDir() + "/shortener.db"}))
+	// statements outside of a trace, like the migrations, are not recorded
+	assert.Empty(t, recorder.Ended())
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), "request")
+	shortenedURL := &model.ShortenedURL{UUID: uuid.New(), ShortURL: "traced01", OriginalURL: "http://traced.ru"}
+	require.NoError(t, s.WriteShortenedURL(ctx, shortenedURL))
+	require.NoError(t, s.CreateUserURL(ctx, &model.UserURL{UUID: uuid.New(), ShortenedURLUUID: shortenedURL.UUID}))
+	_, err := s.ReadShortenedURL(ctx, "missing")
+	require.ErrorIs(t, err, ErrNotFound)
+	root.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	var statements []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if strings.HasPrefix(span.Name(), "storage.") {
+			spans[span.Name()] = span
+		} else if span.Name() != "request" {
+			statements = append(statements, span)
+		}
+	}
+	for _, name := range []string{"storage.WriteShortenedURL", "storage.CreateUserURL", "storage.ReadShortenedURL"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, root.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+	// a miss is not an error
+	assert.Equal(t, codes.Unset, spans["storage.ReadShortenedURL"].Status().Code)
+
+	storageSpans := make(map[string]bool)
+	for _, span := range spans {
+		storageSpans[span.SpanContext().SpanID().String()] = true
+	}
+	var queries []string
+	for _, span := range statements {
+		assert.True(t, storageSpans[span.Parent().SpanID().String()], span.Name())
+		assert.Contains(t, span.Attributes(), semconv.DBSystemSqlite)
+		for _, attr := range span.Attributes() {
+			if attr.Key == semconv.DBStatementKey {
+				queries = append(queries, attr.Value.AsString())
+			}
+		}
+	}
+	assert.True(t, containsPrefix(queries, "INSERT INTO shortened_urls"), queries)
+	assert.True(t, containsPrefix(queries, "INSERT INTO user_urls"), queries)
+}
+
+func containsPrefix(queries []string, prefix string) bool {
+	for _, query := range queries {
+		if strings.HasPrefix(strings.TrimSpace(query), prefix) {
+			return true
+		}
+	}
+	return false
+}
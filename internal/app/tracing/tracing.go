@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"os"
+	"sync"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+const serviceName = "shortener"
+
+// ExporterFactory builds the span exporter selected by AppConfig.TraceExporter.
+type ExporterFactory func(cfg config.AppConfig) (sdktrace.SpanExporter, error)
+
+var (
+	exporters = map[string]ExporterFactory{
+		ExporterStdout: newStdoutExporter,
+		ExporterFile:   newFileExporter,
+	}
+	exportersMutex sync.RWMutex
+)
+
+// RegisterExporter makes another exporter, e.g. one shipping spans to a collector, selectable by name.
+func RegisterExporter(name string, factory ExporterFactory) {
+	exportersMutex.Lock()
+	defer exportersMutex.Unlock()
+	exporters[name] = factory
+}
+
+// Setup installs the W3C trace context propagator and a tracer provider exporting through the configured exporter.
+// Without an exporter spans are not recorded, but incoming trace context is still passed on.
+// The returned function flushes the pending spans.
+func Setup(cfg config.AppConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.TraceExporter == "" || cfg.TraceExporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exportersMutex.RLock()
+	factory, ok := exporters[cfg.TraceExporter]
+	exportersMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.TraceExporter)
+	}
+	exporter, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", cfg.TraceExporter, err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func newStdoutExporter(config.AppConfig) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+}
+
+// fileExporter appends spans as JSON lines and closes the file on shutdown.
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func newFileExporter(cfg config.AppConfig) (sdktrace.SpanExporter, error) {
+	if cfg.TraceFilePath == "" {
+		return nil, errors.New("trace file path is empty")
+	}
+	file, err := os.OpenFile(cfg.TraceFilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileExporter{SpanExporter: exporter, file: file}, nil
+}
+
+func (fe *fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(fe.SpanExporter.Shutdown(ctx), fe.file.Close())
+}
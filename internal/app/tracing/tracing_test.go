@@ -0,0 +1,28 @@
+package tracing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/config"
+	"go.opentelemetry.io/otel"
+	"os"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	_, err := Setup(config.AppConfig{TraceExporter: "collector"})
+	assert.ErrorContains(t, err, `unknown trace exporter "collector"`)
+
+	path := t.TempDir() + "/traces.json"
+	shutdown, err := Setup(config.AppConfig{TraceExporter: ExporterFile, TraceFilePath: path})
+	require.NoError(t, err)
+	_, span := otel.Tracer("test").Start(context.Background(), "shorten")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"Name":"shorten"`)
+	assert.Contains(t, string(content), `"shortener"`)
+}
@@ -0,0 +1,231 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/ujwegh/shortener/internal/app/config"
+	appErrors "github.com/ujwegh/shortener/internal/app/errors"
+	"github.com/ujwegh/shortener/internal/app/logger"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"go.uber.org/zap"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+const (
+	phaseShortenedURLs = "shortened_urls"
+	phaseUserURLs      = "user_urls"
+
+	checkpointEvery = 100
+)
+
+type (
+	Options struct {
+		DryRun         bool
+		CheckpointPath string
+		// Scope identifies the migration, see MigrationScope, a checkpoint of another one is rejected
+		Scope string
+	}
+	Result struct {
+		ShortenedURLs int
+		UserURLs      int
+		Skipped       int
+	}
+	// Checkpoint is the position of the last record copied to the target storage.
+	Checkpoint struct {
+		Scope            string        `json:"scope"`
+		Phase            string        `json:"phase"`
+		LastShortenedURL uuid.UUID     `json:"last_shortened_url"`
+		LastUserURL      model.UserURL `json:"last_user_url"`
+		// SkippedShortenedURLs were not copied, their user URLs would reference a missing row
+		SkippedShortenedURLs []uuid.UUID `json:"skipped_shortened_urls,omitempty"`
+	}
+)
+
+// Run copies every shortened URL with its deletion flag and every user URL from one storage to another,
+// preserving short keys and UUIDs. Shortened URLs go first so user URLs always reference existing rows.
+// Progress is saved to the checkpoint file, a rerun of the same migration continues after the last saved record.
+// The checkpoint is removed once the migration completes.
+func Run(ctx context.Context, from storage.Exporter, to storage.Storage, opts Options) (Result, error) {
+	result := Result{}
+	checkpoint, err := readCheckpoint(opts.CheckpointPath)
+	if err != nil {
+		return result, err
+	}
+	if checkpoint.Phase == "" {
+		checkpoint.Scope = opts.Scope
+	} else if checkpoint.Scope != opts.Scope {
+		return result, fmt.Errorf("checkpoint %s belongs to another migration, remove it to start over", opts.CheckpointPath)
+	}
+
+	save := func(force bool) error {
+		if opts.DryRun || opts.CheckpointPath == "" {
+			return nil
+		}
+		if !force && (result.ShortenedURLs+result.UserURLs+result.Skipped)%checkpointEvery != 0 {
+			return nil
+		}
+		return writeCheckpoint(opts.CheckpointPath, checkpoint)
+	}
+
+	if checkpoint.Phase == "" || checkpoint.Phase == phaseShortenedURLs {
+		checkpoint.Phase = phaseShortenedURLs
+		err = from.ExportShortenedURLs(ctx, checkpoint.LastShortenedURL, func(shortenedURL model.ShortenedURL) error {
+			if !opts.DryRun {
+				err := to.WriteShortenedURL(ctx, &shortenedURL)
+				if err != nil && alreadyCopied(ctx, to, shortenedURL) {
+					result.Skipped++
+				} else if isUniqueViolation(err) {
+					logger.Log.Warn("shortened URL already exists in target, skipping",
+						zap.String("short_url", shortenedURL.ShortURL))
+					checkpoint.SkippedShortenedURLs = append(checkpoint.SkippedShortenedURLs, shortenedURL.UUID)
+					result.Skipped++
+				} else if err != nil {
+					return fmt.Errorf("write shortened URL %s: %w", shortenedURL.ShortURL, err)
+				} else {
+					result.ShortenedURLs++
+				}
+			} else {
+				result.ShortenedURLs++
+			}
+			checkpoint.LastShortenedURL = shortenedURL.UUID
+			return save(false)
+		})
+		if err != nil {
+			return result, errors.Join(err, save(true))
+		}
+		checkpoint.Phase = phaseUserURLs
+		if err := save(true); err != nil {
+			return result, err
+		}
+	}
+
+	skipped := make(map[uuid.UUID]struct{}, len(checkpoint.SkippedShortenedURLs))
+	for _, shortenedURLUUID := range checkpoint.SkippedShortenedURLs {
+		skipped[shortenedURLUUID] = struct{}{}
+	}
+	err = from.ExportUserURLs(ctx, checkpoint.LastUserURL, func(userURL model.UserURL) error {
+		if _, ok := skipped[userURL.ShortenedURLUUID]; ok {
+			result.Skipped++
+		} else if !opts.DryRun {
+			err := to.CreateUserURL(ctx, &userURL)
+			if isUniqueViolation(err) {
+				result.Skipped++
+			} else if err != nil {
+				return fmt.Errorf("write user URL %s: %w", userURL.ShortenedURLUUID, err)
+			} else {
+				result.UserURLs++
+			}
+		} else {
+			result.UserURLs++
+		}
+		checkpoint.LastUserURL = userURL
+		return save(false)
+	})
+	if err != nil {
+		return result, errors.Join(err, save(true))
+	}
+	if opts.DryRun || opts.CheckpointPath == "" {
+		return result, nil
+	}
+	if err := os.Remove(opts.CheckpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return result, fmt.Errorf("remove checkpoint: %w", err)
+	}
+	return result, nil
+}
+
+// MigrationScope identifies a migration by its storages, hashed since the URLs may carry credentials.
+func MigrationScope(from, to string) string {
+	sum := sha256.Sum256([]byte(from + "\n" + to))
+	return hex.EncodeToString(sum[:])
+}
+
+// OpenStorage opens a storage backend by URL:
+// file:///tmp/short-url-db.json[?users=/tmp/user-url-db.json], postgres://..., sqlite:///path or memory://.
+func OpenStorage(rawURL string) (s storage.Storage, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse storage url: %w", err)
+	}
+	cfg := config.AppConfig{FileSyncPolicy: storage.SyncAlways}
+	switch u.Scheme {
+	case "file":
+		cfg.StorageType = storage.TypeFile
+		cfg.ShortenedURLsFilePath = u.Path
+		cfg.UserURLsFilePath = u.Query().Get("users")
+		if cfg.UserURLsFilePath == "" {
+			cfg.UserURLsFilePath = filepath.Join(filepath.Dir(u.Path), "user-url-db.json")
+		}
+	case "postgres", "postgresql":
+		cfg.StorageType = storage.TypePostgres
+		cfg.DatabaseDSN = rawURL
+	case "sqlite", "sqlite3":
+		cfg.StorageType = storage.TypeSQLite
+		cfg.DatabaseDSN = rawURL
+	case "memory":
+		cfg.StorageType = storage.TypeMemory
+	default:
+		return nil, fmt.Errorf("unsupported storage url scheme %q", u.Scheme)
+	}
+
+	// storage constructors panic on misconfiguration, report it as a regular error instead
+	defer func() {
+		if r := recover(); r != nil {
+			s, err = nil, fmt.Errorf("open storage %s: %v", u.Scheme, r)
+		}
+	}()
+	return storage.NewStorage(cfg), nil
+}
+
+// alreadyCopied tells a record written by an interrupted run, which was saved after the last checkpoint,
+// from a different record holding the same short key.
+func alreadyCopied(ctx context.Context, to storage.Storage, shortenedURL model.ShortenedURL) bool {
+	existing, err := to.ReadShortenedURL(ctx, shortenedURL.ShortURL)
+	return err == nil && existing != nil && existing.UUID == shortenedURL.UUID
+}
+
+func isUniqueViolation(err error) bool {
+	shortenerError := appErrors.ShortenerError{}
+	return err != nil && errors.As(err, &shortenerError) && shortenerError.Msg() == "unique violation"
+}
+
+func readCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{}
+	if path == "" {
+		return checkpoint, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+func writeCheckpoint(path string, checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+	err = storage.WriteFileAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ujwegh/shortener/internal/app/model"
+	"github.com/ujwegh/shortener/internal/app/storage"
+	"testing"
+)
+
+type failingStorage struct {
+	*storage.MemoryStorage
+	writesLeft int
+}
+
+func (fs *failingStorage) WriteShortenedURL(ctx context.Context, shortenedURL *model.ShortenedURL) error {
+	if fs.writesLeft == 0 {
+		return errors.New("connection lost")
+	}
+	fs.writesLeft--
+	return fs.MemoryStorage.WriteShortenedURL(ctx, shortenedURL)
+}
+
+func prepareSource(t *testing.T, count int) (*storage.MemoryStorage, uuid.UUID) {
+	ctx := context.Background()
+	source := storage.NewMemoryStorage()
+	userUID := uuid.New()
+	for i := 0; i < count; i++ {
+		shortenedURL := &model.ShortenedURL{
+			UUID:        uuid.New(),
+			ShortURL:    fmt.Sprintf("key%d", i),
+			OriginalURL: fmt.Sprintf("https://example.com/%d", i),
+		}
+		require.NoError(t, source.WriteShortenedURL(ctx, shortenedURL))
+		require.NoError(t, source.CreateUserURL(ctx, &model.UserURL{UUID: userUID, ShortenedURLUUID: shortenedURL.UUID}))
+	}
+	require.NoError(t, source.DeleteBulk(ctx, map[uuid.UUID][]string{userUID: {"key0"}}))
+	return source, userUID
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	source, userUID := prepareSource(t, 250)
+
+	tests := []struct {
+		name string
+		opts Options
+		want Result
+	}{
+		{
+			name: "dry run",
+			opts: Options{DryRun: true, CheckpointPath: t.TempDir() + "/checkpoint"},
+			want: Result{ShortenedURLs: 250, UserURLs: 250},
+		},
+		{
+			name: "full run",
+			opts: Options{CheckpointPath: t.TempDir() + "/checkpoint"},
+			want: Result{ShortenedURLs: 250, UserURLs: 250},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := storage.NewMemoryStorage()
+			got, err := Run(ctx, source, target, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			userURLs, err := target.ReadUserURLs(ctx, &userUID)
+			require.NoError(t, err)
+			if tt.opts.DryRun {
+				assert.Empty(t, userURLs)
+				assert.NoFileExists(t, tt.opts.CheckpointPath)
+				return
+			}
+			want, err := source.ReadUserURLs(ctx, &userUID)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, want, userURLs)
+
+			deleted, err := target.ReadShortenedURL(ctx, "key0")
+			require.NoError(t, err)
+			assert.True(t, deleted.DeletedFlag)
+		})
+	}
+}
+
+func TestRun_Resume(t *testing.T) {
+	ctx := context.Background()
+	source, userUID := prepareSource(t, 250)
+	opts := Options{CheckpointPath: t.TempDir() + "/checkpoint", Scope: MigrationScope("memory://a", "memory://b")}
+	target := &failingStorage{MemoryStorage: storage.NewMemoryStorage(), writesLeft: 130}
+
+	_, err := Run(ctx, source, target, opts)
+	require.Error(t, err)
+	checkpoint, err := readCheckpoint(opts.CheckpointPath)
+	require.NoError(t, err)
+	assert.Equal(t, phaseShortenedURLs, checkpoint.Phase)
+	assert.Equal(t, opts.Scope, checkpoint.Scope)
+
+	// the checkpoint must not be applied to a migration between other storages
+	other := opts
+	other.Scope = MigrationScope("memory://a", "memory://c")
+	_, err = Run(ctx, source, storage.NewMemoryStorage(), other)
+	require.Error(t, err)
+
+	target.writesLeft = -1
+	got, err := Run(ctx, source, target, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 250-130, got.ShortenedURLs+got.Skipped, "resumed run must continue after the checkpoint")
+	assert.Equal(t, 250, got.UserURLs)
+
+	userURLs, err := target.ReadUserURLs(ctx, &userUID)
+	require.NoError(t, err)
+	assert.Len(t, userURLs, 250)
+	assert.NoFileExists(t, opts.CheckpointPath, "a completed migration removes its checkpoint")
+}
+
+func TestRun_ResumeBehindCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	source, userUID := prepareSource(t, 250)
+	opts := Options{CheckpointPath: t.TempDir() + "/checkpoint"}
+	target := storage.NewMemoryStorage()
+	// the process died after copying 130 records, the checkpoint only covers the first 100
+	var copied []model.ShortenedURL
+	require.NoError(t, source.ExportShortenedURLs(ctx, uuid.Nil, func(shortenedURL model.ShortenedURL) error {
+		if len(copied) < 130 {
+			copied = append(copied, shortenedURL)
+			return target.WriteShortenedURL(ctx, &shortenedURL)
+		}
+		return nil
+	}))
+	require.NoError(t, writeCheckpoint(opts.CheckpointPath, &Checkpoint{
+		Phase:            phaseShortenedURLs,
+		LastShortenedURL: copied[99].UUID,
+	}))
+
+	got, err := Run(ctx, source, target, opts)
+	require.NoError(t, err)
+	assert.Equal(t, Result{ShortenedURLs: 120, UserURLs: 250, Skipped: 30}, got)
+	userURLs, err := target.ReadUserURLs(ctx, &userUID)
+	require.NoError(t, err)
+	assert.Len(t, userURLs, 250)
+
+	// a different record holding a copied short key still fails the run
+	conflicting := storage.NewMemoryStorage()
+	require.NoError(t, conflicting.WriteShortenedURL(ctx, &model.ShortenedURL{
+		UUID: uuid.New(), ShortURL: copied[0].ShortURL, OriginalURL: "https://other.com",
+	}))
+	_, err = Run(ctx, source, conflicting, Options{})
+	assert.Error(t, err)
+}
+
+func TestRun_ConflictingOriginalURL(t *testing.T) {
+	ctx := context.Background()
+	source, userUID := prepareSource(t, 3)
+	target, err := OpenStorage("sqlite://" + t.TempDir() + "/target.db")
+	require.NoError(t, err)
+	existing := &model.ShortenedURL{UUID: uuid.New(), ShortURL: "existing", OriginalURL: "https://example.com/1"}
+	require.NoError(t, target.WriteShortenedURL(ctx, existing))
+
+	got, err := Run(ctx, source, target, Options{CheckpointPath: t.TempDir() + "/checkpoint"})
+	require.NoError(t, err, "the user URLs of a skipped link must not fail the run")
+	assert.Equal(t, Result{ShortenedURLs: 2, UserURLs: 2, Skipped: 2}, got)
+	userURLs, err := target.ReadUserURLs(ctx, &userUID)
+	require.NoError(t, err)
+	var shortURLs []string
+	for _, userURL := range userURLs {
+		shortURLs = append(shortURLs, userURL.ShortURL)
+	}
+	assert.ElementsMatch(t, []string{"key0", "key2"}, shortURLs)
+}
+
+func TestOpenStorage(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "file", url: "file://" + dir + "/short-url-db.json", wantErr: false},
+		{name: "sqlite", url: "sqlite://" + dir + "/shortener.db", wantErr: false},
+		{name: "memory", url: "memory://", wantErr: false},
+		{name: "unknown scheme", url: "redis://localhost", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := OpenStorage(tt.url)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_, ok := s.(storage.Exporter)
+			assert.True(t, ok)
+		})
+	}
+}
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+create sequence if not exists short_key_seq;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop sequence if exists short_key_seq;
+-- +goose StatementEnd
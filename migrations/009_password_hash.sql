@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shortened_urls
+    add column if not exists password_hash varchar;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table shortened_urls
+    drop column if exists password_hash;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists clicks
+(
+    id         bigserial primary key,
+    short_url  varchar     not null,
+    clicked_at timestamptz not null,
+    referrer   varchar     not null default '',
+    user_agent varchar     not null default '',
+    ip_prefix  varchar     not null default ''
+);
+create index if not exists clicks_short_url_clicked_at_idx on clicks (short_url, clicked_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists clicks;
+-- +goose StatementEnd
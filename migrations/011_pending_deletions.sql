@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists pending_deletions
+(
+    id         uuid primary key,
+    user_uuid  uuid        not null,
+    short_urls text        not null,
+    created_at timestamptz not null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists pending_deletions;
+-- +goose StatementEnd
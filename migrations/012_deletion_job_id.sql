@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table pending_deletions
+    add column if not exists job_id uuid;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table pending_deletions
+    drop column if exists job_id;
+-- +goose StatementEnd
@@ -1,6 +1,30 @@
 package migrations
 
-import "embed"
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite3"
+)
 
 //go:embed *.sql
 var FS embed.FS
+
+//go:embed sqlite/*.sql
+var SQLiteFS embed.FS
+
+// ForDialect returns the migrations filesystem and the directory inside it for the goose dialect.
+func ForDialect(dialect string) (fs.FS, string, error) {
+	switch dialect {
+	case DialectPostgres:
+		return FS, ".", nil
+	case DialectSQLite:
+		return SQLiteFS, "sqlite", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported migrations dialect %q", dialect)
+	}
+}
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE shortened_urls
+(
+    uuid         TEXT PRIMARY KEY,
+    short_url    TEXT UNIQUE NOT NULL,
+    original_url TEXT        NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE shortened_urls;
+-- +goose StatementEnd
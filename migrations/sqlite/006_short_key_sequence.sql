@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists sequences
+(
+    name  text primary key,
+    value integer not null
+);
+insert into sequences (name, value) values ('short_key_seq', 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists sequences;
+-- +goose StatementEnd
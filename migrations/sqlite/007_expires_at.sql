@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shortened_urls
+    add column expires_at timestamp;
+create index if not exists shortened_urls_expires_at_idx on shortened_urls (expires_at)
+    where expires_at is not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists shortened_urls_expires_at_idx;
+alter table shortened_urls
+    drop column expires_at;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shortened_urls
+    add column clicks_left integer check (clicks_left >= 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table shortened_urls
+    drop column clicks_left;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shortened_urls
+    add column password_hash text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table shortened_urls
+    drop column password_hash;
+-- +goose StatementEnd
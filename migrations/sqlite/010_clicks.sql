@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists clicks
+(
+    id         integer primary key autoincrement,
+    short_url  text      not null,
+    clicked_at timestamp not null,
+    referrer   text      not null default '',
+    user_agent text      not null default '',
+    ip_prefix  text      not null default ''
+);
+create index if not exists clicks_short_url_clicked_at_idx on clicks (short_url, clicked_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists clicks;
+-- +goose StatementEnd
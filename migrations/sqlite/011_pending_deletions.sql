@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+create table if not exists pending_deletions
+(
+    id         text primary key,
+    user_uuid  text      not null,
+    short_urls text      not null,
+    created_at timestamp not null
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table if exists pending_deletions;
+-- +goose StatementEnd
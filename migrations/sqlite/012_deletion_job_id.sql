@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table pending_deletions
+    add column job_id text;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table pending_deletions
+    drop column job_id;
+-- +goose StatementEnd
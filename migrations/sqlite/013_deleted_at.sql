@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table shortened_urls
+    add column deleted_at timestamp;
+-- links deleted before the column existed start their retention now
+update shortened_urls set deleted_at = datetime('now') where is_deleted and deleted_at is null;
+create index if not exists shortened_urls_deleted_at_idx on shortened_urls (deleted_at)
+    where deleted_at is not null;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index if exists shortened_urls_deleted_at_idx;
+alter table shortened_urls
+    drop column deleted_at;
+-- +goose StatementEnd